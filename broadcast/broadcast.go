@@ -0,0 +1,474 @@
+// Package broadcast sends a message to large numbers of chats, such as announcements to all of a bot's users.
+//
+// Broadcasts are paced to stay within telegram's global rate limits, retry flood wait and server errors, classify
+// failures (eg users who blocked the bot), and save their progress so that they can be resumed after a crash.
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	// DefaultRate is the default number of messages sent per second. Telegram allows for roughly 30 messages per
+	// second in total, unless paid broadcasts are enabled.
+	DefaultRate = 25
+	// DefaultConcurrency is the default number of messages being sent at the same time.
+	DefaultConcurrency = 8
+	// DefaultMaxRetries is the default number of times to retry sending a message after a flood wait or server error.
+	DefaultMaxRetries = 3
+	// DefaultSaveInterval is the default number of recipients to process between saving progress.
+	DefaultSaveInterval = 100
+)
+
+// Recipients iterates over the chats to send a broadcast to.
+// Recipients must always be returned in the same order, so that broadcasts can be resumed.
+type Recipients interface {
+	// Next returns the chat ID of the next recipient, or io.EOF once all recipients have been returned.
+	Next(ctx context.Context) (int64, error)
+}
+
+// RecipientsFunc allows for using a function as Recipients; eg to page through a database.
+type RecipientsFunc func(ctx context.Context) (int64, error)
+
+func (f RecipientsFunc) Next(ctx context.Context) (int64, error) {
+	return f(ctx)
+}
+
+// Slice returns Recipients which iterate over a slice of chat IDs.
+func Slice(chatIds []int64) Recipients {
+	idx := 0
+	return RecipientsFunc(func(ctx context.Context) (int64, error) {
+		if idx >= len(chatIds) {
+			return 0, io.EOF
+		}
+		idx++
+		return chatIds[idx-1], nil
+	})
+}
+
+// FailureReason is the reason a message could not be sent to a recipient.
+type FailureReason string
+
+const (
+	// FailureBlocked means the user blocked the bot.
+	FailureBlocked FailureReason = "blocked"
+	// FailureDeactivated means the user's account was deleted.
+	FailureDeactivated FailureReason = "deactivated"
+	// FailureChatNotFound means the chat does not exist, or the bot has never interacted with it.
+	FailureChatNotFound FailureReason = "chat_not_found"
+	// FailureKicked means the bot was removed from the group or channel.
+	FailureKicked FailureReason = "kicked"
+	// FailureOther covers all other errors.
+	FailureOther FailureReason = "other"
+)
+
+// Classify returns the reason for a failure to send a message. Recipients which failed with any reason other than
+// FailureOther will most likely never be reachable, and can be removed from the recipient list.
+func Classify(err error) FailureReason {
+	var tgErr *gotgbot.TelegramError
+	if !errors.As(err, &tgErr) {
+		return FailureOther
+	}
+
+	desc := strings.ToLower(tgErr.Description)
+	switch {
+	case strings.Contains(desc, "bot was blocked by the user"):
+		return FailureBlocked
+	case strings.Contains(desc, "user is deactivated"):
+		return FailureDeactivated
+	case strings.Contains(desc, "chat not found"):
+		return FailureChatNotFound
+	case strings.Contains(desc, "bot was kicked"), strings.Contains(desc, "bot is not a member"):
+		return FailureKicked
+	default:
+		return FailureOther
+	}
+}
+
+// Result is the outcome of sending a broadcast to a single recipient.
+type Result struct {
+	ChatId int64
+	// Err is the error returned when sending the message, if any.
+	Err error
+	// Reason is the classification of Err; empty if the message was sent successfully.
+	Reason FailureReason
+}
+
+// Report summarises the results of a broadcast.
+type Report struct {
+	// Total is the number of recipients processed.
+	Total int64 `json:"total"`
+	// Sent is the number of recipients which received the message.
+	Sent int64 `json:"sent"`
+	// Failed is the number of recipients which could not be sent the message.
+	Failed int64 `json:"failed"`
+	// Failures counts the failed recipients by FailureReason.
+	Failures map[FailureReason]int64 `json:"failures,omitempty"`
+	// Started is the time the broadcast was first started.
+	Started time.Time `json:"started"`
+	// Finished is the time the broadcast completed; zero if it has not yet completed.
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// Broadcaster sends broadcasts using a Bot.
+type Broadcaster struct {
+	Bot *gotgbot.Bot
+	// Store is used to save the progress of broadcasts.
+	Store Store
+	// Rate is the maximum number of messages to send per second, including retries.
+	Rate float64
+	// Concurrency is the number of messages being sent at the same time.
+	Concurrency int
+	// MaxRetries is the number of times to retry sending a message after a flood wait or server error.
+	MaxRetries int
+	// SaveInterval is the number of recipients to process between saving progress.
+	SaveInterval int64
+	// OnResult, if set, is called with the result of each recipient; eg to remove users who blocked the bot.
+	// It may be called concurrently.
+	OnResult func(Result)
+}
+
+// Opts contains the optional fields for the New constructor.
+type Opts struct {
+	// Store is used to save the progress of broadcasts. Defaults to an InMemoryStore; use a persistent store (such as
+	// a FileStore) to resume broadcasts after a restart.
+	Store Store
+	// Rate is the maximum number of messages to send per second, including retries. Defaults to DefaultRate.
+	Rate float64
+	// Concurrency is the number of messages being sent at the same time. Defaults to DefaultConcurrency.
+	Concurrency int
+	// MaxRetries is the number of times to retry sending a message after a flood wait or server error.
+	// Defaults to DefaultMaxRetries; set to a negative value to disable retries.
+	MaxRetries int
+	// SaveInterval is the number of recipients to process between saving progress. Defaults to DefaultSaveInterval.
+	SaveInterval int64
+	// OnResult, if set, is called with the result of each recipient; eg to remove users who blocked the bot.
+	// It may be called concurrently.
+	OnResult func(Result)
+}
+
+func New(b *gotgbot.Bot, opts *Opts) *Broadcaster {
+	br := &Broadcaster{
+		Bot:          b,
+		Store:        NewInMemoryStore(),
+		Rate:         DefaultRate,
+		Concurrency:  DefaultConcurrency,
+		MaxRetries:   DefaultMaxRetries,
+		SaveInterval: DefaultSaveInterval,
+	}
+
+	if opts != nil {
+		if opts.Store != nil {
+			br.Store = opts.Store
+		}
+		if opts.Rate > 0 {
+			br.Rate = opts.Rate
+		}
+		if opts.Concurrency > 0 {
+			br.Concurrency = opts.Concurrency
+		}
+		if opts.MaxRetries > 0 {
+			br.MaxRetries = opts.MaxRetries
+		} else if opts.MaxRetries < 0 {
+			br.MaxRetries = 0
+		}
+		if opts.SaveInterval > 0 {
+			br.SaveInterval = opts.SaveInterval
+		}
+		br.OnResult = opts.OnResult
+	}
+
+	return br
+}
+
+// Run sends a message to all recipients, and returns the final report.
+//
+// The broadcast's progress is saved under the given ID. If the broadcast was previously interrupted (eg by cancelling
+// the context, or by a crash), running it again with the same ID resumes it, skipping any recipients which were
+// already processed. In case of a crash, recipients which were being sent to may receive the message twice.
+//
+// If the context is cancelled, the report so far is returned along with the context's error.
+func (br *Broadcaster) Run(ctx context.Context, id string, recipients Recipients, msg Message) (*Report, error) {
+	progress := Progress{Report: Report{Started: time.Now()}}
+	saved, err := br.Store.Get(id)
+	if err == nil {
+		progress = *saved
+	} else if !errors.Is(err, ErrProgressNotFound) {
+		return nil, fmt.Errorf("failed to get broadcast progress: %w", err)
+	}
+	progress.Report.Finished = time.Time{}
+
+	t := newTracker(br, id, progress)
+
+	// Skip the recipients which were all processed in a previous run.
+	for i := int64(0); i < progress.Offset; i++ {
+		if _, err = recipients.Next(ctx); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to skip processed recipients: %w", err)
+		}
+	}
+
+	jobs := make(chan job)
+	l := newLimiter(br.Rate)
+	wg := sync.WaitGroup{}
+	for i := 0; i < br.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				err := br.send(ctx, l, j.chatId, msg)
+				if err != nil && ctx.Err() != nil {
+					// The broadcast was stopped; this recipient will be retried when resuming.
+					continue
+				}
+				t.record(j.index, j.chatId, err)
+			}
+		}()
+	}
+
+	var runErr error
+	idx := progress.Offset
+loop:
+	for ; ; idx++ {
+		chatId, err := recipients.Next(ctx)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				runErr = fmt.Errorf("failed to get next recipient: %w", err)
+			}
+			break
+		}
+		if t.isCompleted(idx) {
+			continue
+		}
+
+		select {
+		case jobs <- job{index: idx, chatId: chatId}:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if runErr == nil {
+		runErr = ctx.Err()
+	}
+	report, err := t.finish(runErr == nil)
+	if runErr != nil {
+		return report, runErr
+	}
+	return report, err
+}
+
+// send sends a message to a recipient, retrying flood waits and server errors.
+func (br *Broadcaster) send(ctx context.Context, l *limiter, chatId int64, msg Message) error {
+	for attempt := 0; ; attempt++ {
+		if err := l.wait(ctx); err != nil {
+			return err
+		}
+
+		err := msg.Send(ctx, br.Bot, chatId)
+		if err == nil || attempt >= br.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		var tgErr *gotgbot.TelegramError
+		if errors.As(err, &tgErr) {
+			if tgErr.Code == http.StatusTooManyRequests {
+				// Flood wait; pause all sending for the requested time.
+				var retryAfter time.Duration
+				if tgErr.ResponseParams != nil {
+					retryAfter = time.Duration(tgErr.ResponseParams.RetryAfter) * time.Second
+				}
+				l.pause(retryAfter)
+				continue
+			}
+			if tgErr.Code < http.StatusInternalServerError {
+				return err
+			}
+		}
+
+		// Network or server error; back off before retrying.
+		timer := time.NewTimer(time.Duration(attempt+1) * time.Second)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+type job struct {
+	index  int64
+	chatId int64
+}
+
+// tracker keeps track of the progress of a running broadcast.
+type tracker struct {
+	br       *Broadcaster
+	id       string
+	progress Progress
+	// completed contains the indexes of the processed recipients after progress.Offset.
+	completed map[int64]bool
+	unsaved   int64
+	// saveErr is the first error returned when saving progress.
+	saveErr error
+	lock    sync.Mutex
+}
+
+func newTracker(br *Broadcaster, id string, progress Progress) *tracker {
+	t := &tracker{
+		br:        br,
+		id:        id,
+		progress:  progress,
+		completed: map[int64]bool{},
+	}
+	for _, idx := range progress.Completed {
+		t.completed[idx] = true
+	}
+	if t.progress.Report.Failures == nil {
+		t.progress.Report.Failures = map[FailureReason]int64{}
+	}
+	return t
+}
+
+func (t *tracker) isCompleted(idx int64) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.completed[idx]
+}
+
+func (t *tracker) record(idx int64, chatId int64, err error) {
+	res := Result{ChatId: chatId, Err: err}
+
+	t.lock.Lock()
+	r := &t.progress.Report
+	r.Total++
+	if err == nil {
+		r.Sent++
+	} else {
+		res.Reason = Classify(err)
+		r.Failed++
+		r.Failures[res.Reason]++
+	}
+
+	t.completed[idx] = true
+	for t.completed[t.progress.Offset] {
+		delete(t.completed, t.progress.Offset)
+		t.progress.Offset++
+	}
+
+	t.unsaved++
+	if t.unsaved >= t.br.SaveInterval {
+		t.save()
+	}
+	t.lock.Unlock()
+
+	if t.br.OnResult != nil {
+		t.br.OnResult(res)
+	}
+}
+
+// finish saves the final progress, and returns the report.
+func (t *tracker) finish(finished bool) (*Report, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if finished {
+		t.progress.Report.Finished = time.Now()
+	}
+	t.save()
+
+	report := t.snapshot().Report
+	return &report, t.saveErr
+}
+
+// save saves the current progress; the lock must be held.
+func (t *tracker) save() {
+	t.unsaved = 0
+	if err := t.br.Store.Set(t.id, t.snapshot()); err != nil && t.saveErr == nil {
+		t.saveErr = fmt.Errorf("failed to save broadcast progress: %w", err)
+	}
+}
+
+// snapshot returns a copy of the current progress; the lock must be held.
+func (t *tracker) snapshot() Progress {
+	p := t.progress
+	p.Completed = make([]int64, 0, len(t.completed))
+	for idx := range t.completed {
+		p.Completed = append(p.Completed, idx)
+	}
+	sort.Slice(p.Completed, func(i, j int) bool {
+		return p.Completed[i] < p.Completed[j]
+	})
+
+	p.Report.Failures = make(map[FailureReason]int64, len(t.progress.Report.Failures))
+	for k, v := range t.progress.Report.Failures {
+		p.Report.Failures[k] = v
+	}
+	return p
+}
+
+// limiter paces messages, to stay within the rate limits.
+type limiter struct {
+	interval time.Duration
+	// next is the earliest time at which the next message can be sent.
+	next time.Time
+	lock sync.Mutex
+}
+
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next message can be sent.
+func (l *limiter) wait(ctx context.Context) error {
+	l.lock.Lock()
+	now := time.Now()
+	t := l.next
+	if t.Before(now) {
+		t = now
+	}
+	l.next = t.Add(l.interval)
+	l.lock.Unlock()
+
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause stops all messages from being sent for the given duration.
+func (l *limiter) pause(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
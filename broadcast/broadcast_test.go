@@ -0,0 +1,253 @@
+package broadcast_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/broadcast"
+	"github.com/PaulSonOfLars/gotgbot/v2/internal/apitest"
+)
+
+// testServer replies to each chat ID with the given error responses, in order; chats without errors succeed.
+type testServer struct {
+	errors map[string][]string
+
+	lock  sync.Mutex
+	calls map[string]int
+	// sent contains the chat IDs which were successfully sent to, and the requests sent to them.
+	sent map[string]apitest.Request
+}
+
+func newTestBot(t *testing.T, errs map[string][]string) (*gotgbot.Bot, *testServer) {
+	ts := &testServer{errors: errs, calls: map[string]int{}, sent: map[string]apitest.Request{}}
+	server := apitest.NewServer(t, &apitest.ServerOpts{Reply: ts.reply})
+
+	return &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL}},
+	}, ts
+}
+
+func (ts *testServer) reply(req apitest.Request) string {
+	chatId := req.Params["chat_id"]
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	call := ts.calls[chatId]
+	ts.calls[chatId]++
+	if call < len(ts.errors[chatId]) {
+		return ts.errors[chatId][call]
+	}
+	ts.sent[chatId] = req
+	return `{"ok": true, "result": {"message_id": 1, "photo": [{"file_id": "small"}, {"file_id": "large"}]}}`
+}
+
+func (ts *testServer) sentTo() []string {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	var chatIds []string
+	for chatId := range ts.sent {
+		chatIds = append(chatIds, chatId)
+	}
+	sort.Strings(chatIds)
+	return chatIds
+}
+
+func TestBroadcast(t *testing.T) {
+	b, ts := newTestBot(t, map[string][]string{
+		"2": {`{"ok": false, "error_code": 403, "description": "Forbidden: bot was blocked by the user"}`},
+		"3": {`{"ok": false, "error_code": 403, "description": "Forbidden: user is deactivated"}`},
+		"4": {`{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`},
+		"5": {
+			`{"ok": false, "error_code": 500, "description": "Internal Server Error"}`,
+			`{"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 0", "parameters": {"retry_after": 0}}`,
+		},
+		"6": {`{"ok": false, "error_code": 400, "description": "Bad Request: message text is empty"}`},
+	})
+
+	var lock sync.Mutex
+	results := map[int64]broadcast.FailureReason{}
+	br := broadcast.New(b, &broadcast.Opts{
+		Rate: 1000,
+		OnResult: func(res broadcast.Result) {
+			lock.Lock()
+			defer lock.Unlock()
+			results[res.ChatId] = res.Reason
+		},
+	})
+
+	report, err := br.Run(context.Background(), "test", broadcast.Slice([]int64{1, 2, 3, 4, 5, 6, 7}), broadcast.Text("hello", nil))
+	if err != nil {
+		t.Fatalf("failed to run broadcast: %s", err.Error())
+	}
+
+	if report.Total != 7 || report.Sent != 3 || report.Failed != 4 || report.Finished.IsZero() {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	expectedFailures := map[broadcast.FailureReason]int64{
+		broadcast.FailureBlocked:      1,
+		broadcast.FailureDeactivated:  1,
+		broadcast.FailureChatNotFound: 1,
+		broadcast.FailureOther:        1,
+	}
+	if !reflect.DeepEqual(report.Failures, expectedFailures) {
+		t.Errorf("expected failures %v, got %v", expectedFailures, report.Failures)
+	}
+	if results[2] != broadcast.FailureBlocked || results[5] != "" || len(results) != 7 {
+		t.Errorf("unexpected results: %v", results)
+	}
+	if sent := ts.sentTo(); !reflect.DeepEqual(sent, []string{"1", "5", "7"}) {
+		t.Errorf("expected messages to be sent to 1, 5 and 7, got %v", sent)
+	}
+}
+
+func TestBroadcastResume(t *testing.T) {
+	b, ts := newTestBot(t, nil)
+
+	store := broadcast.NewFileStore(t.TempDir())
+	// Recipients 0-2 and 4 were processed by a previous run.
+	err := store.Set("test", broadcast.Progress{
+		Offset:    3,
+		Completed: []int64{4},
+		Report:    broadcast.Report{Total: 4, Sent: 4},
+	})
+	if err != nil {
+		t.Fatalf("failed to set progress: %s", err.Error())
+	}
+
+	br := broadcast.New(b, &broadcast.Opts{Store: store, Rate: 1000, SaveInterval: 1})
+	report, err := br.Run(context.Background(), "test", broadcast.Slice([]int64{10, 11, 12, 13, 14, 15}), broadcast.Text("hello", nil))
+	if err != nil {
+		t.Fatalf("failed to run broadcast: %s", err.Error())
+	}
+
+	if sent := ts.sentTo(); !reflect.DeepEqual(sent, []string{"13", "15"}) {
+		t.Errorf("expected only unprocessed recipients to be sent to, got %v", sent)
+	}
+	if report.Total != 6 || report.Sent != 6 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	progress, err := store.Get("test")
+	if err != nil {
+		t.Fatalf("failed to get progress: %s", err.Error())
+	}
+	if progress.Offset != 6 || len(progress.Completed) != 0 || progress.Report.Finished.IsZero() {
+		t.Errorf("unexpected saved progress: %+v", progress)
+	}
+}
+
+func TestBroadcastCancel(t *testing.T) {
+	b, ts := newTestBot(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store := broadcast.NewInMemoryStore()
+	br := broadcast.New(b, &broadcast.Opts{Store: store, Rate: 1000, Concurrency: 1})
+
+	msg := broadcast.MessageFunc(func(ctx context.Context, b *gotgbot.Bot, chatId int64) error {
+		if chatId == 3 {
+			cancel()
+			return ctx.Err()
+		}
+		_, err := b.SendMessageWithContext(ctx, chatId, "hello", nil)
+		return err
+	})
+	recipients := []int64{1, 2, 3, 4}
+	if _, err := br.Run(ctx, "test", broadcast.Slice(recipients), msg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected broadcast to be cancelled, got %v", err)
+	}
+
+	report, err := br.Run(context.Background(), "test", broadcast.Slice(recipients), broadcast.Text("hello", nil))
+	if err != nil {
+		t.Fatalf("failed to resume broadcast: %s", err.Error())
+	}
+	if report.Total != 4 || report.Sent != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	for _, chatId := range recipients {
+		if calls := ts.calls[strconv.FormatInt(chatId, 10)]; calls != 1 {
+			t.Errorf("expected chat %d to be sent to once, got %d", chatId, calls)
+		}
+	}
+}
+
+func TestBroadcastMedia(t *testing.T) {
+	b, ts := newTestBot(t, nil)
+
+	br := broadcast.New(b, &broadcast.Opts{Rate: 1000})
+	media := broadcast.Media(gotgbot.InputMediaPhoto{
+		Media:   gotgbot.InputFileByBytes("photo.jpg", []byte("photo")),
+		Caption: "caption",
+	}, nil)
+
+	if _, err := br.Run(context.Background(), "test", broadcast.Slice([]int64{1, 2, 3}), media); err != nil {
+		t.Fatalf("failed to run broadcast: %s", err.Error())
+	}
+
+	var uploads int
+	for chatId, req := range ts.sent {
+		if req.Params["caption"] != "caption" {
+			t.Errorf("expected caption for chat %s, got %q", chatId, req.Params["caption"])
+		}
+		if f, ok := req.Files["photo"]; ok && f.Contents == "photo" {
+			uploads++
+		} else if req.Params["photo"] != "large" {
+			t.Errorf("expected largest file ID for chat %s, got %q", chatId, req.Params["photo"])
+		}
+	}
+	if uploads != 1 || len(ts.sent) != 3 {
+		t.Errorf("expected exactly one upload to 3 chats, got %d uploads to %d chats", uploads, len(ts.sent))
+	}
+}
+
+func TestBroadcastMediaReader(t *testing.T) {
+	b, ts := newTestBot(t, map[string][]string{
+		// The first upload fails, so the file must be uploaded again to the next recipient.
+		"1": {`{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`},
+	})
+
+	br := broadcast.New(b, &broadcast.Opts{Rate: 1000, Concurrency: 1})
+	media := broadcast.Media(gotgbot.InputMediaDocument{
+		Media:     gotgbot.InputFileByReader("doc.txt", strings.NewReader("document")),
+		Thumbnail: gotgbot.InputFileByReader("thumb.jpg", strings.NewReader("thumbnail")),
+	}, nil)
+
+	report, err := br.Run(context.Background(), "test", broadcast.Slice([]int64{1, 2, 3}), media)
+	if err != nil {
+		t.Fatalf("failed to run broadcast: %s", err.Error())
+	}
+	if report.Sent != 2 || report.Failed != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if files := ts.sent["2"].Files; files["document"].Contents != "document" || files["thumbnail"].Contents != "thumbnail" {
+		t.Errorf("expected full files to be uploaded after a failed upload, got %+v", files)
+	}
+}
+
+func TestFileStoreIDs(t *testing.T) {
+	store := broadcast.NewFileStore(t.TempDir())
+	for idx, id := range []string{"a/x", "b/x", "../x"} {
+		if err := store.Set(id, broadcast.Progress{Offset: int64(idx)}); err != nil {
+			t.Fatalf("failed to set progress for %q: %s", id, err.Error())
+		}
+	}
+
+	for idx, id := range []string{"a/x", "b/x", "../x"} {
+		p, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("failed to get progress for %q: %s", id, err.Error())
+		}
+		if p.Offset != int64(idx) {
+			t.Errorf("expected offset %d for %q, got %d", idx, id, p.Offset)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+var ErrUnknownMediaType = errors.New("unknown media type")
+
+// Message sends the broadcast message to a single chat.
+type Message interface {
+	Send(ctx context.Context, b *gotgbot.Bot, chatId int64) error
+}
+
+// MessageFunc allows for using a function as a Message; eg to personalise the message for each recipient.
+type MessageFunc func(ctx context.Context, b *gotgbot.Bot, chatId int64) error
+
+func (f MessageFunc) Send(ctx context.Context, b *gotgbot.Bot, chatId int64) error {
+	return f(ctx, b, chatId)
+}
+
+// Text broadcasts a text message.
+func Text(text string, opts *gotgbot.SendMessageOpts) Message {
+	return MessageFunc(func(ctx context.Context, b *gotgbot.Bot, chatId int64) error {
+		_, err := b.SendMessageWithContext(ctx, chatId, text, opts)
+		return err
+	})
+}
+
+// Copy broadcasts a copy of an existing message, using Bot.CopyMessage. This is the simplest way to broadcast any
+// kind of message, such as one prepared in an admin chat.
+func Copy(fromChatId int64, messageId int64, opts *gotgbot.CopyMessageOpts) Message {
+	return MessageFunc(func(ctx context.Context, b *gotgbot.Bot, chatId int64) error {
+		_, err := b.CopyMessageWithContext(ctx, chatId, fromChatId, messageId, opts)
+		return err
+	})
+}
+
+// MediaOpts is the set of optional fields for the Media function.
+type MediaOpts struct {
+	DisableNotification bool
+	ProtectContent      bool
+	AllowPaidBroadcast  bool
+	ReplyMarkup         gotgbot.ReplyMarkup
+	RequestOpts         *gotgbot.RequestOpts
+}
+
+// mediaMessage sends a single media item; files are uploaded to the first recipient, and the resulting file ID is
+// reused for all other recipients.
+type mediaMessage struct {
+	media gotgbot.MergedInputMedia
+	opts  MediaOpts
+
+	// lock is held while the file is first being sent, so that it is only uploaded once.
+	lock   sync.Mutex
+	fileId string
+	// buffered is true once any one-shot readers in media have been read into memory.
+	buffered bool
+}
+
+// Media broadcasts a photo, video, animation, audio or document, with the caption and settings of the given
+// InputMedia. Uploaded files are only uploaded once; all other recipients receive the resulting file ID.
+// Files are uploaded again until one of the uploads succeeds, so one-shot readers (eg from gotgbot.InputFileByReader)
+// are read into memory; prefer gotgbot.InputFileByPath or gotgbot.InputFileByBytes for large files.
+func Media(media gotgbot.InputMedia, opts *MediaOpts) Message {
+	m := &mediaMessage{media: media.MergeInputMedia()}
+	if opts != nil {
+		m.opts = *opts
+	}
+	return m
+}
+
+func (m *mediaMessage) Send(ctx context.Context, b *gotgbot.Bot, chatId int64) error {
+	m.lock.Lock()
+	if m.fileId != "" {
+		media := m.media
+		media.Media = gotgbot.InputFileByID(m.fileId)
+		media.Thumbnail = nil
+		m.lock.Unlock()
+
+		_, err := m.send(ctx, b, chatId, media)
+		return err
+	}
+
+	// The file hasn't been sent yet; keep the lock, so that no other recipient uploads it too.
+	defer m.lock.Unlock()
+	if !m.buffered {
+		// If this upload fails, the next recipient uploads the files again; so they must be readable more than once.
+		if fr, ok := m.media.Media.(*gotgbot.FileReader); ok {
+			buffered, err := reopenable(fr)
+			if err != nil {
+				return fmt.Errorf("failed to read media: %w", err)
+			}
+			m.media.Media = buffered
+		}
+		if fr, ok := m.media.Thumbnail.(*gotgbot.FileReader); ok {
+			buffered, err := reopenable(fr)
+			if err != nil {
+				return fmt.Errorf("failed to read thumbnail: %w", err)
+			}
+			m.media.Thumbnail = buffered
+		}
+		m.buffered = true
+	}
+
+	msg, err := m.send(ctx, b, chatId, m.media)
+	if err != nil {
+		return err
+	}
+	m.fileId = mediaFileID(msg)
+	return nil
+}
+
+func (m *mediaMessage) send(ctx context.Context, b *gotgbot.Bot, chatId int64, media gotgbot.MergedInputMedia) (*gotgbot.Message, error) {
+	switch media.Type {
+	case "photo":
+		return b.SendPhotoWithContext(ctx, chatId, media.Media, &gotgbot.SendPhotoOpts{
+			Caption:               media.Caption,
+			ParseMode:             media.ParseMode,
+			CaptionEntities:       media.CaptionEntities,
+			ShowCaptionAboveMedia: media.ShowCaptionAboveMedia,
+			HasSpoiler:            media.HasSpoiler,
+			DisableNotification:   m.opts.DisableNotification,
+			ProtectContent:        m.opts.ProtectContent,
+			AllowPaidBroadcast:    m.opts.AllowPaidBroadcast,
+			ReplyMarkup:           m.opts.ReplyMarkup,
+			RequestOpts:           m.opts.RequestOpts,
+		})
+	case "video":
+		return b.SendVideoWithContext(ctx, chatId, media.Media, &gotgbot.SendVideoOpts{
+			Duration:              media.Duration,
+			Width:                 media.Width,
+			Height:                media.Height,
+			Thumbnail:             media.Thumbnail,
+			Caption:               media.Caption,
+			ParseMode:             media.ParseMode,
+			CaptionEntities:       media.CaptionEntities,
+			ShowCaptionAboveMedia: media.ShowCaptionAboveMedia,
+			HasSpoiler:            media.HasSpoiler,
+			SupportsStreaming:     media.SupportsStreaming,
+			DisableNotification:   m.opts.DisableNotification,
+			ProtectContent:        m.opts.ProtectContent,
+			AllowPaidBroadcast:    m.opts.AllowPaidBroadcast,
+			ReplyMarkup:           m.opts.ReplyMarkup,
+			RequestOpts:           m.opts.RequestOpts,
+		})
+	case "animation":
+		return b.SendAnimationWithContext(ctx, chatId, media.Media, &gotgbot.SendAnimationOpts{
+			Duration:              media.Duration,
+			Width:                 media.Width,
+			Height:                media.Height,
+			Thumbnail:             media.Thumbnail,
+			Caption:               media.Caption,
+			ParseMode:             media.ParseMode,
+			CaptionEntities:       media.CaptionEntities,
+			ShowCaptionAboveMedia: media.ShowCaptionAboveMedia,
+			HasSpoiler:            media.HasSpoiler,
+			DisableNotification:   m.opts.DisableNotification,
+			ProtectContent:        m.opts.ProtectContent,
+			AllowPaidBroadcast:    m.opts.AllowPaidBroadcast,
+			ReplyMarkup:           m.opts.ReplyMarkup,
+			RequestOpts:           m.opts.RequestOpts,
+		})
+	case "audio":
+		return b.SendAudioWithContext(ctx, chatId, media.Media, &gotgbot.SendAudioOpts{
+			Caption:             media.Caption,
+			ParseMode:           media.ParseMode,
+			CaptionEntities:     media.CaptionEntities,
+			Duration:            media.Duration,
+			Performer:           media.Performer,
+			Title:               media.Title,
+			Thumbnail:           media.Thumbnail,
+			DisableNotification: m.opts.DisableNotification,
+			ProtectContent:      m.opts.ProtectContent,
+			AllowPaidBroadcast:  m.opts.AllowPaidBroadcast,
+			ReplyMarkup:         m.opts.ReplyMarkup,
+			RequestOpts:         m.opts.RequestOpts,
+		})
+	case "document":
+		return b.SendDocumentWithContext(ctx, chatId, media.Media, &gotgbot.SendDocumentOpts{
+			Thumbnail:                   media.Thumbnail,
+			Caption:                     media.Caption,
+			ParseMode:                   media.ParseMode,
+			CaptionEntities:             media.CaptionEntities,
+			DisableContentTypeDetection: media.DisableContentTypeDetection,
+			DisableNotification:         m.opts.DisableNotification,
+			ProtectContent:              m.opts.ProtectContent,
+			AllowPaidBroadcast:          m.opts.AllowPaidBroadcast,
+			ReplyMarkup:                 m.opts.ReplyMarkup,
+			RequestOpts:                 m.opts.RequestOpts,
+		})
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMediaType, media.Type)
+	}
+}
+
+// reopenable returns a file which can be sent multiple times. One-shot readers are read into memory; all other files are
+// returned as-is.
+func reopenable(fr *gotgbot.FileReader) (*gotgbot.FileReader, error) {
+	if fr.Open != nil || fr.Data == nil {
+		return fr, nil
+	}
+
+	bs, err := io.ReadAll(fr.Data)
+	if err != nil {
+		return nil, err
+	}
+	buffered := *fr
+	buffered.Data = nil
+	buffered.Open = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(bs)), nil
+	}
+	buffered.Size = int64(len(bs))
+	return &buffered, nil
+}
+
+// mediaFileID returns the file ID of the media in a sent message.
+func mediaFileID(msg *gotgbot.Message) string {
+	switch {
+	case len(msg.Photo) > 0:
+		return msg.Photo[len(msg.Photo)-1].FileId
+	case msg.Video != nil:
+		return msg.Video.FileId
+	case msg.Animation != nil:
+		return msg.Animation.FileId
+	case msg.Audio != nil:
+		return msg.Audio.FileId
+	case msg.Document != nil:
+		return msg.Document.FileId
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,118 @@
+package broadcast
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrProgressNotFound = errors.New("broadcast progress not found")
+
+// Progress is the saved state of a broadcast, allowing for it to be resumed.
+// Note: Make sure to store the entire Progress struct; future changes may add new fields.
+type Progress struct {
+	// Offset is the number of recipients, in iteration order, which have all been processed.
+	Offset int64 `json:"offset"`
+	// Completed contains the indexes of any recipients after the Offset which have also been processed.
+	Completed []int64 `json:"completed,omitempty"`
+	// Report contains the results so far.
+	Report Report `json:"report"`
+}
+
+// Store allows you to define custom backends for persisting the progress of broadcasts.
+type Store interface {
+	// Get returns the progress of the broadcast with the given ID.
+	// If the broadcast has no saved progress, this method should return the ErrProgressNotFound error.
+	Get(id string) (*Progress, error)
+	// Set saves the progress of the broadcast with the given ID.
+	Set(id string, progress Progress) error
+}
+
+// InMemoryStore is a thread-safe in-memory implementation of the Store interface.
+type InMemoryStore struct {
+	progress map[string]Progress
+	lock     sync.RWMutex
+}
+
+var _ Store = &InMemoryStore{}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		progress: map[string]Progress{},
+	}
+}
+
+func (s *InMemoryStore) Get(id string) (*Progress, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	p, ok := s.progress[id]
+	if !ok {
+		return nil, ErrProgressNotFound
+	}
+	return &p, nil
+}
+
+func (s *InMemoryStore) Set(id string, progress Progress) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.progress[id] = progress
+	return nil
+}
+
+// FileStore is an implementation of the Store interface which saves progress as JSON files in a directory, so
+// that broadcasts can be resumed after a restart.
+type FileStore struct {
+	// Dir is the directory in which to store progress files.
+	Dir string
+}
+
+var _ Store = FileStore{}
+
+func NewFileStore(dir string) FileStore {
+	return FileStore{Dir: dir}
+}
+
+// path returns the path of the progress file for a broadcast. IDs are hex encoded, so that any ID maps to a distinct,
+// valid file name.
+func (s FileStore) path(id string) string {
+	return filepath.Join(s.Dir, hex.EncodeToString([]byte(id))+".json")
+}
+
+func (s FileStore) Get(id string) (*Progress, error) {
+	bs, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrProgressNotFound
+		}
+		return nil, fmt.Errorf("failed to read progress file: %w", err)
+	}
+
+	var p Progress
+	if err = json.Unmarshal(bs, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode progress file: %w", err)
+	}
+	return &p, nil
+}
+
+func (s FileStore) Set(id string, progress Progress) error {
+	bs, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to encode progress: %w", err)
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a partially written progress file.
+	tmp := s.path(id) + ".tmp"
+	if err = os.WriteFile(tmp, bs, 0o600); err != nil {
+		return fmt.Errorf("failed to write progress file: %w", err)
+	}
+	if err = os.Rename(tmp, s.path(id)); err != nil {
+		return fmt.Errorf("failed to replace progress file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package gotgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+var (
+	ErrFileTooLarge        = errors.New("file is larger than the maximum download size")
+	ErrFileSizeMismatch    = errors.New("downloaded file size does not match the expected file size")
+	ErrNoFilePath          = errors.New("file has no file path")
+	ErrFileDownloadFailed  = errors.New("file download failed")
+	ErrInvalidRangeRequest = errors.New("server returned an invalid range")
+)
+
+// FileDownloader is an optional extension of the BotClient interface, used by Bot.DownloadFile to open files.
+// BotClient implementations, and any middlewares wrapping them, should implement it to customise how files are
+// downloaded; BotClients which do not implement it fall back to a plain HTTP GET on the BotClient's FileURL.
+type FileDownloader interface {
+	// DownloadFileWithContext opens a file from the bot API instance, starting at the given byte offset.
+	// The caller is responsible for closing the returned reader.
+	DownloadFileWithContext(ctx context.Context, token string, tgFilePath string, offset int64, opts *RequestOpts) (io.ReadCloser, error)
+}
+
+var _ FileDownloader = &BaseBotClient{}
+
+// DownloadFileOpts is the set of optional fields for Bot.DownloadFile and Bot.DownloadFileToPath.
+type DownloadFileOpts struct {
+	// MaxSize is the maximum number of bytes to download; larger files return ErrFileTooLarge.
+	// If 0, no limit is enforced.
+	MaxSize int64
+	// Offset is the byte offset to start downloading from, to resume an incomplete download.
+	// Bot.DownloadFileToPath ignores this, and resumes from the size of the existing file when Resume is set.
+	Offset int64
+	// Resume continues downloading to the end of an existing file, rather than overwriting it.
+	// Only used by Bot.DownloadFileToPath.
+	Resume bool
+	// RequestOpts are the request opts used to call GetFile (if needed), and to download the file.
+	// Note that unlike other requests, downloads have no timeout unless one is set here or in the BotClient defaults.
+	RequestOpts *RequestOpts
+}
+
+// DownloadFile streams the contents of a file to the given writer, returning the number of bytes written.
+// If the file has no FilePath, Bot.GetFile is called first to obtain it.
+//
+// If the file's FileSize is known, it is checked against opts.MaxSize before downloading, and the downloaded size
+// is verified against it afterwards.
+func (bot *Bot) DownloadFile(file File, w io.Writer, opts *DownloadFileOpts) (int64, error) {
+	return bot.DownloadFileWithContext(context.Background(), file, w, opts)
+}
+
+// DownloadFileWithContext is the same as Bot.DownloadFile, but with a context.Context parameter.
+func (bot *Bot) DownloadFileWithContext(ctx context.Context, file File, w io.Writer, opts *DownloadFileOpts) (int64, error) {
+	if bot.BotClient == nil {
+		return 0, ErrNilBotClient
+	}
+	if opts == nil {
+		opts = &DownloadFileOpts{}
+	}
+
+	if file.FilePath == "" {
+		if file.FileId == "" {
+			return 0, ErrNoFilePath
+		}
+		f, err := bot.GetFileWithContext(ctx, file.FileId, &GetFileOpts{RequestOpts: opts.RequestOpts})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get file path: %w", err)
+		}
+		file = *f
+		if file.FilePath == "" {
+			return 0, ErrNoFilePath
+		}
+	}
+
+	if opts.MaxSize > 0 && file.FileSize > opts.MaxSize {
+		return 0, fmt.Errorf("%w: %d bytes, limit is %d", ErrFileTooLarge, file.FileSize, opts.MaxSize)
+	}
+	if file.FileSize > 0 && opts.Offset >= file.FileSize {
+		if opts.Offset > file.FileSize {
+			return 0, fmt.Errorf("%w: offset %d is past the end of the file (%d bytes)", ErrFileSizeMismatch, opts.Offset, file.FileSize)
+		}
+		// Nothing left to download.
+		return 0, nil
+	}
+
+	r, err := OpenFile(ctx, bot.BotClient, bot.Token, file.FilePath, opts.Offset, opts.RequestOpts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file %s: %w", file.FilePath, err)
+	}
+	defer r.Close()
+
+	src := io.Reader(r)
+	if opts.MaxSize > 0 {
+		// Read one byte more than allowed, to detect oversized files with no known size.
+		src = io.LimitReader(r, opts.MaxSize-opts.Offset+1)
+	}
+
+	n, err := io.Copy(w, src)
+	if err != nil {
+		return n, fmt.Errorf("failed to download file %s: %w", file.FilePath, err)
+	}
+	if opts.MaxSize > 0 && opts.Offset+n > opts.MaxSize {
+		return n, fmt.Errorf("%w: limit is %d bytes", ErrFileTooLarge, opts.MaxSize)
+	}
+	if file.FileSize > 0 && opts.Offset+n != file.FileSize {
+		return n, fmt.Errorf("%w: expected %d bytes, got %d", ErrFileSizeMismatch, file.FileSize, opts.Offset+n)
+	}
+	return n, nil
+}
+
+// DownloadFileToPath downloads a file to the given path on disk, returning the number of bytes written.
+// If opts.Resume is set and the path already exists, the download continues from the end of the existing file.
+// See Bot.DownloadFile for more details.
+func (bot *Bot) DownloadFileToPath(file File, path string, opts *DownloadFileOpts) (int64, error) {
+	return bot.DownloadFileToPathWithContext(context.Background(), file, path, opts)
+}
+
+// DownloadFileToPathWithContext is the same as Bot.DownloadFileToPath, but with a context.Context parameter.
+func (bot *Bot) DownloadFileToPathWithContext(ctx context.Context, file File, path string, opts *DownloadFileOpts) (int64, error) {
+	var fileOpts DownloadFileOpts
+	if opts != nil {
+		fileOpts = *opts
+	}
+	fileOpts.Offset = 0
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if fileOpts.Resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	if fileOpts.Resume {
+		stat, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return 0, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		fileOpts.Offset = stat.Size()
+	}
+
+	n, err := bot.DownloadFileWithContext(ctx, file, f, &fileOpts)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		return n, fmt.Errorf("failed to close %s: %w", path, closeErr)
+	}
+	return n, err
+}
+
+// Download is a helper function to easily call Bot.DownloadFile for a file.
+func (f File) Download(b *Bot, w io.Writer, opts *DownloadFileOpts) (int64, error) {
+	return b.DownloadFile(f, w, opts)
+}
+
+// DownloadToPath is a helper function to easily call Bot.DownloadFileToPath for a file.
+func (f File) DownloadToPath(b *Bot, path string, opts *DownloadFileOpts) (int64, error) {
+	return b.DownloadFileToPath(f, path, opts)
+}
+
+// DownloadFileWithContext opens a file from the bot API instance, starting at the given byte offset.
+// In local server mode, absolute file paths are read directly from disk; see LocalFilePath.
+func (bot *BaseBotClient) DownloadFileWithContext(ctx context.Context, token string, tgFilePath string, offset int64, opts *RequestOpts) (io.ReadCloser, error) {
+	if path, ok := bot.LocalFilePath(tgFilePath); ok {
+		return openLocalFile(path, offset)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Downloads can take a long time, so the default timeout is not applied; only explicitly set timeouts are.
+	reqCtx, cancel := timeoutFromOpts(ctx, opts)
+	if reqCtx == nil {
+		reqCtx, cancel = timeoutFromOpts(ctx, bot.DefaultRequestOpts)
+	}
+	if reqCtx == nil {
+		reqCtx, cancel = context.WithCancel(ctx)
+	}
+
+	r, err := httpDownload(reqCtx, &bot.Client, bot.FileURL(token, tgFilePath, opts), offset)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelReadCloser{ReadCloser: r, cancel: cancel}, nil
+}
+
+// OpenFile opens a file through the given BotClient, if it implements FileDownloader; otherwise, it is downloaded
+// from the BotClient's FileURL.
+// BotClient middlewares can use this to implement FileDownloader, such that they don't change how files are downloaded.
+func OpenFile(ctx context.Context, client BotClient, token string, tgFilePath string, offset int64, opts *RequestOpts) (io.ReadCloser, error) {
+	if d, ok := client.(FileDownloader); ok {
+		return d.DownloadFileWithContext(ctx, token, tgFilePath, offset, opts)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return httpDownload(ctx, http.DefaultClient, client.FileURL(token, tgFilePath, opts), offset)
+}
+
+// openLocalFile opens a file on disk, starting at the given offset.
+func openLocalFile(path string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local file: %w", err)
+	}
+	if offset > 0 {
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to seek local file: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// httpDownload sends a GET request for the given URL, using a Range request to start from the given offset.
+func httpDownload(ctx context.Context, client *http.Client, url string, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GET request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GET request: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			// The server ignored the range; skip the bytes we already have.
+			if _, err = io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				_ = resp.Body.Close()
+				return nil, fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+			}
+		}
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		var start int64
+		if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("%w: expected offset %d, got %q", ErrInvalidRangeRequest, offset, resp.Header.Get("Content-Range"))
+		}
+	default:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrFileDownloadFailed, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// cancelReadCloser cancels the context of a request once its body has been closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
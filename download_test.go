@@ -0,0 +1,211 @@
+package gotgbot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/internal/apitest"
+)
+
+const testFileContents = "some file contents"
+
+func newDownloadTestBot(t *testing.T, ignoreRanges bool) *Bot {
+	server := apitest.NewServer(t, &apitest.ServerOpts{
+		Reply: func(req apitest.Request) string {
+			return `{"ok": true, "result": {"file_id": "id", "file_size": 18, "file_path": "documents/file.txt"}}`
+		},
+		Files:        map[string]string{"documents/file.txt": testFileContents},
+		IgnoreRanges: ignoreRanges,
+	})
+
+	return &Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &BaseBotClient{DefaultRequestOpts: &RequestOpts{APIURL: server.URL}},
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	for name, test := range map[string]struct {
+		file         File
+		opts         *DownloadFileOpts
+		ignoreRanges bool
+		expected     string
+		err          error
+	}{
+		"download": {
+			file:     File{FileSize: 18, FilePath: "documents/file.txt"},
+			expected: testFileContents,
+		},
+		"get file path": {
+			file:     File{FileId: "id"},
+			expected: testFileContents,
+		},
+		"resume": {
+			file:     File{FileSize: 18, FilePath: "documents/file.txt"},
+			opts:     &DownloadFileOpts{Offset: 5},
+			expected: "file contents",
+		},
+		"resume without range support": {
+			file:         File{FileSize: 18, FilePath: "documents/file.txt"},
+			opts:         &DownloadFileOpts{Offset: 5},
+			ignoreRanges: true,
+			expected:     "file contents",
+		},
+		"known size too large": {
+			file: File{FileSize: 18, FilePath: "documents/file.txt"},
+			opts: &DownloadFileOpts{MaxSize: 10},
+			err:  ErrFileTooLarge,
+		},
+		"unknown size too large": {
+			file:     File{FilePath: "documents/file.txt"},
+			opts:     &DownloadFileOpts{MaxSize: 10},
+			expected: testFileContents[:11],
+			err:      ErrFileTooLarge,
+		},
+		"size mismatch": {
+			file:     File{FileSize: 20, FilePath: "documents/file.txt"},
+			expected: testFileContents,
+			err:      ErrFileSizeMismatch,
+		},
+		"missing file": {
+			file: File{FilePath: "documents/missing.txt"},
+			err:  ErrFileDownloadFailed,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			b := newDownloadTestBot(t, test.ignoreRanges)
+
+			buf := bytes.Buffer{}
+			n, err := test.file.Download(b, &buf, test.opts)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if buf.String() != test.expected || n != int64(len(test.expected)) {
+				t.Errorf("expected %q, got %q (%d bytes)", test.expected, buf.String(), n)
+			}
+		})
+	}
+}
+
+func TestDownloadFileToPath(t *testing.T) {
+	b := newDownloadTestBot(t, false)
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("some "), 0o600); err != nil {
+		t.Fatalf("failed to write partial file: %s", err.Error())
+	}
+
+	n, err := b.DownloadFileToPath(File{FileSize: 18, FilePath: "documents/file.txt"}, path, &DownloadFileOpts{Resume: true})
+	if err != nil {
+		t.Fatalf("failed to download file: %s", err.Error())
+	}
+	if n != 13 {
+		t.Errorf("expected to download 13 bytes, got %d", n)
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %s", err.Error())
+	}
+	if string(bs) != testFileContents {
+		t.Errorf("expected %q, got %q", testFileContents, string(bs))
+	}
+}
+
+func TestDownloadLocalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte(testFileContents), 0o600); err != nil {
+		t.Fatalf("failed to write local file: %s", err.Error())
+	}
+
+	// No server is needed; local bot API servers return absolute paths, which are read from disk.
+	b := &Bot{Token: "SOME_TOKEN", BotClient: &BaseBotClient{UseLocalServer: true}}
+	buf := bytes.Buffer{}
+	if _, err := b.DownloadFile(File{FileSize: 18, FilePath: path}, &buf, &DownloadFileOpts{Offset: 5}); err != nil {
+		t.Fatalf("failed to download local file: %s", err.Error())
+	}
+	if buf.String() != "file contents" {
+		t.Errorf("expected %q, got %q", "file contents", buf.String())
+	}
+
+	// Outside of local server mode, files are never read from disk.
+	b = newDownloadTestBot(t, false)
+	buf.Reset()
+	if _, err := b.DownloadFile(File{FileSize: 18, FilePath: path}, &buf, nil); !errors.Is(err, ErrFileDownloadFailed) {
+		t.Errorf("expected download to fail, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected local file to not be read, got %q", buf.String())
+	}
+}
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	count int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.count++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// wrappingBotClient is a BotClient middleware, which only overrides requests.
+type wrappingBotClient struct {
+	BotClient
+}
+
+// downloadingBotClient is a BotClient middleware, which also passes downloads on to the wrapped client.
+type downloadingBotClient struct {
+	BotClient
+}
+
+func (c downloadingBotClient) DownloadFileWithContext(ctx context.Context, token string, tgFilePath string, offset int64, opts *RequestOpts) (io.ReadCloser, error) {
+	return OpenFile(ctx, c.BotClient, token, tgFilePath, offset, opts)
+}
+
+func TestDownloadFileWrappedClient(t *testing.T) {
+	for name, test := range map[string]struct {
+		wrap     func(BotClient) BotClient
+		requests int
+	}{
+		"implements FileDownloader": {
+			wrap: func(c BotClient) BotClient { return downloadingBotClient{BotClient: c} },
+			// Both getFile and the download go through the wrapped client's transport.
+			requests: 2,
+		},
+		"falls back to FileURL": {
+			wrap: func(c BotClient) BotClient { return wrappingBotClient{BotClient: c} },
+			// The download is a plain GET request to the FileURL, which doesn't use the wrapped client's transport.
+			requests: 1,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			b := newDownloadTestBot(t, false)
+			transport := &countingTransport{}
+			client, ok := b.BotClient.(*BaseBotClient)
+			if !ok {
+				t.Fatalf("unexpected client type %T", b.BotClient)
+			}
+			client.Client.Transport = transport
+			b.BotClient = test.wrap(client)
+
+			buf := bytes.Buffer{}
+			if _, err := b.DownloadFile(File{FileId: "id"}, &buf, &DownloadFileOpts{Offset: 5}); err != nil {
+				t.Fatalf("failed to download file: %s", err.Error())
+			}
+			if buf.String() != "file contents" {
+				t.Errorf("expected %q, got %q", "file contents", buf.String())
+			}
+			if transport.count != test.requests {
+				t.Errorf("expected %d requests through the configured transport, got %d", test.requests, transport.count)
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
@@ -25,11 +27,17 @@ type botData struct {
 	updateWriterControl *sync.WaitGroup
 	// stopUpdates allows us to close the stopUpdates loop.
 	stopUpdates chan struct{}
+	// webhookQueue counts the incoming webhook updates which are waiting to be sent to the updateChan.
+	webhookQueue *atomic.Int64
+	// lastPoll stores the time of the last successful getUpdates call, in unix nanoseconds, for polling bots.
+	lastPoll *atomic.Int64
 
 	// urlPath defines the incoming webhook URL path for this bot.
 	urlPath string
 	// webhookSecret stores the webhook secret for this bot.
 	webhookSecret string
+	// dispatcher is the bot's own UpdateDispatcher; if nil, the Updater's Dispatcher is used.
+	dispatcher UpdateDispatcher
 }
 
 // botMapping Ensures that all botData is stored in a thread-safe manner.
@@ -43,6 +51,8 @@ type botMapping struct {
 
 	// errFunc fills the same purpose as Updater.UnhandledErrFunc.
 	errFunc ErrorFunc
+	// logger fills the same purpose as Updater.Logger.
+	logger *slog.Logger
 	// errorLog fills the same purpose as Updater.ErrorLog.
 	errorLog *log.Logger
 }
@@ -51,8 +61,9 @@ var ErrBotAlreadyExists = errors.New("bot already exists in bot mapping")
 var ErrBotUrlPathAlreadyExists = errors.New("url path already exists in bot mapping")
 
 // addBot Adds a new bot to the botMapping structure.
-// Pass an empty urlPath/webhookSecret if using polling instead of webhooks.
-func (m *botMapping) addBot(b *gotgbot.Bot, urlPath string, webhookSecret string) (*botData, error) {
+// Pass an empty urlPath/webhookSecret if using polling instead of webhooks, and a nil dispatcher to use the Updater's
+// Dispatcher.
+func (m *botMapping) addBot(b *gotgbot.Bot, urlPath string, webhookSecret string, dispatcher UpdateDispatcher) (*botData, error) {
 	// Clean up the URLPath such that it remains consistent.
 	urlPath = strings.TrimPrefix(urlPath, "/")
 
@@ -79,8 +90,11 @@ func (m *botMapping) addBot(b *gotgbot.Bot, urlPath string, webhookSecret string
 		updateChan:          make(chan json.RawMessage),
 		stopUpdates:         make(chan struct{}),
 		updateWriterControl: &sync.WaitGroup{},
+		webhookQueue:        &atomic.Int64{},
+		lastPoll:            &atomic.Int64{},
 		urlPath:             urlPath,
 		webhookSecret:       webhookSecret,
+		dispatcher:          dispatcher,
 	}
 
 	m.mapping[bData.bot.Token] = bData
@@ -126,6 +140,19 @@ func (m *botMapping) getBots() []botData {
 	return bots
 }
 
+// hasDispatcher checks whether any bot was added with the given dispatcher.
+func (m *botMapping) hasDispatcher(d UpdateDispatcher) bool {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	for _, bData := range m.mapping {
+		if bData.dispatcher == d {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *botMapping) getBot(token string) (botData, bool) {
 	m.mux.RLock()
 	defer m.mux.RUnlock()
@@ -181,25 +208,28 @@ func (m *botMapping) getHandlerFunc(prefix string) func(writer http.ResponseWrit
 
 		bytes, err := io.ReadAll(r.Body)
 		if err != nil {
-			if m.errFunc != nil {
-				m.errFunc(err)
-			} else {
-				m.logf("Failed to read incoming update contents: %s", err.Error())
-			}
+			handleUnhandledErr(m.errFunc, resolveLogger(m.logger, m.errorLog), "Failed to read incoming update contents", err,
+				slog.Int64(LogKeyBotId, b.bot.Id), slog.String(LogKeyURLPath, b.urlPath))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		b.webhookQueue.Add(1)
 		b.updateChan <- bytes
+		b.webhookQueue.Add(-1)
 	}
 }
 
-func (m *botMapping) logf(format string, args ...interface{}) {
-	if m.errorLog != nil {
-		m.errorLog.Printf(format, args...)
-	} else {
-		log.Printf(format, args...)
+// webhookQueueDepth returns the number of incoming webhook updates waiting to be processed, across all bots.
+func (m *botMapping) webhookQueueDepth() int64 {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	var depth int64
+	for _, b := range m.mapping {
+		depth += b.webhookQueue.Load()
 	}
+	return depth
 }
 
 func (b *botData) stop() {
@@ -0,0 +1,191 @@
+package ext
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// CommandDescriber is implemented by handlers which should be listed in the bot's command menu, such as
+// handlers.Command. It allows for the Dispatcher to collect all registered commands, and keep telegram up to date.
+type CommandDescriber interface {
+	// BotCommands returns all the command menu entries for this handler; one for each scope and language.
+	// Handlers which should not be shown in the command menu return an empty list.
+	BotCommands() []BotCommandEntry
+}
+
+// BotCommandEntry is a single command menu entry, for a specific scope and language.
+type BotCommandEntry struct {
+	// The command and its description.
+	gotgbot.BotCommand
+	// Scope is the scope of users for which this command is shown. If nil, gotgbot.BotCommandScopeDefault is used.
+	Scope gotgbot.BotCommandScope
+	// LanguageCode is the two-letter ISO 639-1 language code of the users this command is shown to.
+	// If empty, the command is shown to all users in the scope, for whose language there are no dedicated commands.
+	LanguageCode string
+}
+
+// SyncCommandsOpts contains the optional fields for the Dispatcher.SyncCommands method.
+type SyncCommandsOpts struct {
+	// RequestOpts are used for all the GetMyCommands and SetMyCommands calls made during the sync.
+	RequestOpts *gotgbot.RequestOpts
+}
+
+// Commands collects the command menu entries of all the registered handlers which implement CommandDescriber, across
+// all groups. Entries are returned in handler order; duplicate commands in the same scope and language are dropped.
+func (d *Dispatcher) Commands() []BotCommandEntry {
+	var entries []BotCommandEntry
+	seen := map[string]struct{}{}
+
+	for _, group := range d.handlers.getGroups() {
+		for _, h := range group {
+			describer, ok := h.(CommandDescriber)
+			if !ok {
+				continue
+			}
+
+			for _, entry := range describer.BotCommands() {
+				if entry.Scope == nil {
+					entry.Scope = gotgbot.BotCommandScopeDefault{}
+				}
+
+				scopeKey, err := commandScopeKey(entry.Scope, entry.LanguageCode)
+				if err != nil {
+					// Invalid scopes will also fail when syncing, so we can skip them here.
+					continue
+				}
+				key := scopeKey + "/" + entry.Command
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries
+}
+
+// SyncCommands updates the bot's command menu to match the commands registered to this dispatcher (see
+// Dispatcher.Commands). For each scope and language in use, the current commands are obtained with GetMyCommands,
+// and SetMyCommands is only called if they differ.
+//
+// Telegram shows users the commands for their language instead of the default ones, so each language's command list
+// contains all the commands of its scope; commands without a translation use their default description.
+//
+// Note: Scopes and languages which are not used by any registered command are not modified.
+func (d *Dispatcher) SyncCommands(b *gotgbot.Bot, opts *SyncCommandsOpts) error {
+	var reqOpts *gotgbot.RequestOpts
+	if opts != nil {
+		reqOpts = opts.RequestOpts
+	}
+
+	type scopedCommands struct {
+		scope        gotgbot.BotCommandScope
+		languageCode string
+		commands     []gotgbot.BotCommand
+	}
+
+	var order []string
+	scopes := map[string]*scopedCommands{}
+	for _, entry := range d.Commands() {
+		key, err := commandScopeKey(entry.Scope, entry.LanguageCode)
+		if err != nil {
+			return err
+		}
+
+		sc, ok := scopes[key]
+		if !ok {
+			sc = &scopedCommands{scope: entry.Scope, languageCode: entry.LanguageCode}
+			scopes[key] = sc
+			order = append(order, key)
+		}
+		sc.commands = append(sc.commands, entry.BotCommand)
+	}
+
+	for _, key := range order {
+		sc := scopes[key]
+		if sc.languageCode != "" {
+			defaultKey, err := commandScopeKey(sc.scope, "")
+			if err != nil {
+				return err
+			}
+			if def, ok := scopes[defaultKey]; ok {
+				sc.commands = withDefaultCommands(def.commands, sc.commands)
+			}
+		}
+
+		current, err := b.GetMyCommands(&gotgbot.GetMyCommandsOpts{
+			Scope:        sc.scope,
+			LanguageCode: sc.languageCode,
+			RequestOpts:  reqOpts,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get commands for scope %s: %w", key, err)
+		}
+
+		if commandsEqual(current, sc.commands) {
+			continue
+		}
+
+		_, err = b.SetMyCommands(sc.commands, &gotgbot.SetMyCommandsOpts{
+			Scope:        sc.scope,
+			LanguageCode: sc.languageCode,
+			RequestOpts:  reqOpts,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set commands for scope %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// commandScopeKey generates a unique key for a scope and language pair.
+func commandScopeKey(scope gotgbot.BotCommandScope, languageCode string) (string, error) {
+	bs, err := json.Marshal(scope)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal command scope: %w", err)
+	}
+	return string(bs) + "/" + languageCode, nil
+}
+
+// withDefaultCommands returns the translated commands of a language, completed with all the default commands of the
+// same scope which have no translation. The order of the default commands is kept; commands which only exist in the
+// translated list are added at the end.
+func withDefaultCommands(defaults []gotgbot.BotCommand, translated []gotgbot.BotCommand) []gotgbot.BotCommand {
+	descriptions := make(map[string]string, len(translated))
+	for _, c := range translated {
+		descriptions[c.Command] = c.Description
+	}
+
+	commands := make([]gotgbot.BotCommand, 0, len(defaults)+len(translated))
+	for _, c := range defaults {
+		if desc, ok := descriptions[c.Command]; ok {
+			c.Description = desc
+			delete(descriptions, c.Command)
+		}
+		commands = append(commands, c)
+	}
+	for _, c := range translated {
+		if _, ok := descriptions[c.Command]; ok {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+// commandsEqual checks whether two command lists are identical, including their order.
+func commandsEqual(a []gotgbot.BotCommand, b []gotgbot.BotCommand) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package ext_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+)
+
+func TestDispatcherCommands(t *testing.T) {
+	d := ext.NewDispatcher(nil)
+	d.AddHandler(handlers.NewCommand("start", nil).
+		SetDescription("Start the bot").
+		SetLanguageDescription("ru", "Запустить бота"))
+	d.AddHandler(handlers.NewMessage(message.All, nil))
+	d.AddHandlerToGroup(handlers.NewCommand("hidden", nil), 1)
+	d.AddHandlerToGroup(handlers.NewNamedhandler("admin", handlers.NewCommand("ban", nil).
+		SetDescription("Ban a user").
+		SetScopes(gotgbot.BotCommandScopeAllChatAdministrators{})), 2)
+	// Duplicate commands in other groups are ignored.
+	d.AddHandlerToGroup(handlers.NewCommand("start", nil).SetDescription("Other description"), 3)
+
+	cmds := d.Commands()
+	if len(cmds) != 3 {
+		t.Fatalf("expected 3 commands, got %d: %+v", len(cmds), cmds)
+	}
+	if cmds[0].Command != "start" || cmds[0].Description != "Start the bot" || cmds[0].LanguageCode != "" {
+		t.Errorf("unexpected first command: %+v", cmds[0])
+	}
+	if cmds[1].Command != "start" || cmds[1].LanguageCode != "ru" {
+		t.Errorf("unexpected second command: %+v", cmds[1])
+	}
+	if _, ok := cmds[2].Scope.(gotgbot.BotCommandScopeAllChatAdministrators); !ok || cmds[2].Command != "ban" {
+		t.Errorf("unexpected third command: %+v", cmds[2])
+	}
+}
+
+func TestDispatcherSyncCommands(t *testing.T) {
+	getCommands := &testEndpoint{
+		replies: []string{
+			// The default commands are already up-to-date.
+			`{"ok": true, "result": [{"command": "start", "description": "Start the bot"}]}`,
+			// The translated commands have not been set yet.
+			`{"ok": true, "result": []}`,
+		},
+	}
+	setCommands := &testEndpoint{reply: `{"ok": true, "result": true}`}
+	server := basicTestServer(t, map[string]*testEndpoint{
+		"getMyCommands": getCommands,
+		"setMyCommands": setCommands,
+	})
+	defer server.Close()
+
+	b := &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{},
+	}
+
+	d := ext.NewDispatcher(nil)
+	d.AddHandler(handlers.NewCommand("start", nil).
+		SetDescription("Start the bot").
+		SetLanguageDescription("fr", "Démarrer le bot"))
+
+	err := d.SyncCommands(b, &ext.SyncCommandsOpts{RequestOpts: &gotgbot.RequestOpts{APIURL: server.URL}})
+	if err != nil {
+		t.Fatalf("failed to sync commands: %s", err.Error())
+	}
+
+	if n := getCommands.idx.Load(); n != 2 {
+		t.Errorf("expected 2 getMyCommands calls, got %d", n)
+	}
+	if n := setCommands.idx.Load(); n != 1 {
+		t.Errorf("expected only the changed scope to be set, got %d setMyCommands calls", n)
+	}
+}
+
+func TestDispatcherSyncCommandsUntranslated(t *testing.T) {
+	set := map[string][]gotgbot.BotCommand{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Commands     string `json:"commands"`
+			LanguageCode string `json:"language_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %s", err.Error())
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/getMyCommands") {
+			fmt.Fprint(w, `{"ok": true, "result": []}`)
+			return
+		}
+		var cmds []gotgbot.BotCommand
+		if err := json.Unmarshal([]byte(req.Commands), &cmds); err != nil {
+			t.Errorf("failed to decode commands: %s", err.Error())
+		}
+		set[req.LanguageCode] = cmds
+		fmt.Fprint(w, `{"ok": true, "result": true}`)
+	}))
+	defer server.Close()
+
+	b := &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{},
+	}
+
+	d := ext.NewDispatcher(nil)
+	d.AddHandler(handlers.NewCommand("start", nil).
+		SetDescription("Start the bot").
+		SetLanguageDescription("fr", "Démarrer le bot"))
+	d.AddHandler(handlers.NewCommand("help", nil).
+		SetDescription("Get help"))
+
+	err := d.SyncCommands(b, &ext.SyncCommandsOpts{RequestOpts: &gotgbot.RequestOpts{APIURL: server.URL}})
+	if err != nil {
+		t.Fatalf("failed to sync commands: %s", err.Error())
+	}
+
+	expected := []gotgbot.BotCommand{
+		{Command: "start", Description: "Démarrer le bot"},
+		// Untranslated commands are still shown, with their default description.
+		{Command: "help", Description: "Get help"},
+	}
+	if !reflect.DeepEqual(set["fr"], expected) {
+		t.Errorf("expected translated commands %+v, got %+v", expected, set["fr"])
+	}
+	if len(set[""]) != 2 || set[""][0].Description != "Start the bot" {
+		t.Errorf("unexpected default commands: %+v", set[""])
+	}
+}
@@ -1,13 +1,18 @@
 package ext
 
 import (
+	"context"
 	"strings"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
-// TODO: extend to be used as a generic cancel context?
 type Context struct {
+	// context.Context is inlined so that the Context can be passed directly to the gotgbot *WithContext methods.
+	// When processed by a Dispatcher started by an Updater, it is cancelled when the Updater is stopped, or once the
+	// update has been processing for longer than the DispatcherOpts.UpdateTimeout.
+	// Middlewares may replace it to add values or deadlines for the remaining handlers.
+	context.Context
 	// gotgbot.Update is inlined so that we can access all fields immediately if necessary.
 	*gotgbot.Update
 	// Bot represents gotgbot.User behind the Bot that received this update, so we can keep track of update ownership.
@@ -36,6 +41,11 @@ type Context struct {
 	//  - the linked channel of the current chat
 	//  - an anonymous user, speaking through a channel
 	EffectiveSender *gotgbot.Sender
+
+	// handler is the name of the handler currently processing the update, if any.
+	handler string
+	// failure describes the first handler error returned while processing the update, if any.
+	failure *updateFailure
 }
 
 // NewContext populates a context with the relevant fields from the current bot and update.
@@ -164,6 +174,7 @@ func NewContext(b *gotgbot.Bot, update *gotgbot.Update, data map[string]interfac
 	}
 
 	return &Context{
+		Context:          context.Background(),
 		Update:           update,
 		Bot:              b.User,
 		Data:             data,
@@ -0,0 +1,185 @@
+package ext
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCronSpec = errors.New("invalid cron spec")
+
+// CronSchedule is a parsed cron-style schedule, as used by JobQueue.RunCron.
+type CronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// anyDay and anyWeekday track whether the day and weekday fields were "*", which affects how they are combined.
+	anyDay     bool
+	anyWeekday bool
+}
+
+// cronField defines the range of values allowed for a cron field.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMinutes  = cronField{name: "minute", min: 0, max: 59}
+	cronHours    = cronField{name: "hour", min: 0, max: 23}
+	cronDays     = cronField{name: "day of month", min: 1, max: 31}
+	cronMonths   = cronField{name: "month", min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	cronWeekdays = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard 5-field cron spec: minute, hour, day of month, month and day of week.
+// Fields support "*", lists ("1,2"), ranges ("1-5"), steps ("*/15", "0-30/10"), and month and weekday names ("jan",
+// "mon"). The @yearly, @monthly, @weekly, @daily and @hourly macros are also supported.
+//
+// As with cron, if both the day of month and day of week are restricted, a time matches if either of them match.
+func ParseCron(spec string) (*CronSchedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidCronSpec, len(fields))
+	}
+
+	var s CronSchedule
+	var err error
+	for idx, f := range []struct {
+		field cronField
+		bits  *uint64
+	}{
+		{field: cronMinutes, bits: &s.minutes},
+		{field: cronHours, bits: &s.hours},
+		{field: cronDays, bits: &s.days},
+		{field: cronMonths, bits: &s.months},
+		{field: cronWeekdays, bits: &s.weekdays},
+	} {
+		*f.bits, err = parseCronField(fields[idx], f.field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sunday can be either 0 or 7.
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+	return &s, nil
+}
+
+func parseCronField(spec string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepSpec)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%w: invalid step %q for %s", ErrInvalidCronSpec, stepSpec, field.name)
+			}
+		}
+
+		start, end := field.min, field.max
+		if rangeSpec != "*" {
+			startSpec, endSpec, isRange := strings.Cut(rangeSpec, "-")
+
+			var err error
+			start, err = field.parseValue(startSpec)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				end, err = field.parseValue(endSpec)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 until the end of the range.
+				end = field.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("%w: invalid range %q for %s", ErrInvalidCronSpec, rangeSpec, field.name)
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) parseValue(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%w: invalid value %q for %s", ErrInvalidCronSpec, s, f.name)
+	}
+	return v, nil
+}
+
+// Next returns the first time matching the schedule which is strictly after the given time, in the given time's
+// location. If no such time exists within the next 5 years (eg for "0 0 30 2 *"), the zero time is returned.
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
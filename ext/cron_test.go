@@ -0,0 +1,90 @@
+package ext_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// Friday 15th March 2024, 10:30.
+	from := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+
+	for name, testParams := range map[string]struct {
+		spec     string
+		expected time.Time
+	}{
+		"every minute": {
+			spec:     "* * * * *",
+			expected: time.Date(2024, time.March, 15, 10, 31, 0, 0, time.UTC),
+		},
+		"step": {
+			spec:     "*/20 * * * *",
+			expected: time.Date(2024, time.March, 15, 10, 40, 0, 0, time.UTC),
+		},
+		"strictly after": {
+			spec:     "30 10 * * *",
+			expected: time.Date(2024, time.March, 16, 10, 30, 0, 0, time.UTC),
+		},
+		"hourly macro": {
+			spec:     "@hourly",
+			expected: time.Date(2024, time.March, 15, 11, 0, 0, 0, time.UTC),
+		},
+		"weekday names": {
+			spec:     "0 9 * * mon-wed",
+			expected: time.Date(2024, time.March, 18, 9, 0, 0, 0, time.UTC),
+		},
+		"sunday as 7": {
+			spec:     "0 0 * * 7",
+			expected: time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC),
+		},
+		"month rollover": {
+			spec:     "0 0 1 jan,jun *",
+			expected: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"day or weekday": {
+			// The 20th, or any Saturday; the Saturday comes first.
+			spec:     "0 12 20 * sat",
+			expected: time.Date(2024, time.March, 16, 12, 0, 0, 0, time.UTC),
+		},
+		"leap day": {
+			spec:     "0 0 29 2 *",
+			expected: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"never": {
+			spec:     "0 0 30 2 *",
+			expected: time.Time{},
+		},
+	} {
+		testParams := testParams
+		t.Run(name, func(t *testing.T) {
+			s, err := ext.ParseCron(testParams.spec)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", testParams.spec, err.Error())
+			}
+
+			if next := s.Next(from); !next.Equal(testParams.expected) {
+				t.Errorf("expected next run at %s, got %s", testParams.expected, next)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * foo *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+	} {
+		if _, err := ext.ParseCron(spec); !errors.Is(err, ext.ErrInvalidCronSpec) {
+			t.Errorf("expected %q to be invalid, got %v", spec, err)
+		}
+	}
+}
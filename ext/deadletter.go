@@ -0,0 +1,227 @@
+package ext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+var (
+	ErrNoDeadLetterStore  = errors.New("no dead letter store")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrRedriveFailed      = errors.New("redriven update failed again")
+)
+
+// DeadLetter is an update which failed to be processed, because a handler returned an error or panicked.
+type DeadLetter struct {
+	// Id is the unique ID of the dead letter. It is kept when the update is redriven.
+	Id string `json:"id"`
+	// BotId is the ID of the bot which received the update.
+	BotId int64 `json:"bot_id"`
+	// UpdateId is the ID of the update.
+	UpdateId int64 `json:"update_id"`
+	// Update contains the raw update. If the update was passed to the Dispatcher as a gotgbot.Update, rather than as
+	// JSON, this is its JSON encoding.
+	Update json.RawMessage `json:"update"`
+	// Handler is the name of the handler which failed, if any.
+	Handler string `json:"handler,omitempty"`
+	// Error is the error returned by the handler, or the panic value.
+	Error string `json:"error"`
+	// Stack is the stack trace of the panic, if the handler panicked.
+	Stack string `json:"stack,omitempty"`
+	// Time is when the update last failed.
+	Time time.Time `json:"time"`
+	// Attempts is the number of times the update failed to be processed.
+	Attempts int `json:"attempts"`
+}
+
+// DeadLetterStore allows you to define custom backends for storing failed updates, such that they can be redriven
+// later.
+type DeadLetterStore interface {
+	// SaveDeadLetter creates or updates a dead letter.
+	SaveDeadLetter(letter DeadLetter) error
+	// DeleteDeadLetter removes a dead letter. Deleting a dead letter which does not exist is not an error.
+	DeleteDeadLetter(id string) error
+	// ListDeadLetters returns all saved dead letters.
+	ListDeadLetters() ([]DeadLetter, error)
+}
+
+// InMemoryDeadLetterStore is a thread-safe in-memory implementation of the DeadLetterStore interface.
+type InMemoryDeadLetterStore struct {
+	letters map[string]DeadLetter
+	lock    sync.RWMutex
+}
+
+var _ DeadLetterStore = &InMemoryDeadLetterStore{}
+
+func NewInMemoryDeadLetterStore() *InMemoryDeadLetterStore {
+	return &InMemoryDeadLetterStore{
+		letters: map[string]DeadLetter{},
+	}
+}
+
+func (s *InMemoryDeadLetterStore) SaveDeadLetter(letter DeadLetter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.letters[letter.Id] = letter
+	return nil
+}
+
+func (s *InMemoryDeadLetterStore) DeleteDeadLetter(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.letters, id)
+	return nil
+}
+
+func (s *InMemoryDeadLetterStore) ListDeadLetters() ([]DeadLetter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	letters := make([]DeadLetter, 0, len(s.letters))
+	for _, l := range s.letters {
+		letters = append(letters, l)
+	}
+	return letters, nil
+}
+
+// updateFailure describes why an update failed to be processed.
+type updateFailure struct {
+	handler string
+	err     string
+	stack   string
+}
+
+// saveDeadLetter stores a failed update in the DeadLetters store. If the update was being redriven, the previous dead
+// letter is updated.
+func (d *Dispatcher) saveDeadLetter(b *gotgbot.Bot, u *gotgbot.Update, raw json.RawMessage, f updateFailure, redriven *DeadLetter) {
+	attrs := []slog.Attr{slog.Int64(LogKeyBotId, b.Id)}
+	if f.handler != "" {
+		attrs = append(attrs, slog.String(LogKeyHandler, f.handler))
+	}
+
+	letter := DeadLetter{
+		BotId:    b.Id,
+		Update:   raw,
+		Handler:  f.handler,
+		Error:    f.err,
+		Stack:    f.stack,
+		Time:     time.Now(),
+		Attempts: 1,
+	}
+	if u != nil {
+		letter.UpdateId = u.UpdateId
+		attrs = append(attrs, slog.Int64(LogKeyUpdateId, u.UpdateId))
+		if letter.Update == nil {
+			bs, err := json.Marshal(u)
+			if err != nil {
+				handleUnhandledErr(d.UnhandledErrFunc, d.logger(), "Failed to marshal dead letter update", err, attrs...)
+				return
+			}
+			letter.Update = bs
+		}
+	}
+
+	if redriven != nil {
+		letter.Id = redriven.Id
+		letter.Attempts = redriven.Attempts + 1
+	} else {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			handleUnhandledErr(d.UnhandledErrFunc, d.logger(), "Failed to generate dead letter ID", err, attrs...)
+			return
+		}
+		letter.Id = hex.EncodeToString(id)
+	}
+
+	if err := d.DeadLetters.SaveDeadLetter(letter); err != nil {
+		handleUnhandledErr(d.UnhandledErrFunc, d.logger(), "Failed to store dead letter", err, attrs...)
+	}
+}
+
+// RedriveDeadLetters processes all of a bot's dead letters again, oldest first, for example once a fix has been
+// deployed. Updates which are processed successfully are removed from the store; updates which fail again are kept,
+// with their Attempts incremented.
+// It returns the number of updates which were processed successfully.
+func (d *Dispatcher) RedriveDeadLetters(ctx context.Context, b *gotgbot.Bot) (int, error) {
+	if d.DeadLetters == nil {
+		return 0, ErrNoDeadLetterStore
+	}
+
+	letters, err := d.DeadLetters.ListDeadLetters()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].UpdateId != letters[j].UpdateId {
+			return letters[i].UpdateId < letters[j].UpdateId
+		}
+		return letters[i].Time.Before(letters[j].Time)
+	})
+
+	redriven := 0
+	for _, l := range letters {
+		if l.BotId != b.Id {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return redriven, err
+		}
+
+		err := d.redrive(ctx, b, l)
+		if err != nil && !errors.Is(err, ErrRedriveFailed) {
+			return redriven, err
+		}
+		if err == nil {
+			redriven++
+		}
+	}
+	return redriven, nil
+}
+
+// RedriveDeadLetter processes a single dead letter again. If the update is processed successfully, it is removed from
+// the store; otherwise, ErrRedriveFailed is returned, and the dead letter is kept with its Attempts incremented.
+func (d *Dispatcher) RedriveDeadLetter(ctx context.Context, b *gotgbot.Bot, id string) error {
+	if d.DeadLetters == nil {
+		return ErrNoDeadLetterStore
+	}
+
+	letters, err := d.DeadLetters.ListDeadLetters()
+	if err != nil {
+		return fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	for _, l := range letters {
+		if l.Id == id && l.BotId == b.Id {
+			return d.redrive(ctx, b, l)
+		}
+	}
+	return fmt.Errorf("%w: %s for bot %d", ErrDeadLetterNotFound, id, b.Id)
+}
+
+func (d *Dispatcher) redrive(ctx context.Context, b *gotgbot.Bot, l DeadLetter) error {
+	failed, err := d.processRawUpdateWithFailure(ctx, b, l.Update, &l)
+	if err != nil {
+		// Processing errors have already been stored in the dead letter; they're only relevant to the caller.
+		handleUnhandledErr(d.UnhandledErrFunc, d.logger(), "Failed to process redriven update", err,
+			slog.Int64(LogKeyBotId, b.Id), slog.Int64(LogKeyUpdateId, l.UpdateId))
+	}
+	if failed {
+		return fmt.Errorf("%w: %s", ErrRedriveFailed, l.Id)
+	}
+
+	if err := d.DeadLetters.DeleteDeadLetter(l.Id); err != nil {
+		return fmt.Errorf("failed to delete dead letter %s: %w", l.Id, err)
+	}
+	return nil
+}
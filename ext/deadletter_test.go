@@ -0,0 +1,189 @@
+package ext_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+)
+
+func listDeadLetters(t *testing.T, store ext.DeadLetterStore) []ext.DeadLetter {
+	t.Helper()
+
+	letters, err := store.ListDeadLetters()
+	if err != nil {
+		t.Fatalf("failed to list dead letters: %v", err)
+	}
+	return letters
+}
+
+func TestDeadLetterHandlerError(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}}
+	store := ext.NewInMemoryDeadLetterStore()
+	d := ext.NewDispatcher(&ext.DispatcherOpts{DeadLetters: store})
+	d.AddHandler(handlers.NewNamedhandler("failing", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return errTestHandler
+	})))
+	d.AddHandler(handlers.NewNamedhandler("ok", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return nil
+	})))
+
+	raw := json.RawMessage(`{"update_id": 10, "message": {"message_id": 1, "text": "hello"}}`)
+	updates := make(chan json.RawMessage, 1)
+	updates <- raw
+	close(updates)
+	d.Start(b, updates)
+	d.Stop()
+
+	letters := listDeadLetters(t, store)
+	if len(letters) != 1 {
+		t.Fatalf("expected a single dead letter, got %d", len(letters))
+	}
+	l := letters[0]
+	if l.Id == "" || l.BotId != 1 || l.UpdateId != 10 || l.Handler != "failing" || l.Error != errTestHandler.Error() ||
+		l.Stack != "" || l.Attempts != 1 || l.Time.IsZero() {
+		t.Errorf("unexpected dead letter: %+v", l)
+	}
+	if string(l.Update) != string(raw) {
+		t.Errorf("expected raw update to be stored, got %s", l.Update)
+	}
+}
+
+func TestDeadLetterPanic(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}}
+	store := ext.NewInMemoryDeadLetterStore()
+	panicHandled := false
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		DeadLetters: store,
+		Panic: func(b *gotgbot.Bot, ctx *ext.Context, r interface{}) {
+			panicHandled = true
+		},
+	})
+	d.AddHandler(handlers.NewNamedhandler("panicking", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		panic("oh no")
+	})))
+
+	err := d.ProcessUpdate(b, &gotgbot.Update{UpdateId: 11, Message: &gotgbot.Message{Text: "hello"}}, nil)
+	if err != nil {
+		t.Fatalf("expected panic to be handled, got %v", err)
+	}
+	if !panicHandled {
+		t.Error("expected panic handler to be called")
+	}
+
+	letters := listDeadLetters(t, store)
+	if len(letters) != 1 {
+		t.Fatalf("expected a single dead letter, got %d", len(letters))
+	}
+	l := letters[0]
+	if l.Handler != "panicking" || !strings.Contains(l.Error, "oh no") || !strings.Contains(l.Stack, "deadletter_test.go") {
+		t.Errorf("unexpected dead letter: %+v", l)
+	}
+
+	var upd gotgbot.Update
+	if err := json.Unmarshal(l.Update, &upd); err != nil || upd.UpdateId != 11 || upd.Message == nil || upd.Message.Text != "hello" {
+		t.Errorf("expected update to be stored, got %s (%v)", l.Update, err)
+	}
+}
+
+func TestDeadLetterInvalidUpdate(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}}
+	store := ext.NewInMemoryDeadLetterStore()
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		DeadLetters:      store,
+		UnhandledErrFunc: func(err error) {},
+	})
+
+	updates := make(chan json.RawMessage, 1)
+	updates <- json.RawMessage(`{"update_id": "not a number"}`)
+	close(updates)
+	d.Start(b, updates)
+	d.Stop()
+
+	letters := listDeadLetters(t, store)
+	if len(letters) != 1 || !strings.Contains(letters[0].Error, "failed to unmarshal update") {
+		t.Errorf("expected invalid update to be stored, got %+v", letters)
+	}
+}
+
+func TestRedriveDeadLetters(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}}
+	otherBot := &gotgbot.Bot{User: gotgbot.User{Id: 2}}
+	store := ext.NewInMemoryDeadLetterStore()
+
+	fixed := atomic.Bool{}
+	var handled []int64
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		DeadLetters:      store,
+		UnhandledErrFunc: func(err error) {},
+	})
+	d.AddHandler(handlers.NewNamedhandler("flaky", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		if !fixed.Load() {
+			return errTestHandler
+		}
+		handled = append(handled, ctx.UpdateId)
+		return nil
+	})))
+
+	for _, id := range []int64{3, 1, 2} {
+		if err := d.ProcessUpdate(b, &gotgbot.Update{UpdateId: id, Message: &gotgbot.Message{Text: "hello"}}, nil); err != nil {
+			t.Fatalf("failed to process update: %v", err)
+		}
+	}
+	if err := d.ProcessUpdate(otherBot, &gotgbot.Update{UpdateId: 1, Message: &gotgbot.Message{Text: "hello"}}, nil); err != nil {
+		t.Fatalf("failed to process update: %v", err)
+	}
+	if letters := listDeadLetters(t, store); len(letters) != 4 {
+		t.Fatalf("expected 4 dead letters, got %d", len(letters))
+	}
+
+	// Redriving before the fix keeps the dead letters, and counts the attempts.
+	n, err := d.RedriveDeadLetters(context.Background(), b)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no updates to be redriven, got %d (%v)", n, err)
+	}
+	var retried ext.DeadLetter
+	for _, l := range listDeadLetters(t, store) {
+		if l.BotId == 1 && l.Attempts != 2 {
+			t.Errorf("expected dead letter to have been attempted twice, got %+v", l)
+		}
+		if l.BotId == 1 && l.UpdateId == 1 {
+			retried = l
+		}
+	}
+	if err := d.RedriveDeadLetter(context.Background(), b, retried.Id); !errors.Is(err, ext.ErrRedriveFailed) {
+		t.Errorf("expected redrive to fail again, got %v", err)
+	}
+
+	fixed.Store(true)
+	if err := d.RedriveDeadLetter(context.Background(), b, retried.Id); err != nil {
+		t.Fatalf("failed to redrive dead letter: %v", err)
+	}
+	if err := d.RedriveDeadLetter(context.Background(), b, retried.Id); !errors.Is(err, ext.ErrDeadLetterNotFound) {
+		t.Errorf("expected redriven dead letter to be removed, got %v", err)
+	}
+
+	n, err = d.RedriveDeadLetters(context.Background(), b)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 updates to be redriven, got %d (%v)", n, err)
+	}
+	if len(handled) != 3 || handled[0] != 1 || handled[1] != 2 || handled[2] != 3 {
+		t.Errorf("expected updates to be redriven in order, got %v", handled)
+	}
+
+	// Other bots' dead letters are left alone.
+	if letters := listDeadLetters(t, store); len(letters) != 1 || letters[0].BotId != 2 {
+		t.Errorf("expected only the other bot's dead letter to remain, got %+v", letters)
+	}
+
+	if _, err := ext.NewDispatcher(nil).RedriveDeadLetters(context.Background(), b); !errors.Is(err, ext.ErrNoDeadLetterStore) {
+		t.Errorf("expected missing store error, got %v", err)
+	}
+}
@@ -1,13 +1,16 @@
 package ext
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
@@ -53,6 +56,13 @@ type UpdateDispatcher interface {
 	Stop()
 }
 
+// The ContextUpdateDispatcher interface is implemented by UpdateDispatchers which can process updates within a parent
+// context.Context. The Updater uses it to cancel any in-flight update processing when it is stopped.
+type ContextUpdateDispatcher interface {
+	UpdateDispatcher
+	StartWithContext(ctx context.Context, b *gotgbot.Bot, updates <-chan json.RawMessage)
+}
+
 // The Dispatcher struct is the default UpdateDispatcher implementation.
 // It supports grouping of update handlers, allowing for powerful update handling flows.
 // Customise the handling of updates by wrapping the Processor struct.
@@ -74,12 +84,27 @@ type Dispatcher struct {
 	// UnhandledErrFunc provides more flexibility for dealing with unhandled update processing errors.
 	// This includes errors when unmarshalling updates, unhandled panics during handler executions, or unknown
 	// dispatcher actions.
-	// If nil, the error goes to ErrorLog.
+	// If nil, the error is logged to Logger.
 	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for unexpected behavior from handlers.
+	// Each update's routing decisions are also logged at debug level.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
 	// ErrorLog specifies an optional logger for unexpected behavior from handlers.
-	// If nil, logging is done via the log package's standard logger.
+	// If nil, logging is done via slog.Default().
 	ErrorLog *log.Logger
 
+	// UpdateTimeout is the maximum amount of time that can be spent processing a single update, after which the
+	// Context of the update is cancelled.
+	// If 0, updates have no deadline.
+	UpdateTimeout time.Duration
+
+	// DeadLetters stores updates which failed to be processed, because a handler returned an error or panicked, or
+	// because they could not be unmarshalled. They can be processed again using RedriveDeadLetters once the issue has
+	// been fixed.
+	// If nil, failed updates are not stored.
+	DeadLetters DeadLetterStore
+
 	// handlers represents all available handlers.
 	handlers handlerMapping
 
@@ -91,7 +116,7 @@ type Dispatcher struct {
 }
 
 // Ensure compile-time type safety.
-var _ UpdateDispatcher = &Dispatcher{}
+var _ ContextUpdateDispatcher = &Dispatcher{}
 
 // DispatcherOpts can be used to configure or override default Dispatcher behaviours.
 type DispatcherOpts struct {
@@ -101,19 +126,34 @@ type DispatcherOpts struct {
 	// More info at Dispatcher.Error.
 	Error DispatcherErrorHandler
 	// Panic handles any panics that occur during handler execution.
-	// If no panic handlers are defined, the stack is logged to ErrorLog.
+	// If no panic handlers are defined, the stack is logged to Logger.
 	// More info at Dispatcher.Panic.
 	Panic DispatcherPanicHandler
 
 	// UnhandledErrFunc provides more flexibility for dealing with unhandled update processing errors.
 	// This includes errors when unmarshalling updates, unhandled panics during handler executions, or unknown
 	// dispatcher actions.
-	// If nil, the error goes to ErrorLog.
+	// If nil, the error is logged to Logger.
 	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for unexpected behavior from handlers.
+	// Each update's routing decisions are also logged at debug level.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
 	// ErrorLog specifies an optional logger for unexpected behavior from handlers.
-	// If nil, logging is done via the log package's standard logger.
+	// If nil, logging is done via slog.Default().
 	ErrorLog *log.Logger
 
+	// UpdateTimeout is the maximum amount of time that can be spent processing a single update.
+	// More info at Dispatcher.UpdateTimeout.
+	UpdateTimeout time.Duration
+
+	// DeadLetters stores updates which failed to be processed.
+	// More info at Dispatcher.DeadLetters.
+	DeadLetters DeadLetterStore
+
+	// Middlewares are added to the Dispatcher as global middlewares. More info at Dispatcher.Use.
+	Middlewares []Middleware
+
 	// MaxRoutines is used to decide how to limit the number of goroutines spawned by the dispatcher.
 	// This defines how many updates can be processed at the same time.
 	// If MaxRoutines == 0, DefaultMaxRoutines is used instead.
@@ -128,6 +168,10 @@ func NewDispatcher(opts *DispatcherOpts) *Dispatcher {
 	var panicHandler DispatcherPanicHandler
 	var unhandledErrFunc ErrorFunc
 	var errLog *log.Logger
+	var logger *slog.Logger
+	var middlewares []Middleware
+	var updateTimeout time.Duration
+	var deadLetters DeadLetterStore
 
 	maxRoutines := DefaultMaxRoutines
 	processor := Processor(BaseProcessor{})
@@ -144,6 +188,10 @@ func NewDispatcher(opts *DispatcherOpts) *Dispatcher {
 		panicHandler = opts.Panic
 		unhandledErrFunc = opts.UnhandledErrFunc
 		errLog = opts.ErrorLog
+		logger = opts.Logger
+		middlewares = opts.Middlewares
+		updateTimeout = opts.UpdateTimeout
+		deadLetters = opts.DeadLetters
 	}
 
 	var limiter chan struct{}
@@ -156,24 +204,25 @@ func NewDispatcher(opts *DispatcherOpts) *Dispatcher {
 		limiter = make(chan struct{}, maxRoutines)
 	}
 
-	return &Dispatcher{
+	d := &Dispatcher{
 		Processor:        processor,
 		Error:            errHandler,
 		Panic:            panicHandler,
 		UnhandledErrFunc: unhandledErrFunc,
+		Logger:           logger,
 		ErrorLog:         errLog,
+		UpdateTimeout:    updateTimeout,
+		DeadLetters:      deadLetters,
 		handlers:         handlerMapping{},
 		limiter:          limiter,
 		waitGroup:        sync.WaitGroup{},
 	}
+	d.Use(middlewares...)
+	return d
 }
 
-func (d *Dispatcher) logf(format string, args ...interface{}) {
-	if d.ErrorLog != nil {
-		d.ErrorLog.Printf(format, args...)
-	} else {
-		log.Printf(format, args...)
-	}
+func (d *Dispatcher) logger() *slog.Logger {
+	return resolveLogger(d.Logger, d.ErrorLog)
 }
 
 // CurrentUsage returns the current number of concurrently processing updates.
@@ -189,7 +238,20 @@ func (d *Dispatcher) MaxUsage() int {
 // Start to handle incoming updates.
 // This is a blocking method; it should be called as a goroutine, such that it can receive incoming updates.
 func (d *Dispatcher) Start(b *gotgbot.Bot, updates <-chan json.RawMessage) {
+	d.StartWithContext(context.Background(), b, updates)
+}
+
+// StartWithContext starts handling incoming updates, with each update's Context derived from the given ctx.
+// This is a blocking method; it should be called as a goroutine, such that it can receive incoming updates.
+func (d *Dispatcher) StartWithContext(ctx context.Context, b *gotgbot.Bot, updates <-chan json.RawMessage) {
+	d.start(ctx, b, updates, nil)
+}
+
+// start handles incoming updates. If processed is set, it is called with the index of each received update once it
+// has been processed; updates may finish processing in any order.
+func (d *Dispatcher) start(ctx context.Context, b *gotgbot.Bot, updates <-chan json.RawMessage, processed func(idx int64)) {
 	// Listen to updates as they come in from the updater.
+	var idx int64
 	for upd := range updates {
 		d.waitGroup.Add(1)
 
@@ -200,9 +262,12 @@ func (d *Dispatcher) Start(b *gotgbot.Bot, updates <-chan json.RawMessage) {
 			d.limiter <- struct{}{}
 		}
 
-		go func(upd json.RawMessage) {
+		go func(idx int64, upd json.RawMessage) {
 			// We defer here so that whatever happens, we can clean up the dispatcher.
 			defer func() {
+				if processed != nil {
+					processed(idx)
+				}
 				if d.limiter != nil {
 					// Pop an item from the limiter, allowing another update to process.
 					<-d.limiter
@@ -210,25 +275,25 @@ func (d *Dispatcher) Start(b *gotgbot.Bot, updates <-chan json.RawMessage) {
 				d.waitGroup.Done()
 			}()
 
-			err := d.processRawUpdate(b, upd)
+			err := d.processRawUpdate(ctx, b, upd)
 			if err != nil {
-				if d.UnhandledErrFunc != nil {
-					d.UnhandledErrFunc(err)
-				} else {
-					d.logf("Failed to process update: %s", err.Error())
+				attrs := []slog.Attr{slog.Int64(LogKeyBotId, b.Id)}
+				var updErr *UpdateError
+				if errors.As(err, &updErr) {
+					attrs = append(attrs, updErr.attrs()...)
 				}
+				handleUnhandledErr(d.UnhandledErrFunc, d.logger(), "Failed to process update", err, attrs...)
 			}
 
-		}(upd)
+		}(idx, upd)
+		idx++
 	}
 }
 
 // Stop waits for all currently processing updates to finish, and then returns.
+// The dispatcher can be started again afterwards; for example, when a bot is re-added to an Updater.
 func (d *Dispatcher) Stop() {
 	d.waitGroup.Wait()
-	if d.limiter != nil {
-		close(d.limiter)
-	}
 }
 
 // AddHandler adds a new handler to the dispatcher. The dispatcher will call CheckUpdate() to see whether the handler
@@ -242,6 +307,19 @@ func (d *Dispatcher) AddHandlerToGroup(h Handler, group int) {
 	d.handlers.add(h, group)
 }
 
+// Use adds middlewares which apply to all handlers, in all groups. Middlewares are called in the order they are added;
+// global middlewares are called before group middlewares. See Middleware for more details.
+func (d *Dispatcher) Use(mws ...Middleware) {
+	d.handlers.addMiddlewares(mws...)
+}
+
+// UseInGroup adds middlewares which apply to all handlers in a specific group. Group middlewares are kept even if
+// the group is removed, and apply to any handlers which are later added to that group.
+// To add middlewares to a single handler, see WithMiddlewares.
+func (d *Dispatcher) UseInGroup(group int, mws ...Middleware) {
+	d.handlers.addGroupMiddlewares(group, mws...)
+}
+
 // RemoveHandlerFromGroup removes a handler by name from the specified group.
 // If multiple handlers have the same name, only the first one is removed.
 // Returns true if the handler was successfully removed.
@@ -256,44 +334,125 @@ func (d *Dispatcher) RemoveGroup(group int) bool {
 }
 
 // processRawUpdate takes a JSON update to be unmarshalled and processed by Dispatcher.ProcessUpdate.
-func (d *Dispatcher) processRawUpdate(b *gotgbot.Bot, r json.RawMessage) error {
+func (d *Dispatcher) processRawUpdate(parent context.Context, b *gotgbot.Bot, r json.RawMessage) error {
+	_, err := d.processRawUpdateWithFailure(parent, b, r, nil)
+	return err
+}
+
+// processRawUpdateWithFailure is the same as processRawUpdate, but also reports whether the update failed to be
+// processed, even if the failure was handled. Failed updates are stored in the DeadLetters store; if the update is
+// being redriven, the redriven dead letter is updated instead.
+func (d *Dispatcher) processRawUpdateWithFailure(parent context.Context, b *gotgbot.Bot, r json.RawMessage, redriven *DeadLetter) (bool, error) {
 	var upd gotgbot.Update
 	if err := json.Unmarshal(r, &upd); err != nil {
-		return fmt.Errorf("failed to unmarshal update: %w", err)
+		err = fmt.Errorf("failed to unmarshal update: %w", err)
+		if d.DeadLetters != nil {
+			d.saveDeadLetter(b, nil, r, updateFailure{err: err.Error()}, redriven)
+		}
+		return true, err
 	}
 
-	return d.ProcessUpdate(b, &upd, nil)
+	return d.processUpdate(parent, b, &upd, r, nil, redriven)
 }
 
 // ProcessUpdate iterates over the list of groups to execute the matching handlers.
 // This is also where we recover from any panics that are thrown by user code, to avoid taking down the bot.
-func (d *Dispatcher) ProcessUpdate(b *gotgbot.Bot, u *gotgbot.Update, data map[string]interface{}) (err error) {
+func (d *Dispatcher) ProcessUpdate(b *gotgbot.Bot, u *gotgbot.Update, data map[string]interface{}) error {
+	return d.ProcessUpdateWithContext(context.Background(), b, u, data)
+}
+
+// ProcessUpdateWithContext is the same as ProcessUpdate, but the update's Context is derived from the given parent
+// context. The Dispatcher's UpdateTimeout is applied on top of it.
+func (d *Dispatcher) ProcessUpdateWithContext(parent context.Context, b *gotgbot.Bot, u *gotgbot.Update, data map[string]interface{}) error {
+	_, err := d.processUpdate(parent, b, u, nil, data, nil)
+	return err
+}
+
+// processUpdate processes an update, and reports whether it failed to be processed. The raw update is stored in the
+// DeadLetters store on failure; if nil, the update is marshalled instead.
+func (d *Dispatcher) processUpdate(parent context.Context, b *gotgbot.Bot, u *gotgbot.Update, raw json.RawMessage, data map[string]interface{}, redriven *DeadLetter) (failed bool, err error) {
 	ctx := NewContext(b, u, data)
+	ctx.Context = parent
+	if d.UpdateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx.Context, cancel = context.WithTimeout(parent, d.UpdateTimeout)
+		defer cancel()
+	}
 
 	defer func() {
+		// The first handler error is recorded by iterateOverHandlerGroups; panics take precedence over it.
+		failure := ctx.failure
 		if r := recover(); r != nil {
+			stack := cleanedStack()
+			failure = &updateFailure{handler: ctx.handler, err: fmt.Sprintf("%v: %v", ErrPanicRecovered, r), stack: stack}
+
 			// If a panic handler is defined, handle the error.
 			if d.Panic != nil {
 				d.Panic(b, ctx, r)
-				return
-
+				err = nil
 			} else {
 				// Otherwise, create an error from the panic, and return it.
-				err = fmt.Errorf("%w: %v\n%s", ErrPanicRecovered, r, cleanedStack())
-				return
+				err = fmt.Errorf("%w: %v\n%s", ErrPanicRecovered, r, stack)
 			}
+		} else if failure == nil && err != nil {
+			failure = &updateFailure{handler: ctx.handler, err: err.Error()}
+		}
+
+		failed = failure != nil
+		if failed && d.DeadLetters != nil {
+			d.saveDeadLetter(b, u, raw, *failure, redriven)
+		}
+
+		if err != nil {
+			err = &UpdateError{UpdateId: u.UpdateId, Handler: ctx.handler, Err: err}
 		}
 	}()
 
 	err = d.Processor.ProcessUpdate(d, b, ctx)
 	// We don't inline this, because we want to make sure that the defer function can override the error in the case of
 	// a panic.
-	return err
+	return false, err
+}
+
+// UpdateError is returned by the Dispatcher when it fails to process an update, to identify which update and handler
+// caused the failure. Use errors.As to access it from an UnhandledErrFunc.
+type UpdateError struct {
+	// UpdateId is the ID of the update which failed.
+	UpdateId int64
+	// Handler is the name of the handler which was running when the failure happened, if any.
+	Handler string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *UpdateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UpdateError) Unwrap() error {
+	return e.Err
+}
+
+// attrs returns the structured logging attributes describing the error.
+func (e *UpdateError) attrs() []slog.Attr {
+	attrs := []slog.Attr{slog.Int64(LogKeyUpdateId, e.UpdateId)}
+	if e.Handler != "" {
+		attrs = append(attrs, slog.String(LogKeyHandler, e.Handler))
+	}
+	return attrs
 }
 
 func (d *Dispatcher) iterateOverHandlerGroups(b *gotgbot.Bot, ctx *Context) error {
-	for _, groups := range d.handlers.getGroups() {
-		for _, handler := range groups {
+	logger := d.logger()
+	debug := logger.Enabled(ctx, slog.LevelDebug)
+
+	for _, group := range d.handlers.getHandlerGroups() {
+		for _, handler := range group.handlers {
+			if len(group.middlewares) != 0 {
+				handler = WithMiddlewares(handler, group.middlewares...)
+			}
+			ctx.handler = handler.Name()
+
 			if !handler.CheckUpdate(b, ctx) {
 				// Handler filter doesn't match this update; continue.
 				continue
@@ -303,17 +462,30 @@ func (d *Dispatcher) iterateOverHandlerGroups(b *gotgbot.Bot, ctx *Context) erro
 			if err != nil {
 				if errors.Is(err, ContinueGroups) {
 					// Continue handling current group.
+					if debug {
+						d.logRouting(logger, ctx, group.num, "continue_groups")
+					}
 					continue
 
 				} else if errors.Is(err, EndGroups) {
 					// Stop all group handling.
+					if debug {
+						d.logRouting(logger, ctx, group.num, "end_groups")
+					}
 					return nil
 
 				} else {
+					if ctx.failure == nil {
+						ctx.failure = &updateFailure{handler: ctx.handler, err: err.Error()}
+					}
+
 					action := DispatcherActionNoop
 					if d.Error != nil {
 						action = d.Error(b, ctx, err)
 					}
+					if debug {
+						d.logRouting(logger, ctx, group.num, string(action), slog.Any(LogKeyError, err))
+					}
 
 					switch action {
 					case DispatcherActionNoop:
@@ -328,15 +500,31 @@ func (d *Dispatcher) iterateOverHandlerGroups(b *gotgbot.Bot, ctx *Context) erro
 						return fmt.Errorf("%w: '%s', ending groups here", ErrUnknownDispatcherAction, action)
 					}
 				}
+			} else if debug {
+				d.logRouting(logger, ctx, group.num, "next_group")
 			}
 
 			// Handler matched this update, move to next group by default.
 			break
 		}
 	}
+	ctx.handler = ""
 	return nil
 }
 
+// logRouting logs the routing decision made after a handler matched an update, at debug level.
+func (d *Dispatcher) logRouting(logger *slog.Logger, ctx *Context, group int, action string, attrs ...slog.Attr) {
+	logger.LogAttrs(ctx, slog.LevelDebug, "Handler matched update",
+		append([]slog.Attr{
+			slog.Int64(LogKeyBotId, ctx.Bot.Id),
+			slog.Int64(LogKeyUpdateId, ctx.UpdateId),
+			slog.Int(LogKeyGroup, group),
+			slog.String(LogKeyHandler, ctx.handler),
+			slog.String(LogKeyAction, action),
+		}, attrs...)...,
+	)
+}
+
 // cleanedStack obtains a "cleaned" version of the stack trace which doesn't point the last few lines to the library.
 // This is because historically, people see the library in the stack trace, and immediately blame it, when in fact it is
 // recovering their errors.
@@ -1,8 +1,11 @@
 package ext_test
 
 import (
+	"context"
+	"errors"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -180,3 +183,36 @@ func TestDispatcher_RemoveHandlerHandlerFromNonExistingGroup(t *testing.T) {
 		t.Errorf("RemoveHandlerFromGroup() = %v, want false", found)
 	}
 }
+
+func TestDispatcherUpdateTimeout(t *testing.T) {
+	server := basicTestServer(t, map[string]*testEndpoint{
+		"sendMessage": {reply: `{"ok": true, "result": {}}`, delay: time.Second},
+	})
+	defer server.Close()
+
+	b := &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL}},
+	}
+
+	d := ext.NewDispatcher(&ext.DispatcherOpts{UpdateTimeout: 50 * time.Millisecond})
+	var apiErr error
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		// The update's Context is passed to the API call, which should be cancelled at the update deadline.
+		_, apiErr = b.SendMessageWithContext(ctx, ctx.EffectiveChat.Id, "reply", nil)
+		return nil
+	}))
+
+	start := time.Now()
+	err := d.ProcessUpdate(b, &gotgbot.Update{Message: &gotgbot.Message{Text: "test text"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error while processing update: %s", err.Error())
+	}
+
+	if !errors.Is(apiErr, context.DeadlineExceeded) {
+		t.Errorf("expected API call to hit the update deadline, got %v", apiErr)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected API call to be cancelled early, took %s", elapsed)
+	}
+}
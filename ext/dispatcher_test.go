@@ -2,6 +2,8 @@ package ext
 
 import (
 	"encoding/json"
+	"io"
+	"log"
 	"sync"
 	"testing"
 	"time"
@@ -86,3 +88,15 @@ func BenchmarkDispatcher(b *testing.B) {
 	wg.Wait()
 	d.Stop()
 }
+
+func TestDispatcherErrorLogCached(t *testing.T) {
+	d := NewDispatcher(&DispatcherOpts{ErrorLog: log.New(io.Discard, "", 0)})
+	if d.logger() != d.logger() {
+		t.Error("expected the ErrorLog logger to only be created once")
+	}
+
+	other := NewDispatcher(&DispatcherOpts{ErrorLog: log.New(io.Discard, "", 0)})
+	if other.logger() == d.logger() {
+		t.Error("expected each ErrorLog to have its own logger")
+	}
+}
@@ -13,6 +13,11 @@ type handlerMapping struct {
 	handlerGroups []int
 	// handlers represents all available handlers, split into groups (see handlerGroups).
 	handlers map[int][]Handler
+
+	// middlewares represents the middlewares which apply to all handlers.
+	middlewares []Middleware
+	// groupMiddlewares represents the middlewares which apply to all handlers in a specific group.
+	groupMiddlewares map[int][]Middleware
 }
 
 func (m *handlerMapping) add(h Handler, group int) {
@@ -110,3 +115,56 @@ func (m *handlerMapping) getGroups() [][]Handler {
 	}
 	return allHandlers
 }
+
+func (m *handlerMapping) addMiddlewares(mws ...Middleware) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Copy to avoid changing the values of slices which have already been returned by getHandlerGroups.
+	m.middlewares = append(append([]Middleware{}, m.middlewares...), mws...)
+}
+
+func (m *handlerMapping) addGroupMiddlewares(group int, mws ...Middleware) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.groupMiddlewares == nil {
+		m.groupMiddlewares = map[int][]Middleware{}
+	}
+	m.groupMiddlewares[group] = append(append([]Middleware{}, m.groupMiddlewares[group]...), mws...)
+}
+
+// handlerGroup contains the handlers in a group, as well as the middlewares which apply to them.
+type handlerGroup struct {
+	// num is the group number.
+	num int
+	// handlers are the group's handlers, in order.
+	handlers []Handler
+	// middlewares are the middlewares which apply to this group's handlers; global middlewares come first.
+	middlewares []Middleware
+}
+
+// getHandlerGroups returns the handler groups in order, along with the middlewares which apply to them.
+func (m *handlerMapping) getHandlerGroups() []handlerGroup {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	groups := make([]handlerGroup, len(m.handlerGroups))
+	for idx, num := range m.handlerGroups {
+		groups[idx] = handlerGroup{
+			num:      num,
+			handlers: m.handlers[num],
+		}
+
+		groupMws := m.groupMiddlewares[num]
+		switch {
+		case len(groupMws) == 0:
+			groups[idx].middlewares = m.middlewares
+		case len(m.middlewares) == 0:
+			groups[idx].middlewares = groupMws
+		default:
+			groups[idx].middlewares = append(append(make([]Middleware, 0, len(m.middlewares)+len(groupMws)), m.middlewares...), groupMws...)
+		}
+	}
+	return groups
+}
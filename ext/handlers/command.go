@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"sort"
 	"strings"
 	"unicode/utf8"
 
@@ -18,8 +20,24 @@ type Command struct {
 	AllowChannel bool
 	Command      string // set to a lowercase value for case-insensitivity
 	Response     Response
+
+	// Description is the description shown in the bot's command menu. Commands without a description are not listed.
+	// See ext.Dispatcher.SyncCommands for more details.
+	Description string
+	// Scopes defines the scopes in which this command is listed. If empty, the default scope is used.
+	Scopes []gotgbot.BotCommandScope
+	// LanguageDescriptions maps two-letter ISO 639-1 language codes to translated descriptions.
+	LanguageDescriptions map[string]string
+
+	// Args declares the arguments expected by this command. If set, arguments are parsed before calling the Response,
+	// and can be obtained with ParsedArgs.
+	Args []CommandArg
+	// ArgsError handles argument parsing errors. If nil, the command replies with the error and the command usage.
+	ArgsError ArgsErrorHandler
 }
 
+var _ ext.CommandDescriber = Command{}
+
 // NewCommand creates a new case-insensitive command.
 // By default, commands do not work on edited messages, or channel posts. These can be enabled by setting the
 // AllowEdited and AllowChannel fields respectively.
@@ -51,6 +69,74 @@ func (c Command) SetTriggers(triggers []rune) Command {
 	return c
 }
 
+// SetDescription sets the description shown in the bot's command menu.
+func (c Command) SetDescription(description string) Command {
+	c.Description = description
+	return c
+}
+
+// SetScopes sets the list of scopes in which the command is listed in the bot's command menu.
+func (c Command) SetScopes(scopes ...gotgbot.BotCommandScope) Command {
+	c.Scopes = scopes
+	return c
+}
+
+// SetLanguageDescription sets a translated command menu description for users with the given language code.
+func (c Command) SetLanguageDescription(languageCode string, description string) Command {
+	descriptions := make(map[string]string, len(c.LanguageDescriptions)+1)
+	for k, v := range c.LanguageDescriptions {
+		descriptions[k] = v
+	}
+	descriptions[languageCode] = description
+	c.LanguageDescriptions = descriptions
+	return c
+}
+
+// SetArgs declares the arguments expected by this command.
+// An error is returned if the declarations are invalid; for example, if a required argument follows an optional one.
+func (c Command) SetArgs(args ...CommandArg) (Command, error) {
+	if err := validateArgs(args); err != nil {
+		return c, err
+	}
+	c.Args = args
+	return c, nil
+}
+
+// BotCommands returns the command menu entries for this command; one for each scope and language.
+func (c Command) BotCommands() []ext.BotCommandEntry {
+	if c.Description == "" {
+		return nil
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = []gotgbot.BotCommandScope{gotgbot.BotCommandScopeDefault{}}
+	}
+
+	// Sort languages, to keep the output consistent.
+	languages := make([]string, 0, len(c.LanguageDescriptions))
+	for lang := range c.LanguageDescriptions {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	entries := make([]ext.BotCommandEntry, 0, len(scopes)*(len(languages)+1))
+	for _, scope := range scopes {
+		entries = append(entries, ext.BotCommandEntry{
+			BotCommand: gotgbot.BotCommand{Command: c.Command, Description: c.Description},
+			Scope:      scope,
+		})
+		for _, lang := range languages {
+			entries = append(entries, ext.BotCommandEntry{
+				BotCommand:   gotgbot.BotCommand{Command: c.Command, Description: c.LanguageDescriptions[lang]},
+				Scope:        scope,
+				LanguageCode: lang,
+			})
+		}
+	}
+	return entries
+}
+
 func (c Command) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
 	if ctx.Message != nil {
 		if ctx.Message.GetText() == "" {
@@ -85,6 +171,21 @@ func (c Command) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
 }
 
 func (c Command) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	if len(c.Args) != 0 {
+		args, err := c.ParseArgs(ctx.EffectiveMessage)
+		if err != nil {
+			if errors.Is(err, ErrInvalidArgDeclaration) {
+				// This is a mistake in the bot's code, not the user's input.
+				return err
+			}
+			if c.ArgsError != nil {
+				return c.ArgsError(b, ctx, c, err)
+			}
+			return replyUsage(b, ctx, c, err)
+		}
+		ctx.Data[CommandArgsKey] = args
+	}
+
 	return c.Response(b, ctx)
 }
 
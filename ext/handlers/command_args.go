@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/internal/utf16util"
+)
+
+// CommandArgsKey is the ext.Context.Data key under which parsed command arguments are stored.
+const CommandArgsKey = "gotgbot_command_args"
+
+var (
+	ErrMissingArg    = errors.New("missing argument")
+	ErrInvalidArg    = errors.New("invalid argument")
+	ErrTooManyArgs   = errors.New("too many arguments")
+	ErrUnclosedQuote = errors.New("unclosed quote")
+
+	ErrInvalidArgDeclaration = errors.New("invalid argument declaration")
+)
+
+// ArgsErrorHandler handles command argument parsing errors; for example, by replying with the command usage.
+type ArgsErrorHandler func(b *gotgbot.Bot, ctx *ext.Context, c Command, err error) error
+
+// ArgType defines how a command argument should be parsed.
+type ArgType int
+
+const (
+	// ArgString is a single word, or a "double quoted" string.
+	ArgString ArgType = iota
+	// ArgText consumes all the remaining text of the message. It must be the last argument.
+	ArgText
+	// ArgInt is a base 10 integer.
+	ArgInt
+	// ArgFloat is a floating point number.
+	ArgFloat
+	// ArgBool is a boolean, as accepted by strconv.ParseBool, as well as yes/no and on/off.
+	ArgBool
+	// ArgDuration is a duration, as accepted by time.ParseDuration (eg 10m, 1h30m). Plain numbers are read as seconds.
+	ArgDuration
+	// ArgUser is a user reference; either a text_mention entity, an @username mention, or a numeric user ID.
+	ArgUser
+)
+
+// String returns the name used for this type in usage messages.
+func (t ArgType) String() string {
+	switch t {
+	case ArgString:
+		return "string"
+	case ArgText:
+		return "text"
+	case ArgInt:
+		return "integer"
+	case ArgFloat:
+		return "number"
+	case ArgBool:
+		return "yes/no"
+	case ArgDuration:
+		return "duration"
+	case ArgUser:
+		return "user"
+	default:
+		return "unknown"
+	}
+}
+
+// CommandArg declares a single argument of a command.
+type CommandArg struct {
+	// Name identifies the argument; it is used both in usage messages, and to obtain the parsed value.
+	Name string
+	// Type defines how the argument is parsed.
+	Type ArgType
+	// Optional arguments may be omitted. Only trailing arguments can be optional; see Command.SetArgs.
+	Optional bool
+}
+
+// ArgUserValue is the parsed value of an ArgUser argument.
+// Depending on how the user was referenced, only some fields are populated.
+type ArgUserValue struct {
+	// Id is the user's ID, if known (text mentions and numeric IDs).
+	Id int64
+	// Username is the user's username, without the @, if they were mentioned by username.
+	Username string
+	// User is the full user, if they were referenced by a text_mention entity.
+	User *gotgbot.User
+}
+
+// CommandArgs contains the parsed arguments of a command. Getters return the zero value for missing arguments; use
+// Has to check for optional arguments.
+type CommandArgs struct {
+	values map[string]interface{}
+}
+
+// ParsedArgs returns the command arguments which were parsed for the current update, if any.
+func ParsedArgs(ctx *ext.Context) *CommandArgs {
+	if args, ok := ctx.Data[CommandArgsKey].(*CommandArgs); ok {
+		return args
+	}
+	return &CommandArgs{}
+}
+
+// Has returns true if the argument was provided.
+func (a *CommandArgs) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// String returns the value of an ArgString or ArgText argument.
+func (a *CommandArgs) String(name string) string {
+	v, _ := a.values[name].(string)
+	return v
+}
+
+// Int returns the value of an ArgInt argument.
+func (a *CommandArgs) Int(name string) int64 {
+	v, _ := a.values[name].(int64)
+	return v
+}
+
+// Float returns the value of an ArgFloat argument.
+func (a *CommandArgs) Float(name string) float64 {
+	v, _ := a.values[name].(float64)
+	return v
+}
+
+// Bool returns the value of an ArgBool argument.
+func (a *CommandArgs) Bool(name string) bool {
+	v, _ := a.values[name].(bool)
+	return v
+}
+
+// Duration returns the value of an ArgDuration argument.
+func (a *CommandArgs) Duration(name string) time.Duration {
+	v, _ := a.values[name].(time.Duration)
+	return v
+}
+
+// User returns the value of an ArgUser argument.
+func (a *CommandArgs) User(name string) *ArgUserValue {
+	v, _ := a.values[name].(*ArgUserValue)
+	return v
+}
+
+// replyUsage is the default ArgsErrorHandler. It replies to the command with the parsing error, and the usage.
+func replyUsage(b *gotgbot.Bot, ctx *ext.Context, c Command, err error) error {
+	_, err = ctx.EffectiveMessage.Reply(b, err.Error()+"\nUsage: "+c.Usage(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send usage message for command %s: %w", c.Command, err)
+	}
+	return nil
+}
+
+// Usage generates the usage string of a command, based on its declared arguments.
+// For example: "/ban <user:user> [duration:duration] [reason:text]".
+func (c Command) Usage() string {
+	trigger := "/"
+	if len(c.Triggers) > 0 {
+		trigger = string(c.Triggers[0])
+	}
+
+	bd := strings.Builder{}
+	bd.WriteString(trigger + c.Command)
+	for _, arg := range c.Args {
+		open, closing := "<", ">"
+		if arg.Optional {
+			open, closing = "[", "]"
+		}
+		bd.WriteString(" " + open + arg.Name + ":" + arg.Type.String() + closing)
+	}
+	return bd.String()
+}
+
+// validateArgs checks that argument declarations can be parsed unambiguously: only trailing arguments can be optional,
+// and ArgText arguments must come last.
+func validateArgs(args []CommandArg) error {
+	for idx, arg := range args {
+		if arg.Type == ArgText && idx != len(args)-1 {
+			return fmt.Errorf("%w: text argument %s must be the last argument", ErrInvalidArgDeclaration, arg.Name)
+		}
+		if idx > 0 && args[idx-1].Optional && !arg.Optional {
+			return fmt.Errorf("%w: required argument %s follows optional argument %s", ErrInvalidArgDeclaration, arg.Name, args[idx-1].Name)
+		}
+	}
+	return nil
+}
+
+// ParseArgs parses the arguments of a command message, following the command's argument declarations.
+// ErrInvalidArgDeclaration is returned if the declarations themselves are invalid; see Command.SetArgs.
+func (c Command) ParseArgs(msg *gotgbot.Message) (*CommandArgs, error) {
+	if err := validateArgs(c.Args); err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenizeArgs(msg.GetText(), msg.GetEntities())
+	if err != nil {
+		return nil, err
+	}
+	// The first token is always the command itself.
+	if len(tokens) > 0 {
+		tokens = tokens[1:]
+	}
+
+	args := &CommandArgs{values: map[string]interface{}{}}
+	for idx, arg := range c.Args {
+		if idx >= len(tokens) {
+			if arg.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("%w: %s", ErrMissingArg, arg.Name)
+		}
+
+		tok := tokens[idx]
+		if arg.Type == ArgText {
+			args.values[arg.Name] = strings.TrimRightFunc(tok.rest, unicode.IsSpace)
+			// Text arguments consume everything; nothing more to parse.
+			return args, nil
+		}
+
+		v, err := parseArg(arg, tok)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: expected %s, got %q", ErrInvalidArg, arg.Name, arg.Type, tok.value)
+		}
+		args.values[arg.Name] = v
+	}
+
+	if len(tokens) > len(c.Args) {
+		return nil, fmt.Errorf("%w: expected at most %d, got %d", ErrTooManyArgs, len(c.Args), len(tokens))
+	}
+	return args, nil
+}
+
+func parseArg(arg CommandArg, tok argToken) (interface{}, error) {
+	switch arg.Type {
+	case ArgString, ArgText:
+		return tok.value, nil
+
+	case ArgInt:
+		return strconv.ParseInt(tok.value, 10, 64)
+
+	case ArgFloat:
+		return strconv.ParseFloat(tok.value, 64)
+
+	case ArgBool:
+		switch strings.ToLower(tok.value) {
+		case "yes", "y", "on":
+			return true, nil
+		case "no", "n", "off":
+			return false, nil
+		}
+		return strconv.ParseBool(tok.value)
+
+	case ArgDuration:
+		if secs, err := strconv.ParseInt(tok.value, 10, 64); err == nil {
+			return time.Duration(secs) * time.Second, nil
+		}
+		return time.ParseDuration(tok.value)
+
+	case ArgUser:
+		if tok.entity != nil {
+			switch tok.entity.Type {
+			case "text_mention":
+				return &ArgUserValue{Id: tok.entity.User.Id, User: tok.entity.User}, nil
+			case "mention":
+				return &ArgUserValue{Username: strings.TrimPrefix(tok.value, "@")}, nil
+			}
+		}
+		id, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &ArgUserValue{Id: id}, nil
+
+	default:
+		return nil, ErrInvalidArg
+	}
+}
+
+// argToken is a single argument obtained from the message text.
+type argToken struct {
+	// value is the token's value, with quotes removed.
+	value string
+	// rest is the raw remaining text, starting at this token. Used for ArgText arguments.
+	rest string
+	// entity is the mention entity which defines this token, if any.
+	entity *gotgbot.MessageEntity
+}
+
+// tokenizeArgs splits a message into arguments. Words are split on whitespace, "quoted strings" are kept together,
+// and mention entities are always a single token, even if they contain whitespace (as text_mentions often do).
+func tokenizeArgs(text string, entities []gotgbot.MessageEntity) ([]argToken, error) {
+	runes := []rune(text)
+
+	// Map the UTF-16 offsets of mention entities, to be able to find them while iterating over runes.
+	mentions := map[int64]*gotgbot.MessageEntity{}
+	for idx := range entities {
+		if entities[idx].Type == "text_mention" && entities[idx].User != nil || entities[idx].Type == "mention" {
+			mentions[entities[idx].Offset] = &entities[idx]
+		}
+	}
+
+	var tokens []argToken
+	var offset int64 // current position in UTF-16 code units
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			offset += utf16util.RuneLen(runes[i])
+			i++
+			continue
+		}
+
+		start := i
+		if ent, ok := mentions[offset]; ok {
+			// Consume the whole entity.
+			for end := offset + ent.Length; i < len(runes) && offset < end; i++ {
+				offset += utf16util.RuneLen(runes[i])
+			}
+			tokens = append(tokens, argToken{value: string(runes[start:i]), rest: string(runes[start:]), entity: ent})
+			continue
+		}
+
+		if runes[i] == '"' {
+			bd := strings.Builder{}
+			closed := false
+			offset++
+			for i++; i < len(runes); i++ {
+				offset += utf16util.RuneLen(runes[i])
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+					offset += utf16util.RuneLen(runes[i])
+					bd.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				bd.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, ErrUnclosedQuote
+			}
+			tokens = append(tokens, argToken{value: bd.String(), rest: string(runes[start:])})
+			continue
+		}
+
+		for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+			offset += utf16util.RuneLen(runes[i])
+		}
+		tokens = append(tokens, argToken{value: string(runes[start:i]), rest: string(runes[start:])})
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,164 @@
+package handlers_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+func TestCommandArgs(t *testing.T) {
+	b := NewTestBot()
+
+	cmd, err := handlers.NewCommand("remind", nil).SetArgs(
+		handlers.CommandArg{Name: "count", Type: handlers.ArgInt},
+		handlers.CommandArg{Name: "title", Type: handlers.ArgString},
+		handlers.CommandArg{Name: "in", Type: handlers.ArgDuration},
+		handlers.CommandArg{Name: "loud", Type: handlers.ArgBool, Optional: true},
+		handlers.CommandArg{Name: "note", Type: handlers.ArgText, Optional: true},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	for name, test := range map[string]struct {
+		args  []string
+		err   error
+		check func(t *testing.T, args *handlers.CommandArgs)
+	}{
+		"all args": {
+			args: []string{"3", `"buy milk"`, "1h30m", "yes", "some", "extra  text "},
+			check: func(t *testing.T, args *handlers.CommandArgs) {
+				if args.Int("count") != 3 || args.String("title") != "buy milk" || args.Duration("in") != 90*time.Minute {
+					t.Errorf("unexpected values: %v %q %v", args.Int("count"), args.String("title"), args.Duration("in"))
+				}
+				if !args.Bool("loud") || args.String("note") != "some extra  text" {
+					t.Errorf("unexpected optional values: %v %q", args.Bool("loud"), args.String("note"))
+				}
+			},
+		},
+		"optional args omitted": {
+			args: []string{"1", "title", "60"},
+			check: func(t *testing.T, args *handlers.CommandArgs) {
+				if args.Has("loud") || args.Has("note") {
+					t.Errorf("optional args should not be set")
+				}
+				if args.Duration("in") != time.Minute {
+					t.Errorf("plain numbers should be parsed as seconds, got %v", args.Duration("in"))
+				}
+			},
+		},
+		"missing arg": {
+			args: []string{"1", "title"},
+			err:  handlers.ErrMissingArg,
+		},
+		"invalid int": {
+			args: []string{"one", "title", "1m"},
+			err:  handlers.ErrInvalidArg,
+		},
+		"unclosed quote": {
+			args: []string{"1", `"title`, "1m"},
+			err:  handlers.ErrUnclosedQuote,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			ctx := NewCommandMessage(b, 1, 1, "remind", test.args)
+			args, err := cmd.ParseArgs(ctx.EffectiveMessage)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if test.check != nil {
+				test.check(t, args)
+			}
+		})
+	}
+
+	if usage := cmd.Usage(); usage != "/remind <count:integer> <title:string> <in:duration> [loud:yes/no] [note:text]" {
+		t.Errorf("unexpected usage: %s", usage)
+	}
+}
+
+func TestCommandArgsMentions(t *testing.T) {
+	b := NewTestBot()
+
+	var user *handlers.ArgUserValue
+	var reason string
+	cmd, err := handlers.NewCommand("ban", func(b *gotgbot.Bot, ctx *ext.Context) error {
+		user = handlers.ParsedArgs(ctx).User("user")
+		reason = handlers.ParsedArgs(ctx).String("reason")
+		return nil
+	}).SetArgs(
+		handlers.CommandArg{Name: "user", Type: handlers.ArgUser},
+		handlers.CommandArg{Name: "reason", Type: handlers.ArgText, Optional: true},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Text mentions contain spaces, and non-BMP characters shift the UTF-16 offsets.
+	text := "/ban 🦊 Fox McFox spamming"
+	mentionOffset := int64(len(utf16.Encode([]rune("/ban "))))
+	ctx := NewCommandMessage(b, 1, 1, "ban", nil)
+	ctx.EffectiveMessage.Text = text
+	ctx.EffectiveMessage.Entities = append(ctx.EffectiveMessage.Entities, gotgbot.MessageEntity{
+		Type:   "text_mention",
+		Offset: mentionOffset,
+		Length: int64(len(utf16.Encode([]rune("🦊 Fox McFox")))),
+		User:   &gotgbot.User{Id: 42, FirstName: "Fox"},
+	})
+
+	if err := cmd.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if user == nil || user.Id != 42 || user.User == nil {
+		t.Fatalf("expected text mention to be parsed, got %+v", user)
+	}
+	if reason != "spamming" {
+		t.Errorf("expected reason to be parsed after the mention, got %q", reason)
+	}
+
+	// Errors are handled by the ArgsError handler, if set.
+	var argsErr error
+	cmd.ArgsError = func(b *gotgbot.Bot, ctx *ext.Context, c handlers.Command, err error) error {
+		argsErr = err
+		return nil
+	}
+	if err := cmd.HandleUpdate(b, NewCommandMessage(b, 1, 1, "ban", []string{"bob"})); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !errors.Is(argsErr, handlers.ErrInvalidArg) {
+		t.Errorf("expected invalid arg error, got %v", argsErr)
+	}
+}
+
+func TestCommandArgsDeclaration(t *testing.T) {
+	for name, args := range map[string][]handlers.CommandArg{
+		"required after optional": {
+			{Name: "user", Type: handlers.ArgUser, Optional: true},
+			{Name: "duration", Type: handlers.ArgDuration},
+		},
+		"text before other args": {
+			{Name: "reason", Type: handlers.ArgText},
+			{Name: "duration", Type: handlers.ArgDuration},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := handlers.NewCommand("ban", nil).SetArgs(args...); !errors.Is(err, handlers.ErrInvalidArgDeclaration) {
+				t.Errorf("expected invalid declaration error, got %v", err)
+			}
+
+			// Args set directly are also checked before parsing.
+			b := NewTestBot()
+			cmd := handlers.NewCommand("ban", nil)
+			cmd.Args = args
+			if err := cmd.HandleUpdate(b, NewCommandMessage(b, 1, 1, "ban", []string{"1", "2"})); !errors.Is(err, handlers.ErrInvalidArgDeclaration) {
+				t.Errorf("expected invalid declaration error, got %v", err)
+			}
+		})
+	}
+}
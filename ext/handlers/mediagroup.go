@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/mediagroup"
+)
+
+const (
+	// DefaultMediaGroupQuietPeriod is the default time to wait for more messages of a media group.
+	DefaultMediaGroupQuietPeriod = time.Second
+	// MaxMediaGroupSize is the maximum number of messages in a media group; complete groups are handled immediately.
+	MaxMediaGroupSize = 10
+)
+
+// MediaGroupResponse is the response of a MediaGroup handler. It is called once per media group, with all its messages
+// sorted by message ID; the context is the one of the first message received.
+type MediaGroupResponse func(b *gotgbot.Bot, ctx *ext.Context, msgs []*gotgbot.Message) error
+
+// The MediaGroup handler aggregates the messages of a media group (album). Telegram sends each media item as a
+// separate message, which share a MediaGroupId; this handler buffers them, per chat, until no new messages have been
+// received for the QuietPeriod, and then calls the Response once with all of them.
+//
+// Messages without a MediaGroupId are not handled.
+//
+// Note: The first message of each group waits in its HandleUpdate call until the group is complete. The dispatcher
+// must therefore process updates concurrently (which is the default), so that the following messages can be added.
+// If the update's context is cancelled while waiting (eg because the updater is stopping), the group is dropped.
+type MediaGroup struct {
+	AllowChannel  bool
+	AllowBusiness bool
+	Filter        filters.Message
+	Response      MediaGroupResponse
+	// QuietPeriod is how long to wait for more messages after the last message of a group was received.
+	QuietPeriod time.Duration
+	// Buffer is responsible for storing the messages of groups which are still being received.
+	Buffer mediagroup.Buffer
+}
+
+// MediaGroupOpts contains the optional fields for the NewMediaGroup constructor.
+type MediaGroupOpts struct {
+	// QuietPeriod is how long to wait for more messages after the last message of a group was received.
+	// Defaults to DefaultMediaGroupQuietPeriod.
+	QuietPeriod time.Duration
+	// Buffer is responsible for storing the messages of groups which are still being received. Defaults to an
+	// in-memory buffer; use a shared buffer when running multiple bot replicas.
+	Buffer mediagroup.Buffer
+}
+
+func NewMediaGroup(f filters.Message, r MediaGroupResponse, opts *MediaGroupOpts) MediaGroup {
+	m := MediaGroup{
+		Filter:      f,
+		Response:    r,
+		QuietPeriod: DefaultMediaGroupQuietPeriod,
+		Buffer:      mediagroup.NewInMemoryBuffer(),
+	}
+
+	if opts != nil {
+		if opts.QuietPeriod > 0 {
+			m.QuietPeriod = opts.QuietPeriod
+		}
+		if opts.Buffer != nil {
+			m.Buffer = opts.Buffer
+		}
+	}
+
+	return m
+}
+
+// SetAllowChannel Enables channel posts for this handler.
+func (m MediaGroup) SetAllowChannel(allow bool) MediaGroup {
+	m.AllowChannel = allow
+	return m
+}
+
+// SetAllowBusiness Enables business messages for this handler.
+func (m MediaGroup) SetAllowBusiness(allow bool) MediaGroup {
+	m.AllowBusiness = allow
+	return m
+}
+
+// message returns the message of the update, if it is one this handler is allowed to handle.
+func (m MediaGroup) message(ctx *ext.Context) *gotgbot.Message {
+	switch {
+	case ctx.Message != nil:
+		return ctx.Message
+	case m.AllowChannel && ctx.ChannelPost != nil:
+		return ctx.ChannelPost
+	case m.AllowBusiness && ctx.BusinessMessage != nil:
+		return ctx.BusinessMessage
+	default:
+		return nil
+	}
+}
+
+func (m MediaGroup) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	msg := m.message(ctx)
+	if msg == nil || msg.MediaGroupId == "" {
+		return false
+	}
+	return m.Filter == nil || m.Filter(msg)
+}
+
+func (m MediaGroup) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := m.message(ctx)
+	key := strconv.FormatInt(msg.Chat.Id, 10) + ":" + msg.MediaGroupId
+
+	first, err := m.Buffer.Add(key, *msg)
+	if err != nil {
+		return fmt.Errorf("failed to buffer media group message: %w", err)
+	}
+	if !first {
+		// The handler call for the first message is responsible for the whole group.
+		return nil
+	}
+
+	quietPeriod := m.QuietPeriod
+	if quietPeriod <= 0 {
+		quietPeriod = DefaultMediaGroupQuietPeriod
+	}
+
+	for {
+		msgs, updated, err := m.Buffer.Get(key)
+		if err != nil {
+			if errors.Is(err, mediagroup.ErrKeyNotFound) {
+				// Another handler already took the group.
+				return nil
+			}
+			return fmt.Errorf("failed to get buffered media group: %w", err)
+		}
+
+		wait := time.Until(updated.Add(quietPeriod))
+		if wait <= 0 || len(msgs) >= MaxMediaGroupSize {
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// Don't leave the incomplete group behind; nobody else will handle it.
+			if _, err = m.Buffer.Take(key); err != nil && !errors.Is(err, mediagroup.ErrKeyNotFound) {
+				return fmt.Errorf("failed to remove buffered media group: %w", err)
+			}
+			return fmt.Errorf("media group %s was not handled: %w", msg.MediaGroupId, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	msgs, err := m.Buffer.Take(key)
+	if err != nil {
+		if errors.Is(err, mediagroup.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to take buffered media group: %w", err)
+	}
+
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].MessageId < msgs[j].MessageId
+	})
+	group := make([]*gotgbot.Message, len(msgs))
+	for idx := range msgs {
+		group[idx] = &msgs[idx]
+	}
+	return m.Response(b, ctx, group)
+}
+
+func (m MediaGroup) Name() string {
+	return fmt.Sprintf("mediagroup_%p", m.Response)
+}
@@ -0,0 +1,74 @@
+package mediagroup
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+var ErrKeyNotFound = errors.New("media group key not found")
+
+// InMemoryBuffer is a thread-safe in-memory implementation of the Buffer interface.
+type InMemoryBuffer struct {
+	// groups is a map of key -> media group.
+	groups map[string]*group
+	// lock allows us to ensure synchronous data access.
+	lock sync.Mutex
+}
+
+type group struct {
+	messages []gotgbot.Message
+	updated  time.Time
+}
+
+func NewInMemoryBuffer() *InMemoryBuffer {
+	return &InMemoryBuffer{
+		groups: map[string]*group{},
+	}
+}
+
+func (b *InMemoryBuffer) Add(key string, msg gotgbot.Message) (bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.groups == nil {
+		b.groups = map[string]*group{}
+	}
+
+	g, ok := b.groups[key]
+	if !ok {
+		g = &group{}
+		b.groups[key] = g
+	}
+	g.messages = append(g.messages, msg)
+	g.updated = time.Now()
+	return !ok, nil
+}
+
+func (b *InMemoryBuffer) Get(key string) ([]gotgbot.Message, time.Time, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, ok := b.groups[key]
+	if !ok {
+		return nil, time.Time{}, ErrKeyNotFound
+	}
+
+	msgs := make([]gotgbot.Message, len(g.messages))
+	copy(msgs, g.messages)
+	return msgs, g.updated, nil
+}
+
+func (b *InMemoryBuffer) Take(key string) ([]gotgbot.Message, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	g, ok := b.groups[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	delete(b.groups, key)
+	return g.messages, nil
+}
@@ -0,0 +1,27 @@
+package mediagroup
+
+import (
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Buffer stores the messages of media groups while they are being received.
+// The default implementation is in-memory; to share media groups between multiple bot replicas (eg behind a webhook
+// load balancer), implement this interface with a shared backend of your choice.
+// Note: Make sure to store the entire Message struct, so that the grouped handler receives the full messages.
+type Buffer interface {
+	// Add appends a message to the media group with the given key. It returns true if this message started a new
+	// group; the caller is then responsible for flushing the group once it is complete.
+	Add(key string, msg gotgbot.Message) (bool, error)
+
+	// Get returns all the messages of a media group, along with the time at which the last message was added.
+	// If the key is not found, this method should return the ErrKeyNotFound error.
+	Get(key string) ([]gotgbot.Message, time.Time, error)
+
+	// Take atomically removes the media group from the buffer, and returns all its messages. Messages which are added
+	// concurrently must either be returned, or start a new group.
+	// If the key is not found (eg because the group was already taken), this method should return the ErrKeyNotFound
+	// error.
+	Take(key string) ([]gotgbot.Message, error)
+}
@@ -0,0 +1,138 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/mediagroup"
+)
+
+func newMediaGroupMessage(b *gotgbot.Bot, chatId int64, messageId int64, mediaGroupId string) *ext.Context {
+	ctx := NewMessage(b, 1, chatId, "")
+	ctx.EffectiveMessage.MessageId = messageId
+	ctx.EffectiveMessage.MediaGroupId = mediaGroupId
+	ctx.EffectiveMessage.Photo = []gotgbot.PhotoSize{{FileId: "file"}}
+	return ctx
+}
+
+func TestMediaGroup(t *testing.T) {
+	b := NewTestBot()
+
+	// Multiple handlers sharing a buffer act as separate bot replicas.
+	buffer := mediagroup.NewInMemoryBuffer()
+	var lock sync.Mutex
+	var groups [][]int64
+	response := func(b *gotgbot.Bot, ctx *ext.Context, msgs []*gotgbot.Message) error {
+		var ids []int64
+		for _, msg := range msgs {
+			ids = append(ids, msg.MessageId)
+		}
+		lock.Lock()
+		groups = append(groups, ids)
+		lock.Unlock()
+		return nil
+	}
+	replicas := []handlers.MediaGroup{
+		handlers.NewMediaGroup(nil, response, &handlers.MediaGroupOpts{QuietPeriod: 50 * time.Millisecond, Buffer: buffer}),
+		handlers.NewMediaGroup(nil, response, &handlers.MediaGroupOpts{QuietPeriod: 50 * time.Millisecond, Buffer: buffer}),
+	}
+
+	if replicas[0].CheckUpdate(b, NewMessage(b, 1, 1, "not an album")) {
+		t.Errorf("messages without a media group should not be handled")
+	}
+
+	wg := sync.WaitGroup{}
+	for idx, ctx := range []*ext.Context{
+		newMediaGroupMessage(b, 1, 3, "album"),
+		newMediaGroupMessage(b, 1, 1, "album"),
+		newMediaGroupMessage(b, 2, 4, "album"), // Same group ID, in a different chat.
+		newMediaGroupMessage(b, 1, 2, "album"),
+	} {
+		h := replicas[idx%len(replicas)]
+		if !h.CheckUpdate(b, ctx) {
+			t.Fatalf("media group message %d should be handled", idx)
+		}
+
+		wg.Add(1)
+		go func(ctx *ext.Context) {
+			defer wg.Done()
+			if err := h.HandleUpdate(b, ctx); err != nil {
+				t.Errorf("unexpected error: %s", err.Error())
+			}
+		}(ctx)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 media groups, got %v", groups)
+	}
+	for _, ids := range groups {
+		if len(ids) == 3 && (ids[0] != 1 || ids[1] != 2 || ids[2] != 3) {
+			t.Errorf("expected sorted media group messages, got %v", ids)
+		}
+	}
+	if len(groups[0])+len(groups[1]) != 4 {
+		t.Errorf("expected all messages to be handled, got %v", groups)
+	}
+}
+
+func TestMediaGroupCancelled(t *testing.T) {
+	b := NewTestBot()
+	buffer := mediagroup.NewInMemoryBuffer()
+	h := handlers.NewMediaGroup(nil, func(b *gotgbot.Bot, ctx *ext.Context, msgs []*gotgbot.Message) error {
+		t.Errorf("cancelled media groups should not be handled")
+		return nil
+	}, &handlers.MediaGroupOpts{QuietPeriod: time.Hour, Buffer: buffer})
+
+	ctx := newMediaGroupMessage(b, 1, 1, "album")
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx.Context = cancelCtx
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- h.HandleUpdate(b, ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context cancelled error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected handler to stop waiting once cancelled")
+	}
+	if _, _, err := buffer.Get("1:album"); !errors.Is(err, mediagroup.ErrKeyNotFound) {
+		t.Errorf("expected cancelled group to be removed, got %v", err)
+	}
+}
+
+func TestInMemoryBufferTake(t *testing.T) {
+	buffer := mediagroup.NewInMemoryBuffer()
+	for idx, id := range []int64{1, 2} {
+		first, err := buffer.Add("key", gotgbot.Message{MessageId: id})
+		if err != nil || first != (idx == 0) {
+			t.Fatalf("unexpected result when adding message %d: %v, %v", id, first, err)
+		}
+	}
+
+	msgs, err := buffer.Take("key")
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("expected to take 2 messages, got %v, %v", msgs, err)
+	}
+	// Groups can only be taken once; later messages start a new group.
+	if _, err = buffer.Take("key"); !errors.Is(err, mediagroup.ErrKeyNotFound) {
+		t.Errorf("expected group to be removed, got %v", err)
+	}
+	if first, err := buffer.Add("key", gotgbot.Message{MessageId: 3}); err != nil || !first {
+		t.Errorf("expected a new group to be started, got %v, %v", first, err)
+	}
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// DefaultMenuPageSize is the number of items shown on each menu page, if not otherwise specified.
+	DefaultMenuPageSize = 5
+
+	// menuActionPage is the callback action used to navigate to another page.
+	menuActionPage = "p"
+	// menuActionSelect is the callback action used when an item is selected.
+	menuActionSelect = "s"
+	// menuActionNoop is the callback action used by buttons which do nothing, such as the page counter.
+	menuActionNoop = "n"
+)
+
+var (
+	ErrInvalidMenuData = errors.New("invalid menu callback data")
+	ErrMenuMissingChat = errors.New("no chat to send menu to")
+)
+
+// MenuItem represents a single selectable entry in a Menu.
+type MenuItem struct {
+	// ID identifies the item in the callback data sent when it is selected.
+	// Keep this short; telegram limits callback data to 64 bytes, which also has to contain the menu ID and page.
+	ID string
+	// Text is the default label of the item's button.
+	Text string
+}
+
+// MenuPage is the result of fetching a single page of menu items.
+type MenuPage struct {
+	// Items contains the items to show on the current page.
+	Items []MenuItem
+	// Total is the total number of items across all pages.
+	// If unknown, leave this as 0 and set HasMore instead.
+	Total int
+	// HasMore marks that more pages are available after this one. Only used if Total is 0.
+	HasMore bool
+}
+
+type (
+	// MenuFetchFunc fetches the requested (0-indexed) page of items.
+	MenuFetchFunc func(b *gotgbot.Bot, ctx *ext.Context, page int, pageSize int) (*MenuPage, error)
+	// MenuItemRenderer renders a single item into the inline button shown for it.
+	// The returned button's callback data is always overwritten by the menu.
+	MenuItemRenderer func(item MenuItem) gotgbot.InlineKeyboardButton
+	// MenuTextFunc generates the message text shown above a menu page.
+	MenuTextFunc func(page int, pageCount int) string
+	// MenuSelectFunc is called when an item is selected.
+	// It is responsible for answering the callback query.
+	MenuSelectFunc func(b *gotgbot.Bot, ctx *ext.Context, itemID string) error
+)
+
+// Menu is a handler for paginated inline menus; lists of items with "previous" and "next" buttons.
+// It generates the menu keyboards, and handles all the callback queries they trigger. Page navigation is handled
+// internally by editing the menu message; item selections are passed on to the OnSelect function.
+//
+// The Menu must be added to the dispatcher for navigation to work. Send the first page with Menu.Send.
+type Menu struct {
+	// ID uniquely identifies this menu; it is used as a prefix for all callback data.
+	ID string
+	// Fetch obtains the items for each page.
+	Fetch MenuFetchFunc
+	// OnSelect is called when a user presses one of the items.
+	OnSelect MenuSelectFunc
+
+	// The following are all optional fields:
+	// Render generates the button for each item. Defaults to a button with the item's text.
+	Render MenuItemRenderer
+	// Text generates the message text for each page. If nil, only the message's keyboard is edited on navigation.
+	Text MenuTextFunc
+	// PageSize is the number of items to show per page.
+	PageSize int
+	// Columns is the number of item buttons per row.
+	Columns int
+	// PrevText is the text of the "previous page" button.
+	PrevText string
+	// NextText is the text of the "next page" button.
+	NextText string
+}
+
+// MenuOpts contains all optional fields for the NewMenu method.
+type MenuOpts struct {
+	// Render generates the button for each item. Defaults to a button with the item's text.
+	Render MenuItemRenderer
+	// Text generates the message text for each page. If nil, only the message's keyboard is edited on navigation.
+	Text MenuTextFunc
+	// PageSize is the number of items to show per page. Defaults to DefaultMenuPageSize.
+	PageSize int
+	// Columns is the number of item buttons per row. Defaults to 1.
+	Columns int
+	// PrevText is the text of the "previous page" button. Defaults to "«".
+	PrevText string
+	// NextText is the text of the "next page" button. Defaults to "»".
+	NextText string
+}
+
+// NewMenu creates a new paginated menu handler. The id should be short and unique across all menus, since it is
+// included in all callback data.
+func NewMenu(id string, fetch MenuFetchFunc, onSelect MenuSelectFunc, opts *MenuOpts) Menu {
+	m := Menu{
+		ID:       id,
+		Fetch:    fetch,
+		OnSelect: onSelect,
+		PageSize: DefaultMenuPageSize,
+		Columns:  1,
+		PrevText: "«",
+		NextText: "»",
+	}
+
+	if opts != nil {
+		m.Render = opts.Render
+		m.Text = opts.Text
+		if opts.PageSize > 0 {
+			m.PageSize = opts.PageSize
+		}
+		if opts.Columns > 0 {
+			m.Columns = opts.Columns
+		}
+		if opts.PrevText != "" {
+			m.PrevText = opts.PrevText
+		}
+		if opts.NextText != "" {
+			m.NextText = opts.NextText
+		}
+	}
+
+	return m
+}
+
+// Send sends the first page of the menu to the current chat.
+// The text parameter is used as the message text, unless the menu defines its own Text function.
+func (m Menu) Send(b *gotgbot.Bot, ctx *ext.Context, text string, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+	if ctx.EffectiveChat == nil {
+		return nil, fmt.Errorf("cannot send menu %s: %w", m.ID, ErrMenuMissingChat)
+	}
+
+	pageText, markup, err := m.Page(b, ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	if m.Text != nil {
+		text = pageText
+	}
+
+	// Copy the opts, to avoid modifying the caller's values.
+	var sendOpts gotgbot.SendMessageOpts
+	if opts != nil {
+		sendOpts = *opts
+	}
+	sendOpts.ReplyMarkup = markup
+
+	return b.SendMessage(ctx.EffectiveChat.Id, text, &sendOpts)
+}
+
+// Page fetches and renders the requested page, returning the message text and keyboard to use.
+// The text is empty if the menu has no Text function.
+// This can be used to embed the menu in custom messages.
+func (m Menu) Page(b *gotgbot.Bot, ctx *ext.Context, page int) (string, gotgbot.InlineKeyboardMarkup, error) {
+	pageSize := m.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultMenuPageSize
+	}
+
+	p, err := m.Fetch(b, ctx, page, pageSize)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, fmt.Errorf("failed to fetch page %d of menu %s: %w", page, m.ID, err)
+	}
+
+	pageCount := 0
+	hasNext := p.HasMore
+	if p.Total > 0 {
+		pageCount = (p.Total + pageSize - 1) / pageSize
+		hasNext = page+1 < pageCount
+	}
+
+	kb := gotgbot.NewInlineKeyboard().Columns(m.Columns)
+	for _, item := range p.Items {
+		button := gotgbot.InlineKeyboardButton{Text: item.Text}
+		if m.Render != nil {
+			button = m.Render(item)
+		}
+		button.CallbackData = m.callbackData(menuActionSelect, page, item.ID)
+		kb.Add(button)
+	}
+
+	if page > 0 || hasNext {
+		kb.Columns(0).Row()
+		if page > 0 {
+			kb.Callback(m.PrevText, m.callbackData(menuActionPage, page-1, ""))
+		}
+		if pageCount > 0 {
+			kb.Callback(strconv.Itoa(page+1)+"/"+strconv.Itoa(pageCount), m.callbackData(menuActionNoop, page, ""))
+		}
+		if hasNext {
+			kb.Callback(m.NextText, m.callbackData(menuActionPage, page+1, ""))
+		}
+	}
+
+	markup, err := kb.Build()
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, fmt.Errorf("failed to build keyboard for page %d of menu %s: %w", page, m.ID, err)
+	}
+
+	text := ""
+	if m.Text != nil {
+		text = m.Text(page, pageCount)
+	}
+	return text, markup, nil
+}
+
+func (m Menu) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	return ctx.CallbackQuery != nil && strings.HasPrefix(ctx.CallbackQuery.Data, m.ID+":")
+}
+
+func (m Menu) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+
+	action, page, itemID, err := m.parseCallbackData(cq.Data)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case menuActionSelect:
+		if m.OnSelect == nil {
+			_, err = cq.Answer(b, nil)
+			return err
+		}
+		return m.OnSelect(b, ctx, itemID)
+
+	case menuActionPage:
+		if err := m.showPage(b, ctx, page); err != nil {
+			return err
+		}
+	}
+
+	_, err = cq.Answer(b, nil)
+	if err != nil {
+		return fmt.Errorf("failed to answer menu callback query: %w", err)
+	}
+	return nil
+}
+
+func (m Menu) Name() string {
+	return "menu_" + m.ID
+}
+
+// showPage edits the menu message to display the requested page.
+func (m Menu) showPage(b *gotgbot.Bot, ctx *ext.Context, page int) error {
+	cq := ctx.CallbackQuery
+
+	text, markup, err := m.Page(b, ctx, page)
+	if err != nil {
+		return err
+	}
+
+	var chatId, msgId int64
+	if cq.Message != nil {
+		chatId = cq.Message.GetChat().Id
+		msgId = cq.Message.GetMessageId()
+	}
+
+	if m.Text != nil {
+		_, _, err = b.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+			ChatId:          chatId,
+			MessageId:       msgId,
+			InlineMessageId: cq.InlineMessageId,
+			ReplyMarkup:     markup,
+		})
+	} else {
+		_, _, err = b.EditMessageReplyMarkup(&gotgbot.EditMessageReplyMarkupOpts{
+			ChatId:          chatId,
+			MessageId:       msgId,
+			InlineMessageId: cq.InlineMessageId,
+			ReplyMarkup:     markup,
+		})
+	}
+	if err != nil && !isMessageNotModified(err) {
+		return fmt.Errorf("failed to edit menu %s to page %d: %w", m.ID, page, err)
+	}
+	return nil
+}
+
+// callbackData generates the callback data for a given action. The item ID is always last, so it may contain any
+// characters.
+func (m Menu) callbackData(action string, page int, itemID string) string {
+	data := m.ID + ":" + action + ":" + strconv.Itoa(page)
+	if itemID != "" {
+		data += ":" + itemID
+	}
+	return data
+}
+
+// parseCallbackData extracts the action, page and item ID from the menu's callback data.
+func (m Menu) parseCallbackData(data string) (string, int, string, error) {
+	split := strings.SplitN(strings.TrimPrefix(data, m.ID+":"), ":", 3)
+	if len(split) < 2 {
+		return "", 0, "", fmt.Errorf("%w: %q", ErrInvalidMenuData, data)
+	}
+
+	page, err := strconv.Atoi(split[1])
+	if err != nil || page < 0 {
+		return "", 0, "", fmt.Errorf("%w: bad page in %q", ErrInvalidMenuData, data)
+	}
+
+	var itemID string
+	if len(split) == 3 {
+		itemID = split[2]
+	}
+
+	switch split[0] {
+	case menuActionPage, menuActionNoop:
+		return split[0], page, itemID, nil
+	case menuActionSelect:
+		if itemID == "" {
+			return "", 0, "", fmt.Errorf("%w: missing item in %q", ErrInvalidMenuData, data)
+		}
+		return split[0], page, itemID, nil
+	default:
+		return "", 0, "", fmt.Errorf("%w: unknown action in %q", ErrInvalidMenuData, data)
+	}
+}
+
+// isMessageNotModified checks whether an edit failed because the new contents are identical to the existing ones.
+// This happens when users double-tap navigation buttons, and can safely be ignored.
+func isMessageNotModified(err error) bool {
+	var tgErr *gotgbot.TelegramError
+	return errors.As(err, &tgErr) && strings.Contains(tgErr.Description, "message is not modified")
+}
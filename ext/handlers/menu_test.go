@@ -0,0 +1,153 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+func TestMenuNavigation(t *testing.T) {
+	var mu sync.Mutex
+	var edits []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch method {
+		case "editMessageReplyMarkup":
+			var params map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&params)
+			mu.Lock()
+			edits = append(edits, params["reply_markup"])
+			mu.Unlock()
+			// Emulate a double-tap; the markup has not changed.
+			_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: message is not modified"}`))
+		case "answerCallbackQuery":
+			_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	b := NewTestBot()
+	b.BotClient = &gotgbot.BaseBotClient{
+		DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL},
+	}
+
+	items := make([]handlers.MenuItem, 12)
+	for i := range items {
+		items[i] = handlers.MenuItem{ID: strconv.Itoa(i), Text: "item " + strconv.Itoa(i)}
+	}
+
+	var selected string
+	menu := handlers.NewMenu("items",
+		func(b *gotgbot.Bot, ctx *ext.Context, page int, pageSize int) (*handlers.MenuPage, error) {
+			end := (page + 1) * pageSize
+			if end > len(items) {
+				end = len(items)
+			}
+			return &handlers.MenuPage{Items: items[page*pageSize : end], Total: len(items)}, nil
+		},
+		func(b *gotgbot.Bot, ctx *ext.Context, itemID string) error {
+			selected = itemID
+			return nil
+		},
+		nil,
+	)
+
+	ctx := NewMessage(b, 1, 1, "items")
+	_, markup, err := menu.Page(b, ctx, 0)
+	if err != nil {
+		t.Fatalf("failed to render first page: %s", err.Error())
+	}
+	// 5 items, and one navigation row.
+	if len(markup.InlineKeyboard) != handlers.DefaultMenuPageSize+1 {
+		t.Fatalf("expected %d rows, got %d", handlers.DefaultMenuPageSize+1, len(markup.InlineKeyboard))
+	}
+	nav := markup.InlineKeyboard[len(markup.InlineKeyboard)-1]
+	if len(nav) != 2 || nav[0].Text != "1/3" {
+		t.Fatalf("expected page counter and next button on first page, got %+v", nav)
+	}
+
+	// Press "next"; the edit returns "message is not modified", which should be ignored.
+	next := newCallbackQuery(b, nav[1].CallbackData)
+	if !menu.CheckUpdate(b, next) {
+		t.Fatalf("menu should handle its own navigation callbacks")
+	}
+	if err := menu.HandleUpdate(b, next); err != nil {
+		t.Fatalf("unexpected error navigating menu: %s", err.Error())
+	}
+	if len(edits) != 1 || !strings.Contains(edits[0], "item 5") {
+		t.Fatalf("expected the second page to be shown, got edits %v", edits)
+	}
+
+	// Select the first item of the first page.
+	sel := newCallbackQuery(b, markup.InlineKeyboard[0][0].CallbackData)
+	if err := menu.HandleUpdate(b, sel); err != nil {
+		t.Fatalf("unexpected error selecting item: %s", err.Error())
+	}
+	if selected != "0" {
+		t.Errorf("expected item 0 to be selected, got %q", selected)
+	}
+
+	if menu.CheckUpdate(b, newCallbackQuery(b, "other:p:1")) {
+		t.Errorf("menu should not handle callbacks from other menus")
+	}
+}
+
+func newCallbackQuery(b *gotgbot.Bot, data string) *ext.Context {
+	return ext.NewContext(b, &gotgbot.Update{
+		CallbackQuery: &gotgbot.CallbackQuery{
+			Id:   "id",
+			From: gotgbot.User{Id: 1, FirstName: "bob"},
+			Message: gotgbot.Message{
+				MessageId: 10,
+				Date:      1,
+				Chat:      gotgbot.Chat{Id: 1, Type: "private"},
+			},
+			Data: data,
+		},
+	}, nil)
+}
+
+func TestMenuSendOpts(t *testing.T) {
+	var sent map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 1}}`))
+	}))
+	defer server.Close()
+
+	b := NewTestBot()
+	b.BotClient = &gotgbot.BaseBotClient{
+		DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL},
+	}
+
+	menu := handlers.NewMenu("items",
+		func(b *gotgbot.Bot, ctx *ext.Context, page int, pageSize int) (*handlers.MenuPage, error) {
+			return &handlers.MenuPage{Items: []handlers.MenuItem{{ID: "0", Text: "item 0"}}}, nil
+		},
+		func(b *gotgbot.Bot, ctx *ext.Context, itemID string) error {
+			return nil
+		},
+		nil,
+	)
+
+	opts := &gotgbot.SendMessageOpts{ParseMode: gotgbot.ParseModeHTML}
+	if _, err := menu.Send(b, NewMessage(b, 1, 1, "items"), "<b>items</b>", opts); err != nil {
+		t.Fatalf("failed to send menu: %s", err.Error())
+	}
+	if sent["parse_mode"] != gotgbot.ParseModeHTML || !strings.Contains(sent["reply_markup"], "item 0") {
+		t.Errorf("expected menu to be sent with the given opts, got %v", sent)
+	}
+	if opts.ReplyMarkup != nil {
+		t.Errorf("expected caller's opts to be left unchanged, got reply markup %v", opts.ReplyMarkup)
+	}
+}
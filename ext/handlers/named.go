@@ -21,3 +21,11 @@ func NewNamedhandler(name string, handler ext.Handler) Named {
 		Handler:    handler,
 	}
 }
+
+// BotCommands exposes the command menu entries of the wrapped handler, if it has any.
+func (n Named) BotCommands() []ext.BotCommandEntry {
+	if d, ok := n.Handler.(ext.CommandDescriber); ok {
+		return d.BotCommands()
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package ext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	// DefaultPollingTimeout is the default maximum time since the last successful getUpdates call of a polling bot.
+	DefaultPollingTimeout = 2 * time.Minute
+	// DefaultWebhookInfoCacheDuration is the default time for which getWebhookInfo results are reused by readiness checks.
+	DefaultWebhookInfoCacheDuration = 30 * time.Second
+)
+
+// The modes reported in BotReadiness.
+const (
+	BotModePolling = "polling"
+	BotModeWebhook = "webhook"
+)
+
+// HealthOpts can be used to configure the readiness checks of an Updater.
+type HealthOpts struct {
+	// PollingTimeout is the maximum time since the last successful getUpdates call before a polling bot is reported
+	// as not ready. It should be longer than the getUpdates timeout.
+	// Defaults to DefaultPollingTimeout.
+	PollingTimeout time.Duration
+	// WebhookInfoCacheDuration is the time for which getWebhookInfo results are reused, to avoid calling the bot API on
+	// every probe. A negative value disables caching.
+	// Defaults to DefaultWebhookInfoCacheDuration.
+	WebhookInfoCacheDuration time.Duration
+}
+
+func (opts *HealthOpts) getPollingTimeout() time.Duration {
+	if opts == nil || opts.PollingTimeout <= 0 {
+		return DefaultPollingTimeout
+	}
+	return opts.PollingTimeout
+}
+
+func (opts *HealthOpts) getWebhookInfoCacheDuration() time.Duration {
+	if opts == nil || opts.WebhookInfoCacheDuration == 0 {
+		return DefaultWebhookInfoCacheDuration
+	}
+	return opts.WebhookInfoCacheDuration
+}
+
+// HealthServerOpts represent the fields needed for configuring the health server started by Updater.StartHealthServer.
+type HealthServerOpts struct {
+	// ListenAddr is the address and port to listen on (eg: localhost:8081, 127.0.0.1:9090, etc).
+	// Since the readiness report describes all bots, this should not be reachable from the internet.
+	// See the net package for details.
+	ListenAddr string
+	// ListenNet is the network type to listen on (must be "tcp", "tcp4", "tcp6", "unix" or "unixpacket").
+	// Empty means the default, "tcp".
+	ListenNet string
+	// ReadTimeout is passed to the http server to limit the time it takes to read an incoming request.
+	// See http.Server for more details.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is passed to the http server to limit the time it takes to read the headers of an incoming
+	// request.
+	// See http.Server for more details.
+	ReadHeaderTimeout time.Duration
+
+	// HealthOpts configures the readiness checks served on /readyz.
+	HealthOpts *HealthOpts
+}
+
+func (opts *HealthServerOpts) GetListenNet() string {
+	if opts.ListenNet == "" {
+		return "tcp"
+	}
+	return opts.ListenNet
+}
+
+// ReadinessReport describes whether an Updater is ready to process updates.
+type ReadinessReport struct {
+	// Ready is true if the Updater is not stopping, has at least one bot, its Dispatcher is not saturated, and all
+	// of its bots are ready.
+	Ready bool `json:"ready"`
+	// Stopping is true once Updater.Stop has been called.
+	Stopping bool `json:"stopping"`
+	// Dispatcher describes the load of the Updater's Dispatcher. WebhookQueueDepth includes all bots.
+	Dispatcher DispatcherReadiness `json:"dispatcher"`
+	// Bots describes each of the Updater's bots, sorted by ID.
+	Bots []BotReadiness `json:"bots"`
+}
+
+// DispatcherReadiness describes the load of a Dispatcher.
+type DispatcherReadiness struct {
+	// CurrentUsage is the number of updates currently being processed.
+	CurrentUsage int `json:"current_usage"`
+	// MaxUsage is the maximum number of updates which can be processed concurrently; 0 if unlimited or unknown.
+	MaxUsage int `json:"max_usage"`
+	// WebhookQueueDepth is the number of incoming webhook updates waiting for the Dispatcher.
+	WebhookQueueDepth int `json:"webhook_queue_depth"`
+	// Saturated is true if the Dispatcher cannot process any more updates concurrently.
+	Saturated bool `json:"saturated"`
+}
+
+// BotReadiness describes whether a single bot is ready to receive updates.
+type BotReadiness struct {
+	BotId int64  `json:"bot_id"`
+	Ready bool   `json:"ready"`
+	Mode  string `json:"mode"`
+	// LastPoll is the time of the last successful getUpdates call, for polling bots.
+	LastPoll *time.Time `json:"last_poll,omitempty"`
+	// Webhook contains the result of getWebhookInfo, for webhook bots.
+	Webhook *WebhookReadiness `json:"webhook,omitempty"`
+	// Dispatcher describes the load of the bot's own dispatcher, for bots which were added with one.
+	Dispatcher *DispatcherReadiness `json:"dispatcher,omitempty"`
+	// Error describes why the bot is not ready.
+	Error string `json:"error,omitempty"`
+}
+
+// WebhookReadiness contains the webhook registration status of a bot, as reported by getWebhookInfo.
+// The webhook URL itself is not included, since it commonly contains the bot token.
+type WebhookReadiness struct {
+	UrlSet             bool   `json:"url_set"`
+	PendingUpdateCount int64  `json:"pending_update_count"`
+	LastErrorDate      int64  `json:"last_error_date,omitempty"`
+	LastErrorMessage   string `json:"last_error_message,omitempty"`
+}
+
+// webhookInfoCache stores recent getWebhookInfo results, by bot token.
+type webhookInfoCache struct {
+	mux     sync.Mutex
+	entries map[string]webhookInfoEntry
+}
+
+type webhookInfoEntry struct {
+	info    *gotgbot.WebhookInfo
+	err     error
+	fetched time.Time
+}
+
+// get returns the webhook info of a bot, reusing a cached result if it is recent enough.
+func (c *webhookInfoCache) get(ctx context.Context, b *gotgbot.Bot, maxAge time.Duration) (*gotgbot.WebhookInfo, error) {
+	c.mux.Lock()
+	entry, ok := c.entries[b.Token]
+	c.mux.Unlock()
+	if ok && maxAge > 0 && time.Since(entry.fetched) < maxAge {
+		return entry.info, entry.err
+	}
+
+	info, err := b.GetWebhookInfoWithContext(ctx, nil)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]webhookInfoEntry{}
+	}
+	c.entries[b.Token] = webhookInfoEntry{info: info, err: err, fetched: time.Now()}
+	return info, err
+}
+
+// remove drops the cached webhook info of a bot.
+func (c *webhookInfoCache) remove(token string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	delete(c.entries, token)
+}
+
+// Readiness checks whether the Updater is ready to process updates. Webhook bots are checked with getWebhookInfo,
+// and are only ready once their webhook has been set; polling bots are ready as long as getUpdates keeps succeeding.
+func (u *Updater) Readiness(ctx context.Context, opts *HealthOpts) ReadinessReport {
+	report := ReadinessReport{
+		Stopping:   u.stopping.Load(),
+		Dispatcher: dispatcherReadiness(u.Dispatcher, u.WebhookQueueDepth()),
+	}
+
+	bots := u.botMapping.getBots()
+	sort.Slice(bots, func(i, j int) bool { return bots[i].bot.Id < bots[j].bot.Id })
+
+	report.Ready = !report.Stopping && !report.Dispatcher.Saturated && len(bots) > 0
+	report.Bots = make([]BotReadiness, 0, len(bots))
+	for _, bData := range bots {
+		r := u.botReadiness(ctx, bData, opts)
+		report.Ready = report.Ready && r.Ready
+		report.Bots = append(report.Bots, r)
+	}
+	return report
+}
+
+// dispatcherReadiness describes the load of a dispatcher, if it reports its usage like the Dispatcher does.
+func dispatcherReadiness(d UpdateDispatcher, webhookQueueDepth int) DispatcherReadiness {
+	r := DispatcherReadiness{WebhookQueueDepth: webhookQueueDepth}
+	if d, ok := d.(interface {
+		CurrentUsage() int
+		MaxUsage() int
+	}); ok {
+		r.CurrentUsage = d.CurrentUsage()
+		r.MaxUsage = d.MaxUsage()
+		r.Saturated = r.MaxUsage > 0 && r.CurrentUsage >= r.MaxUsage
+	}
+	return r
+}
+
+func (u *Updater) botReadiness(ctx context.Context, bData botData, opts *HealthOpts) BotReadiness {
+	r := BotReadiness{BotId: bData.bot.Id}
+
+	if bData.dispatcher != nil && bData.dispatcher != u.Dispatcher {
+		d := dispatcherReadiness(bData.dispatcher, int(bData.webhookQueue.Load()))
+		r.Dispatcher = &d
+		if d.Saturated {
+			r.Error = "dispatcher is saturated"
+			return r
+		}
+	}
+
+	if bData.urlPath == "" {
+		r.Mode = BotModePolling
+		lastPoll := time.Unix(0, bData.lastPoll.Load())
+		r.LastPoll = &lastPoll
+		if time.Since(lastPoll) > opts.getPollingTimeout() {
+			r.Error = "no successful getUpdates call since " + lastPoll.UTC().Format(time.RFC3339)
+			return r
+		}
+		r.Ready = true
+		return r
+	}
+
+	r.Mode = BotModeWebhook
+	info, err := u.webhookInfo.get(ctx, bData.bot, opts.getWebhookInfoCacheDuration())
+	if err != nil {
+		// Network errors contain the request URL; make sure the bot token isn't exposed by the readiness endpoint.
+		r.Error = "failed to get webhook info: " + strings.ReplaceAll(err.Error(), bData.bot.Token, "<token>")
+		return r
+	}
+	r.Webhook = &WebhookReadiness{
+		UrlSet:             info.Url != "",
+		PendingUpdateCount: info.PendingUpdateCount,
+		LastErrorDate:      info.LastErrorDate,
+		LastErrorMessage:   info.LastErrorMessage,
+	}
+	if info.Url == "" {
+		r.Error = "webhook is not set"
+		return r
+	}
+	r.Ready = true
+	return r
+}
+
+// HealthHandler returns an http.Handler for liveness probes. It always responds with a 200 status code, as long as
+// the server is able to respond.
+func (u *Updater) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+// ReadinessHandler returns an http.Handler for readiness probes. It responds with the JSON encoded ReadinessReport,
+// with a 200 status code if the Updater is ready, and a 503 status code otherwise.
+func (u *Updater) ReadinessHandler(opts *HealthOpts) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := u.Readiness(r.Context(), opts)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// StartHealthServer starts an http server which serves HealthHandler on /healthz, and ReadinessHandler on /readyz.
+// It listens separately from the webhook server, so that the health endpoints can be kept private; it is stopped by
+// Stop.
+func (u *Updater) StartHealthServer(opts HealthServerOpts) error {
+	if u.healthServer != nil {
+		return ErrExpectedEmptyServer
+	}
+
+	ln, err := net.Listen(opts.GetListenNet(), opts.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s:%s: %w", opts.ListenNet, opts.ListenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", u.HealthHandler())
+	mux.Handle("/readyz", u.ReadinessHandler(opts.HealthOpts))
+
+	u.healthServer = &http.Server{
+		Handler:           mux,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+	}
+
+	go func() {
+		err := u.healthServer.Serve(ln)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic("health server failed: " + err.Error())
+		}
+	}()
+
+	return nil
+}
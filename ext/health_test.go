@@ -0,0 +1,216 @@
+package ext_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func TestUpdaterReadiness(t *testing.T) {
+	server := basicTestServer(t, map[string]*testEndpoint{
+		"getUpdates": {reply: `{"ok": true, "result": []}`},
+		"getWebhookInfo": {
+			replies: []string{
+				`{"ok": true, "result": {"url": "", "pending_update_count": 0}}`,
+			},
+			reply: `{"ok": true, "result": {"url": "https://example.com/webhook", "pending_update_count": 3, "last_error_date": 1700000000, "last_error_message": "Connection refused"}}`,
+		},
+	})
+	defer server.Close()
+
+	reqOpts := &gotgbot.RequestOpts{APIURL: server.URL}
+	pollBot := &gotgbot.Bot{
+		User:      gotgbot.User{Id: 1},
+		Token:     "POLL_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: reqOpts},
+	}
+	webhookBot := &gotgbot.Bot{
+		User:      gotgbot.User{Id: 2},
+		Token:     "WEBHOOK_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: reqOpts},
+	}
+
+	u := ext.NewUpdater(ext.NewDispatcher(nil), nil)
+	healthOpts := &ext.HealthOpts{WebhookInfoCacheDuration: -1}
+
+	if report := u.Readiness(context.Background(), healthOpts); report.Ready {
+		t.Errorf("expected updater without bots to not be ready")
+	}
+
+	if err := u.StartPolling(pollBot, &ext.PollingOpts{GetUpdatesOpts: &gotgbot.GetUpdatesOpts{RequestOpts: reqOpts}}); err != nil {
+		t.Fatalf("failed to start polling: %v", err)
+	}
+	if err := u.AddWebhook(webhookBot, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %v", err)
+	}
+
+	// The first getWebhookInfo call reports that the webhook hasn't been set yet.
+	report := u.Readiness(context.Background(), healthOpts)
+	if report.Ready {
+		t.Errorf("expected updater to not be ready before the webhook is set")
+	}
+	if len(report.Bots) != 2 {
+		t.Fatalf("expected 2 bots in report, got %d", len(report.Bots))
+	}
+	if b := report.Bots[0]; !b.Ready || b.Mode != ext.BotModePolling || b.LastPoll == nil {
+		t.Errorf("expected polling bot to be ready, got %+v", b)
+	}
+	if b := report.Bots[1]; b.Ready || b.Mode != ext.BotModeWebhook || b.Error == "" {
+		t.Errorf("expected webhook bot to not be ready, got %+v", b)
+	}
+
+	// Once set, the updater is ready, and serves the report over HTTP.
+	rec := httptest.NewRecorder()
+	u.ReadinessHandler(healthOpts).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode readiness report: %v", err)
+	}
+	if !report.Ready || report.Stopping || report.Dispatcher.MaxUsage != ext.DefaultMaxRoutines {
+		t.Errorf("unexpected readiness report: %+v", report)
+	}
+	if w := report.Bots[1].Webhook; w == nil || !w.UrlSet || w.PendingUpdateCount != 3 || w.LastErrorMessage != "Connection refused" {
+		t.Errorf("unexpected webhook status: %+v", w)
+	}
+	if strings.Contains(rec.Body.String(), "example.com") {
+		t.Errorf("readiness report should not contain the webhook url: %s", rec.Body.String())
+	}
+
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	u.ReadinessHandler(healthOpts).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 after stopping, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"stopping":true`) {
+		t.Errorf("expected stopping in readiness report, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	u.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected liveness status 200, got %d", rec.Code)
+	}
+}
+
+func TestUpdaterReadinessStalePolling(t *testing.T) {
+	server := basicTestServer(t, map[string]*testEndpoint{
+		"getUpdates": {reply: `{"ok": false, "error_code": 502, "description": "Bad Gateway"}`},
+	})
+	defer server.Close()
+
+	reqOpts := &gotgbot.RequestOpts{APIURL: server.URL}
+	b := &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: reqOpts},
+	}
+
+	u := ext.NewUpdater(ext.NewDispatcher(nil), &ext.UpdaterOpts{
+		UnhandledErrFunc: func(err error) { time.Sleep(time.Millisecond) },
+	})
+	if err := u.StartPolling(b, &ext.PollingOpts{GetUpdatesOpts: &gotgbot.GetUpdatesOpts{RequestOpts: reqOpts}}); err != nil {
+		t.Fatalf("failed to start polling: %v", err)
+	}
+
+	healthOpts := &ext.HealthOpts{PollingTimeout: 50 * time.Millisecond}
+	if report := u.Readiness(context.Background(), healthOpts); !report.Ready {
+		t.Errorf("expected newly added polling bot to be ready, got %+v", report)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	report := u.Readiness(context.Background(), healthOpts)
+	if report.Ready || report.Bots[0].Error == "" {
+		t.Errorf("expected failing polling bot to not be ready, got %+v", report)
+	}
+
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+}
+
+func TestUpdaterReadinessHidesToken(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close() // Closed server, to cause network errors.
+
+	b := &gotgbot.Bot{
+		Token:     "SECRET_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL}},
+	}
+
+	u := ext.NewUpdater(ext.NewDispatcher(nil), nil)
+	if err := u.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %v", err)
+	}
+
+	report := u.Readiness(context.Background(), nil)
+	if report.Ready || report.Bots[0].Error == "" {
+		t.Fatalf("expected webhook bot to not be ready, got %+v", report)
+	}
+	if strings.Contains(report.Bots[0].Error, b.Token) {
+		t.Errorf("readiness report should not contain the bot token: %s", report.Bots[0].Error)
+	}
+
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+}
+
+func TestUpdaterHealthServer(t *testing.T) {
+	// Find a free port for the health server to listen on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	if err := ln.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+
+	u := ext.NewUpdater(ext.NewDispatcher(nil), nil)
+	if err := u.StartHealthServer(ext.HealthServerOpts{ListenAddr: addr}); err != nil {
+		t.Fatalf("failed to start health server: %v", err)
+	}
+	if err := u.StartHealthServer(ext.HealthServerOpts{ListenAddr: addr}); err == nil {
+		t.Errorf("expected starting a second health server to fail")
+	}
+
+	for path, status := range map[string]int{
+		"/healthz": http.StatusOK,
+		// Not ready, since no bots have been added.
+		"/readyz": http.StatusServiceUnavailable,
+		// Webhook updates are not served by the health server.
+		"/bot": http.StatusNotFound,
+	} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("failed to get %s: %v", path, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("expected status %d for %s, got %d", status, path, resp.StatusCode)
+		}
+	}
+
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+	if resp, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		_ = resp.Body.Close()
+		t.Errorf("expected health server to be stopped")
+	}
+}
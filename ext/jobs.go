@@ -0,0 +1,603 @@
+package ext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+var (
+	ErrUnknownJobFunc  = errors.New("unknown job func")
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobQueueClosed  = errors.New("job queue has been stopped")
+	ErrInvalidInterval = errors.New("job interval must be positive")
+)
+
+// JobDeleteMessage is the name of the built-in JobFunc used by JobQueue.DeleteMessageAfter.
+const JobDeleteMessage = "delete_message"
+
+// JobFunc is the function executed when a job runs. The context is cancelled when the JobQueue is stopped; long-running
+// jobs should return once it is done. One-shot jobs which are interrupted this way are kept in the JobStore, and run
+// again once the queue is restarted.
+type JobFunc func(ctx context.Context, b *gotgbot.Bot, job Job) error
+
+// Job is a scheduled call to a JobFunc.
+// Jobs only contain serialisable data, so that they can be persisted by a JobStore and resumed after a restart.
+type Job struct {
+	// Id uniquely identifies the job.
+	Id string `json:"id"`
+	// Func is the name of the JobFunc to run, as registered with JobQueue.RegisterFunc.
+	Func string `json:"func"`
+	// BotId is the ID of the bot to run the job with.
+	BotId int64 `json:"bot_id"`
+	// Data is any JSON data passed when scheduling the job. Use Job.UnmarshalData to read it.
+	Data json.RawMessage `json:"data,omitempty"`
+	// NextRun is the time at which the job will next run.
+	NextRun time.Time `json:"next_run"`
+	// Interval is the time between runs for repeating jobs.
+	Interval time.Duration `json:"interval,omitempty"`
+	// Cron is the cron spec for cron jobs; see ParseCron.
+	Cron string `json:"cron,omitempty"`
+}
+
+// UnmarshalData unmarshals the job's data into v.
+func (j Job) UnmarshalData(v interface{}) error {
+	if err := json.Unmarshal(j.Data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal job data: %w", err)
+	}
+	return nil
+}
+
+// repeats returns true if the job runs more than once.
+func (j Job) repeats() bool {
+	return j.Interval > 0 || j.Cron != ""
+}
+
+// JobStore allows you to define custom backends for persisting scheduled jobs.
+// If you are looking to keep jobs across restarts, you should implement this interface with your backend of choice.
+// Note: Make sure to store the entire Job struct; future changes may add new fields.
+type JobStore interface {
+	// SaveJob creates or updates a job.
+	SaveJob(job Job) error
+	// DeleteJob removes a job. Deleting a job which does not exist is not an error.
+	DeleteJob(id string) error
+	// ListJobs returns all saved jobs.
+	ListJobs() ([]Job, error)
+}
+
+// InMemoryJobStore is a thread-safe in-memory implementation of the JobStore interface.
+type InMemoryJobStore struct {
+	jobs map[string]Job
+	lock sync.RWMutex
+}
+
+var _ JobStore = &InMemoryJobStore{}
+
+func NewInMemoryJobStore() *InMemoryJobStore {
+	return &InMemoryJobStore{
+		jobs: map[string]Job{},
+	}
+}
+
+func (s *InMemoryJobStore) SaveJob(job Job) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.jobs[job.Id] = job
+	return nil
+}
+
+func (s *InMemoryJobStore) DeleteJob(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *InMemoryJobStore) ListJobs() ([]Job, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// JobQueue runs one-shot, repeating and cron jobs in the background.
+//
+// JobFuncs are registered by name with RegisterFunc, and jobs refer to them by name; this allows for jobs to be saved
+// in a JobStore and resumed after a restart. Jobs which were due while the bot was offline are run as soon as the
+// queue is started.
+//
+// When set as the Updater's JobQueue, the queue is started when bots are added to the updater, and stopped by
+// Updater.Stop; adding bots again restarts it. Stopping the queue cancels the context passed to any running jobs, and
+// waits for them to return.
+type JobQueue struct {
+	// Store is used to persist scheduled jobs.
+	Store JobStore
+	// Location is the time zone used to evaluate cron schedules.
+	Location *time.Location
+
+	// UnhandledErrFunc handles errors returned by jobs, as well as any errors when saving jobs to the Store.
+	// If nil, the error is logged to Logger.
+	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for job errors.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
+	// ErrorLog specifies an optional logger for job errors.
+	// If nil, logging is done via slog.Default().
+	ErrorLog *log.Logger
+
+	// lifecycle serialises Start and Stop, so that a stopped queue can only be restarted once it has fully stopped.
+	lifecycle sync.Mutex
+	// lock protects the fields below, up to started and stopped.
+	lock sync.Mutex
+	// funcs maps JobFunc names to their functions.
+	funcs map[string]JobFunc
+	// bots maps bot IDs to the bot used to run their jobs.
+	bots map[int64]*gotgbot.Bot
+	// jobs contains all scheduled jobs, by ID.
+	jobs map[string]Job
+	// running contains the IDs of currently running jobs.
+	running map[string]bool
+	// started and stopped track the queue's lifecycle.
+	started bool
+	stopped bool
+
+	// wake is used to notify the scheduling loop of job changes.
+	wake chan struct{}
+	// ctx is passed to running jobs, and cancelled to stop the scheduling loop and the jobs. It is replaced when a stopped
+	// queue is restarted, while holding both lifecycle and lock.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// loopDone is closed once the scheduling loop has exited.
+	loopDone chan struct{}
+	// waitGroup tracks running jobs, to allow for clean shutdowns.
+	waitGroup sync.WaitGroup
+}
+
+// JobQueueOpts can be used to configure or override default JobQueue behaviours.
+type JobQueueOpts struct {
+	// Store is used to persist scheduled jobs. Defaults to an InMemoryJobStore.
+	Store JobStore
+	// Location is the time zone used to evaluate cron schedules. Defaults to time.Local.
+	Location *time.Location
+	// UnhandledErrFunc handles errors returned by jobs, as well as any errors when saving jobs to the Store.
+	// If nil, the error is logged to Logger.
+	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for job errors.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
+	// ErrorLog specifies an optional logger for job errors.
+	// If nil, logging is done via slog.Default().
+	ErrorLog *log.Logger
+}
+
+// NewJobQueue creates a new JobQueue. The built-in JobDeleteMessage func is registered automatically.
+func NewJobQueue(opts *JobQueueOpts) *JobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &JobQueue{
+		Store:    NewInMemoryJobStore(),
+		Location: time.Local,
+		funcs:    map[string]JobFunc{},
+		bots:     map[int64]*gotgbot.Bot{},
+		jobs:     map[string]Job{},
+		running:  map[string]bool{},
+		wake:     make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		loopDone: make(chan struct{}),
+	}
+
+	if opts != nil {
+		if opts.Store != nil {
+			q.Store = opts.Store
+		}
+		if opts.Location != nil {
+			q.Location = opts.Location
+		}
+		q.UnhandledErrFunc = opts.UnhandledErrFunc
+		q.Logger = opts.Logger
+		q.ErrorLog = opts.ErrorLog
+	}
+
+	q.RegisterFunc(JobDeleteMessage, deleteMessageJob)
+	return q
+}
+
+// handleErr sends job errors to the UnhandledErrFunc, or logs them.
+func (q *JobQueue) handleErr(msg string, j Job, err error) {
+	handleUnhandledErr(q.UnhandledErrFunc, resolveLogger(q.Logger, q.ErrorLog), msg, err,
+		slog.String(LogKeyJobId, j.Id), slog.String(LogKeyJobFunc, j.Func), slog.Int64(LogKeyBotId, j.BotId))
+}
+
+// RegisterFunc registers a JobFunc under the given name, so that jobs can be scheduled to run it.
+// Funcs should be registered before the queue is started, so that any saved jobs can be resumed.
+func (q *JobQueue) RegisterFunc(name string, f JobFunc) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.funcs[name] = f
+}
+
+// AddBot makes a bot available to run jobs. Bots are added automatically when scheduling jobs, and when added to an
+// Updater which uses this queue; saved jobs for bots which haven't been added yet will wait until they are.
+func (q *JobQueue) AddBot(b *gotgbot.Bot) {
+	q.lock.Lock()
+	q.bots[b.Id] = b
+	q.lock.Unlock()
+	q.notify()
+}
+
+// Start loads any saved jobs from the Store, and starts running jobs in the background.
+// Calling Start on a queue which has already been started is a noop. A stopped queue can be started again, to resume
+// its jobs.
+func (q *JobQueue) Start() error {
+	q.lifecycle.Lock()
+	defer q.lifecycle.Unlock()
+
+	q.lock.Lock()
+	started := q.started
+	q.lock.Unlock()
+	if started {
+		return nil
+	}
+
+	// Load the saved jobs without holding the lock, so that slow stores don't block the rest of the queue.
+	jobs, err := q.Store.ListJobs()
+	if err != nil {
+		return fmt.Errorf("failed to load saved jobs: %w", err)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, j := range jobs {
+		if _, ok := q.jobs[j.Id]; !ok {
+			q.jobs[j.Id] = j
+		}
+	}
+
+	if q.stopped {
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+		q.loopDone = make(chan struct{})
+		q.stopped = false
+	}
+	q.started = true
+	go q.loop(q.ctx, q.loopDone)
+	return nil
+}
+
+// Stop stops scheduling new job runs, cancels the context of any running jobs, and waits for them to return. Jobs remain
+// in the Store, and can be resumed by restarting the queue, or by a new JobQueue.
+func (q *JobQueue) Stop() {
+	q.lifecycle.Lock()
+	defer q.lifecycle.Unlock()
+
+	q.lock.Lock()
+	if q.stopped {
+		q.lock.Unlock()
+		return
+	}
+	q.stopped = true
+	started := q.started
+	q.started = false
+	q.lock.Unlock()
+
+	q.cancel()
+	if started {
+		<-q.loopDone
+	}
+	q.waitGroup.Wait()
+}
+
+// RunOnce schedules a job to run once, after the given delay. The data is marshalled to JSON, and made available to
+// the JobFunc through Job.UnmarshalData.
+func (q *JobQueue) RunOnce(b *gotgbot.Bot, funcName string, delay time.Duration, data interface{}) (*Job, error) {
+	return q.schedule(b, Job{Func: funcName, NextRun: time.Now().Add(delay)}, data)
+}
+
+// RunAt schedules a job to run once, at the given time.
+func (q *JobQueue) RunAt(b *gotgbot.Bot, funcName string, at time.Time, data interface{}) (*Job, error) {
+	return q.schedule(b, Job{Func: funcName, NextRun: at}, data)
+}
+
+// RunRepeating schedules a job to run every interval, starting after the first interval.
+func (q *JobQueue) RunRepeating(b *gotgbot.Bot, funcName string, interval time.Duration, data interface{}) (*Job, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInterval, interval)
+	}
+	return q.schedule(b, Job{Func: funcName, NextRun: time.Now().Add(interval), Interval: interval}, data)
+}
+
+// RunCron schedules a job to run on a cron schedule; see ParseCron for the supported syntax.
+func (q *JobQueue) RunCron(b *gotgbot.Bot, funcName string, spec string, data interface{}) (*Job, error) {
+	s, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	next := s.Next(time.Now().In(q.Location))
+	if next.IsZero() {
+		return nil, fmt.Errorf("%w: %q never runs", ErrInvalidCronSpec, spec)
+	}
+	return q.schedule(b, Job{Func: funcName, NextRun: next, Cron: spec}, data)
+}
+
+// DeleteMessageAfter schedules a message to be deleted after the given delay.
+func (q *JobQueue) DeleteMessageAfter(b *gotgbot.Bot, chatId int64, messageId int64, delay time.Duration) (*Job, error) {
+	return q.RunOnce(b, JobDeleteMessage, delay, deleteMessageData{ChatId: chatId, MessageId: messageId})
+}
+
+type deleteMessageData struct {
+	ChatId    int64 `json:"chat_id"`
+	MessageId int64 `json:"message_id"`
+}
+
+func deleteMessageJob(ctx context.Context, b *gotgbot.Bot, job Job) error {
+	var data deleteMessageData
+	if err := job.UnmarshalData(&data); err != nil {
+		return err
+	}
+	_, err := b.DeleteMessageWithContext(ctx, data.ChatId, data.MessageId, nil)
+	return err
+}
+
+// Cancel removes a scheduled job. If the job is currently running, it is allowed to complete.
+func (q *JobQueue) Cancel(id string) error {
+	q.lock.Lock()
+	_, ok := q.jobs[id]
+	delete(q.jobs, id)
+	q.lock.Unlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+	if err := q.Store.DeleteJob(id); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	q.notify()
+	return nil
+}
+
+// Jobs returns all scheduled jobs, sorted by their next run time.
+func (q *JobQueue) Jobs() []Job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].NextRun.Before(jobs[j].NextRun)
+	})
+	return jobs
+}
+
+func (q *JobQueue) schedule(b *gotgbot.Bot, job Job, data interface{}) (*Job, error) {
+	if data != nil {
+		bs, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal job data: %w", err)
+		}
+		job.Data = bs
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	job.Id = hex.EncodeToString(id)
+	job.BotId = b.Id
+
+	q.lock.Lock()
+	if q.stopped {
+		q.lock.Unlock()
+		return nil, ErrJobQueueClosed
+	}
+	if _, ok := q.funcs[job.Func]; !ok {
+		q.lock.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobFunc, job.Func)
+	}
+	q.bots[b.Id] = b
+	q.lock.Unlock()
+
+	if err := q.Store.SaveJob(job); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	q.lock.Lock()
+	q.jobs[job.Id] = job
+	q.lock.Unlock()
+	q.notify()
+
+	return &job, nil
+}
+
+// notify wakes up the scheduling loop, to take job changes into account.
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+		// The loop already has a pending notification.
+	}
+}
+
+func (q *JobQueue) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		next := q.runDueJobs(ctx, time.Now())
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runDueJobs starts all jobs which are due, and returns the time at which the next job is due.
+func (q *JobQueue) runDueJobs(ctx context.Context, now time.Time) time.Time {
+	// Store changes are made once the lock is released, so that slow stores don't block the rest of the queue.
+	var saved []Job
+	var removed []struct {
+		job Job
+		err error
+	}
+
+	q.lock.Lock()
+	var next time.Time
+	for id, j := range q.jobs {
+		b, hasBot := q.bots[j.BotId]
+		if !hasBot {
+			// Wait for the bot to be added.
+			continue
+		}
+
+		if j.NextRun.After(now) {
+			if next.IsZero() || j.NextRun.Before(next) {
+				next = j.NextRun
+			}
+			continue
+		}
+
+		if !j.repeats() {
+			delete(q.jobs, id)
+		} else {
+			updated, err := q.reschedule(j, now)
+			if err != nil {
+				delete(q.jobs, id)
+				removed = append(removed, struct {
+					job Job
+					err error
+				}{job: j, err: fmt.Errorf("failed to reschedule job %s, removing it: %w", id, err)})
+				continue
+			}
+			q.jobs[id] = updated
+			saved = append(saved, updated)
+			if next.IsZero() || updated.NextRun.Before(next) {
+				next = updated.NextRun
+			}
+		}
+
+		if q.running[id] {
+			// Skip this run; the previous one is still going.
+			continue
+		}
+		q.running[id] = true
+		q.waitGroup.Add(1)
+		go q.run(ctx, b, j)
+	}
+	q.lock.Unlock()
+
+	for _, r := range removed {
+		q.handleErr("Failed to reschedule job, removing it", r.job, r.err)
+		q.deleteFromStore(r.job)
+	}
+	for _, j := range saved {
+		q.saveToStore(j)
+	}
+	return next
+}
+
+// reschedule returns the job with its next run time updated.
+func (q *JobQueue) reschedule(j Job, now time.Time) (Job, error) {
+	if j.Cron != "" {
+		s, err := ParseCron(j.Cron)
+		if err != nil {
+			return j, err
+		}
+		j.NextRun = s.Next(now.In(q.Location))
+		if j.NextRun.IsZero() {
+			return j, fmt.Errorf("%w: %q never runs", ErrInvalidCronSpec, j.Cron)
+		}
+		return j, nil
+	}
+
+	// Skip any runs which were missed, rather than running them all at once.
+	for !j.NextRun.After(now) {
+		j.NextRun = j.NextRun.Add(j.Interval)
+	}
+	return j, nil
+}
+
+func (q *JobQueue) run(ctx context.Context, b *gotgbot.Bot, j Job) {
+	// completed is set once the job has returned without panicking.
+	completed := false
+	defer func() {
+		if r := recover(); r != nil {
+			q.handleErr("Job panicked", j, fmt.Errorf("job %s (%s): %w: %v\n%s", j.Id, j.Func, ErrPanicRecovered, r, cleanedStack()))
+		}
+
+		q.lock.Lock()
+		delete(q.running, j.Id)
+		q.lock.Unlock()
+
+		// One-shot jobs which didn't complete are kept in the store, so that they run again after a restart.
+		if !j.repeats() && completed && ctx.Err() == nil {
+			q.deleteFromStore(j)
+		}
+		q.waitGroup.Done()
+	}()
+
+	q.lock.Lock()
+	f, ok := q.funcs[j.Func]
+	q.lock.Unlock()
+	if !ok {
+		q.handleErr("Failed to run job", j, fmt.Errorf("job %s: %w: %s", j.Id, ErrUnknownJobFunc, j.Func))
+		return
+	}
+
+	err := f(ctx, b, j)
+	completed = true
+	if err != nil {
+		q.handleErr("Job failed", j, fmt.Errorf("job %s (%s) failed: %w", j.Id, j.Func, err))
+	}
+}
+
+// saveToStore saves a rescheduled job. If the job was cancelled while it was being saved, it is removed from the store
+// again.
+func (q *JobQueue) saveToStore(j Job) {
+	if err := q.Store.SaveJob(j); err != nil {
+		q.handleErr("Failed to save job", j, fmt.Errorf("failed to save job %s: %w", j.Id, err))
+		return
+	}
+
+	q.lock.Lock()
+	_, ok := q.jobs[j.Id]
+	q.lock.Unlock()
+	if !ok {
+		q.deleteFromStore(j)
+	}
+}
+
+func (q *JobQueue) deleteFromStore(j Job) {
+	if err := q.Store.DeleteJob(j.Id); err != nil {
+		q.handleErr("Failed to delete job", j, fmt.Errorf("failed to delete job %s: %w", j.Id, err))
+	}
+}
@@ -0,0 +1,405 @@
+package ext_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+var errTestJob = errors.New("test job error")
+
+func TestJobQueueRunOnce(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+
+	q := ext.NewJobQueue(nil)
+	ran := make(chan string, 1)
+	q.RegisterFunc("test", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		var data string
+		if err := job.UnmarshalData(&data); err != nil {
+			return err
+		}
+		ran <- data
+		return nil
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	defer q.Stop()
+
+	if _, err := q.RunOnce(b, "test", 10*time.Millisecond, "hello"); err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+
+	select {
+	case data := <-ran:
+		if data != "hello" {
+			t.Errorf("expected job data 'hello', got %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+
+	// One-shot jobs are removed once they have run.
+	time.Sleep(10 * time.Millisecond)
+	if jobs, _ := q.Store.ListJobs(); len(jobs) != 0 || len(q.Jobs()) != 0 {
+		t.Errorf("expected no jobs left, got %v", jobs)
+	}
+}
+
+func TestJobQueueRunRepeatingAndCancel(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+
+	q := ext.NewJobQueue(nil)
+	var runs atomic.Int32
+	q.RegisterFunc("test", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		runs.Add(1)
+		return nil
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	defer q.Stop()
+
+	job, err := q.RunRepeating(b, "test", 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+
+	time.Sleep(55 * time.Millisecond)
+	if err := q.Cancel(job.Id); err != nil {
+		t.Fatalf("failed to cancel job: %s", err.Error())
+	}
+	count := runs.Load()
+	if count < 2 {
+		t.Errorf("expected job to run repeatedly, ran %d times", count)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if after := runs.Load(); after != count {
+		t.Errorf("expected cancelled job not to run again, ran %d more times", after-count)
+	}
+	if err := q.Cancel(job.Id); !errors.Is(err, ext.ErrJobNotFound) {
+		t.Errorf("expected cancelling twice to fail with ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJobQueueErrors(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+
+	errs := make(chan error, 2)
+	q := ext.NewJobQueue(&ext.JobQueueOpts{
+		UnhandledErrFunc: func(err error) { errs <- err },
+	})
+	q.RegisterFunc("fail", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		return errTestJob
+	})
+	q.RegisterFunc("panic", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		panic("oh no")
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	defer q.Stop()
+
+	if _, err := q.RunOnce(b, "unknown", 0, nil); !errors.Is(err, ext.ErrUnknownJobFunc) {
+		t.Errorf("expected unknown func to fail with ErrUnknownJobFunc, got %v", err)
+	}
+	for _, f := range []string{"fail", "panic"} {
+		if _, err := q.RunOnce(b, f, 0, nil); err != nil {
+			t.Fatalf("failed to schedule job: %s", err.Error())
+		}
+	}
+
+	var panicked bool
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			panicked = panicked || errors.Is(err, ext.ErrPanicRecovered)
+		case <-time.After(time.Second):
+			t.Fatal("expected job errors to be handled")
+		}
+	}
+	if !panicked {
+		t.Error("expected job panic to be recovered")
+	}
+}
+
+func TestJobQueuePersistence(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+	store := ext.NewInMemoryJobStore()
+
+	// Schedule a job on a queue which is stopped before it runs.
+	q := ext.NewJobQueue(&ext.JobQueueOpts{Store: store})
+	q.RegisterFunc("test", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		t.Error("job should not run on the first queue")
+		return nil
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	job, err := q.RunOnce(b, "test", 20*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+	q.Stop()
+
+	if _, err := q.RunOnce(b, "test", 0, nil); !errors.Is(err, ext.ErrJobQueueClosed) {
+		t.Errorf("expected scheduling on a stopped queue to fail, got %v", err)
+	}
+
+	// A new queue sharing the store should resume the job, once the bot is available.
+	q = ext.NewJobQueue(&ext.JobQueueOpts{Store: store})
+	ran := make(chan string, 1)
+	q.RegisterFunc("test", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		ran <- job.Id
+		return nil
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	defer q.Stop()
+
+	if len(q.Jobs()) != 1 {
+		t.Fatalf("expected saved job to be loaded, got %v", q.Jobs())
+	}
+	q.AddBot(b)
+
+	select {
+	case id := <-ran:
+		if id != job.Id {
+			t.Errorf("expected job %s to run, got %s", job.Id, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("saved job did not run")
+	}
+}
+
+func TestJobQueueDeleteMessageAfter(t *testing.T) {
+	deleteMessage := &testEndpoint{reply: `{"ok": true, "result": true}`}
+	server := basicTestServer(t, map[string]*testEndpoint{
+		"deleteMessage": deleteMessage,
+	})
+	defer server.Close()
+
+	b := &gotgbot.Bot{
+		User:      gotgbot.User{Id: 1},
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL}},
+	}
+
+	q := ext.NewJobQueue(nil)
+	d := ext.NewDispatcher(nil)
+	u := ext.NewUpdater(d, &ext.UpdaterOpts{JobQueue: q})
+
+	// Adding the bot to the updater starts the job queue.
+	if err := u.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %s", err.Error())
+	}
+
+	job, err := q.DeleteMessageAfter(b, 123, 456, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to schedule message deletion: %s", err.Error())
+	}
+	if bs, _ := json.Marshal(job); !strings.Contains(string(bs), `"data":{"chat_id":123,"message_id":456}`) {
+		t.Errorf("unexpected job: %s", bs)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %s", err.Error())
+	}
+	if calls := deleteMessage.idx.Load(); calls != 1 || len(q.Jobs()) != 0 {
+		t.Errorf("expected message to be deleted once, got %d calls and jobs %v", calls, q.Jobs())
+	}
+}
+
+func TestJobQueueStopCancelsJobs(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+
+	q := ext.NewJobQueue(nil)
+	started := make(chan struct{})
+	q.RegisterFunc("wait", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	if _, err := q.RunOnce(b, "wait", 0, nil); err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("job did not start")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stopping the queue did not cancel the running job")
+	}
+}
+
+// slowJobStore blocks saving jobs after the first one, until release is closed.
+type slowJobStore struct {
+	*ext.InMemoryJobStore
+	saves   atomic.Int32
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (s *slowJobStore) SaveJob(job ext.Job) error {
+	if s.saves.Add(1) == 2 {
+		close(s.blocked)
+		<-s.release
+	}
+	return s.InMemoryJobStore.SaveJob(job)
+}
+
+func TestJobQueueSlowStore(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+	store := &slowJobStore{
+		InMemoryJobStore: ext.NewInMemoryJobStore(),
+		blocked:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+
+	q := ext.NewJobQueue(&ext.JobQueueOpts{Store: store})
+	q.RegisterFunc("test", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		return nil
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	defer q.Stop()
+	defer close(store.release)
+
+	if _, err := q.RunRepeating(b, "test", 10*time.Millisecond, nil); err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+
+	// Rescheduling the job saves it to the store, which blocks.
+	select {
+	case <-store.blocked:
+	case <-time.After(time.Second):
+		t.Fatal("job was not rescheduled")
+	}
+
+	listed := make(chan []ext.Job)
+	go func() {
+		listed <- q.Jobs()
+	}()
+	select {
+	case jobs := <-listed:
+		if len(jobs) != 1 {
+			t.Errorf("expected 1 job, got %v", jobs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow store blocked the job queue")
+	}
+}
+
+func TestJobQueueRestart(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+	store := ext.NewInMemoryJobStore()
+
+	q := ext.NewJobQueue(&ext.JobQueueOpts{Store: store})
+	runs := make(chan bool, 2)
+	q.RegisterFunc("wait", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		select {
+		case <-ctx.Done():
+			runs <- false
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			runs <- true
+			return nil
+		}
+	})
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to start job queue: %s", err.Error())
+	}
+	if _, err := q.RunOnce(b, "wait", 0, nil); err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+
+	// Wait for the job to start, and then interrupt it.
+	time.Sleep(10 * time.Millisecond)
+	q.Stop()
+	if completed := <-runs; completed {
+		t.Fatal("expected job to be interrupted")
+	}
+	if jobs, _ := store.ListJobs(); len(jobs) != 1 {
+		t.Errorf("expected interrupted job to be kept in the store, got %v", jobs)
+	}
+
+	// Restarting the queue runs the interrupted job again.
+	if err := q.Start(); err != nil {
+		t.Fatalf("failed to restart job queue: %s", err.Error())
+	}
+	defer q.Stop()
+
+	select {
+	case completed := <-runs:
+		if !completed {
+			t.Fatal("expected job to complete after restarting")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("interrupted job did not run again")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if jobs, _ := store.ListJobs(); len(jobs) != 0 {
+		t.Errorf("expected completed job to be deleted from the store, got %v", jobs)
+	}
+}
+
+func TestJobQueueUpdaterRestart(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+
+	q := ext.NewJobQueue(nil)
+	ran := make(chan struct{}, 1)
+	q.RegisterFunc("test", func(ctx context.Context, b *gotgbot.Bot, job ext.Job) error {
+		ran <- struct{}{}
+		return nil
+	})
+	u := ext.NewUpdater(ext.NewDispatcher(nil), &ext.UpdaterOpts{JobQueue: q})
+
+	if err := u.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %s", err.Error())
+	}
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %s", err.Error())
+	}
+
+	// Re-adding the bot after stopping restarts the job queue.
+	if err := u.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to re-add webhook: %s", err.Error())
+	}
+
+	if _, err := q.RunOnce(b, "test", 0, nil); err != nil {
+		t.Fatalf("failed to schedule job: %s", err.Error())
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("job did not run after restarting the updater")
+	}
+
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %s", err.Error())
+	}
+}
@@ -0,0 +1,81 @@
+package ext
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Attribute keys used for structured logging.
+const (
+	LogKeyError    = "error"
+	LogKeyBotId    = "bot_id"
+	LogKeyUpdateId = "update_id"
+	LogKeyHandler  = "handler"
+	LogKeyGroup    = "group"
+	LogKeyMethod   = "method"
+	LogKeyURLPath  = "url_path"
+	LogKeyAction   = "action"
+	LogKeyJobId    = "job_id"
+	LogKeyJobFunc  = "job_func"
+)
+
+// resolveLogger returns the structured logger to use for internal logging:
+//   - logger, if set.
+//   - a logger writing to errorLog, if set. This maintains support for the older ErrorLog fields.
+//   - otherwise, slog.Default().
+func resolveLogger(logger *slog.Logger, errorLog *log.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	if errorLog != nil {
+		errorLogLoggersLock.Lock()
+		defer errorLogLoggersLock.Unlock()
+
+		if l, ok := errorLogLoggers[errorLog]; ok {
+			return l
+		}
+		l := slog.New(slog.NewTextHandler(logWriter{l: errorLog}, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				// The log.Logger already adds its own timestamps.
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))
+		errorLogLoggers[errorLog] = l
+		return l
+	}
+	return slog.Default()
+}
+
+var (
+	// errorLogLoggers caches the structured logger created for each ErrorLog, so that resolveLogger doesn't create a
+	// new one on every call.
+	errorLogLoggers     = map[*log.Logger]*slog.Logger{}
+	errorLogLoggersLock sync.Mutex
+)
+
+// logWriter writes each slog record as a single log.Logger line.
+type logWriter struct {
+	l *log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	if err := w.l.Output(2, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// handleUnhandledErr sends the error to the errFunc if there is one, or logs it at error level otherwise.
+func handleUnhandledErr(errFunc ErrorFunc, logger *slog.Logger, msg string, err error, attrs ...slog.Attr) {
+	if errFunc != nil {
+		errFunc(err)
+		return
+	}
+	logger.LogAttrs(context.Background(), slog.LevelError, msg, append(attrs, slog.Any(LogKeyError, err))...)
+}
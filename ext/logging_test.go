@@ -0,0 +1,118 @@
+package ext_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+)
+
+var errTestHandler = errors.New("test handler error")
+
+// runUpdates starts the dispatcher, sends it the given raw updates, and waits for them to be processed.
+func runUpdates(d *ext.Dispatcher, b *gotgbot.Bot, updates ...string) {
+	ch := make(chan json.RawMessage, len(updates))
+	for _, upd := range updates {
+		ch <- json.RawMessage(upd)
+	}
+	close(ch)
+
+	d.Start(b, ch)
+	d.Stop()
+}
+
+func TestDispatcherStructuredLogging(t *testing.T) {
+	buf := bytes.Buffer{}
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	d.AddHandler(handlers.NewNamedhandler("panicky", handlers.NewMessage(message.Contains("panic"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+		panic("oh no")
+	})))
+	d.AddHandler(handlers.NewNamedhandler("echo", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return ext.EndGroups
+	})))
+
+	runUpdates(d, &gotgbot.Bot{User: gotgbot.User{Id: 42}},
+		`{"update_id": 1, "message": {"text": "panic"}}`,
+		`{"update_id": 2, "message": {"text": "hello"}}`,
+		`not json`,
+	)
+
+	records := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("failed to decode log line %q: %s", line, err.Error())
+		}
+		key, _ := record["msg"].(string)
+		if updateId, ok := record[ext.LogKeyUpdateId]; ok {
+			key += fmt.Sprintf("/%v", updateId)
+		}
+		records[key] = record
+	}
+
+	for key, expected := range map[string]map[string]interface{}{
+		"Failed to process update/1": {"level": "ERROR", ext.LogKeyBotId: 42.0, ext.LogKeyHandler: "panicky"},
+		"Failed to process update":   {"level": "ERROR", ext.LogKeyBotId: 42.0},
+		"Handler matched update/2":   {"level": "DEBUG", ext.LogKeyHandler: "echo", ext.LogKeyAction: "end_groups", ext.LogKeyGroup: 0.0},
+	} {
+		record, ok := records[key]
+		if !ok {
+			t.Errorf("missing log record %q in:\n%s", key, buf.String())
+			continue
+		}
+		for attr, value := range expected {
+			if record[attr] != value {
+				t.Errorf("expected %q to have %s=%v, got %v", key, attr, value, record[attr])
+			}
+		}
+	}
+}
+
+func TestDispatcherErrorLogFallback(t *testing.T) {
+	buf := bytes.Buffer{}
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		ErrorLog: log.New(&buf, "bot: ", 0),
+	})
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		panic("oh no")
+	}))
+
+	runUpdates(d, &gotgbot.Bot{User: gotgbot.User{Id: 42}}, `{"update_id": 1, "message": {"text": "hello"}}`)
+
+	out := buf.String()
+	if !strings.HasPrefix(out, `bot: level=ERROR msg="Failed to process update" bot_id=42 update_id=1`) {
+		t.Errorf("unexpected log output: %s", out)
+	}
+}
+
+func TestUpdateError(t *testing.T) {
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
+			return "unknown"
+		},
+	})
+	d.AddHandler(handlers.NewNamedhandler("failing", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return errTestHandler
+	})))
+
+	err := d.ProcessUpdate(&gotgbot.Bot{}, &gotgbot.Update{UpdateId: 7, Message: &gotgbot.Message{Text: "hello"}}, nil)
+
+	var updErr *ext.UpdateError
+	if !errors.As(err, &updErr) {
+		t.Fatalf("expected an UpdateError, got %v", err)
+	}
+	if updErr.UpdateId != 7 || updErr.Handler != "failing" || !errors.Is(err, ext.ErrUnknownDispatcherAction) {
+		t.Errorf("unexpected update error: %+v", updErr)
+	}
+}
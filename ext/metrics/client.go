@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Client is a gotgbot.BotClient middleware which records the count, duration and errors of all bot API requests.
+type Client struct {
+	// Inlined version of the wrapped client, to inherit the other BotClient methods.
+	gotgbot.BotClient
+	// Recorder is where the request metrics are recorded.
+	Recorder Recorder
+}
+
+var (
+	_ gotgbot.BotClient         = Client{}
+	_ gotgbot.FileDownloader    = Client{}
+	_ gotgbot.LocalFileResolver = Client{}
+)
+
+// NewClient wraps a BotClient to record metrics about the requests it makes.
+func NewClient(client gotgbot.BotClient, r Recorder) Client {
+	return Client{
+		BotClient: client,
+		Recorder:  r,
+	}
+}
+
+func (c Client) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]gotgbot.FileReader, opts *gotgbot.RequestOpts) (json.RawMessage, error) {
+	start := time.Now()
+	r, err := c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	c.Recorder.Observe(APIRequestDuration, time.Since(start).Seconds(), Label{Name: "method", Value: method})
+
+	code := "200"
+	if err != nil {
+		code = "network"
+		var tgErr *gotgbot.TelegramError
+		if errors.As(err, &tgErr) {
+			code = strconv.Itoa(tgErr.Code)
+		}
+		c.Recorder.Add(APIRequestErrors, 1, Label{Name: "method", Value: method}, Label{Name: "code", Value: code})
+	}
+	c.Recorder.Add(APIRequests, 1, Label{Name: "method", Value: method}, Label{Name: "code", Value: code})
+
+	return r, err
+}
+
+// DownloadFileWithContext downloads files through the wrapped client. Downloads are not recorded as API requests.
+func (c Client) DownloadFileWithContext(ctx context.Context, token string, tgFilePath string, offset int64, opts *gotgbot.RequestOpts) (io.ReadCloser, error) {
+	return gotgbot.OpenFile(ctx, c.BotClient, token, tgFilePath, offset, opts)
+}
+
+// LocalFilePath finds local files using the wrapped client.
+func (c Client) LocalFilePath(tgFilePath string) (string, bool) {
+	return gotgbot.ResolveLocalFilePath(c.BotClient, tgFilePath)
+}
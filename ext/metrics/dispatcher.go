@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// Instrument sets up the dispatcher to record update and handler metrics: its Processor is wrapped with a Processor,
+// and a Middleware is added as a global middleware.
+func Instrument(d *ext.Dispatcher, r Recorder) {
+	d.Processor = NewProcessor(d.Processor, r)
+	d.Use(Middleware(r))
+}
+
+// Processor is an ext.Processor which records the count and processing duration of updates, by update type.
+type Processor struct {
+	// Processor is the wrapped processor.
+	Processor ext.Processor
+	// Recorder is where the update metrics are recorded.
+	Recorder Recorder
+}
+
+var _ ext.Processor = Processor{}
+
+// NewProcessor wraps a Processor to record update metrics. If the processor is nil, ext.BaseProcessor is used.
+func NewProcessor(p ext.Processor, r Recorder) Processor {
+	if p == nil {
+		p = ext.BaseProcessor{}
+	}
+	return Processor{
+		Processor: p,
+		Recorder:  r,
+	}
+}
+
+func (p Processor) ProcessUpdate(d *ext.Dispatcher, b *gotgbot.Bot, ctx *ext.Context) error {
+	updateType := Label{Name: "type", Value: ctx.Update.GetType()}
+	p.Recorder.Add(Updates, 1, updateType)
+
+	start := time.Now()
+	defer func() {
+		// Deferred, so that the duration is still recorded if a handler panics.
+		p.Recorder.Observe(UpdateDuration, time.Since(start).Seconds(), updateType)
+	}()
+
+	return p.Processor.ProcessUpdate(d, b, ctx)
+}
+
+// Middleware returns an ext.Middleware which records the duration and errors of each handler which runs.
+func Middleware(r Recorder) ext.Middleware {
+	return func(next ext.Handler) ext.Handler {
+		return ext.NewMiddlewareHandler(next, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			handler := Label{Name: "handler", Value: next.Name()}
+
+			start := time.Now()
+			err := next.HandleUpdate(b, ctx)
+			r.Observe(HandlerDuration, time.Since(start).Seconds(), handler)
+
+			if err != nil && !errors.Is(err, ext.ContinueGroups) && !errors.Is(err, ext.EndGroups) {
+				r.Add(HandlerErrors, 1, handler)
+			}
+			return err
+		})
+	}
+}
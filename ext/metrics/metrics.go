@@ -0,0 +1,102 @@
+// Package metrics collects metrics about a bot's API requests, update processing and dispatcher load.
+//
+// Metrics are recorded through the Recorder interface, so that they can be exported to any metrics library. The
+// Prometheus type is a dependency-free Recorder which serves metrics in the Prometheus text format.
+//
+// A typical setup looks like:
+//
+//	recorder := metrics.NewPrometheus(nil)
+//	b, err := gotgbot.NewBot(token, &gotgbot.BotOpts{
+//		BotClient: metrics.NewClient(&gotgbot.BaseBotClient{}, recorder),
+//	})
+//	...
+//	metrics.Instrument(dispatcher, recorder)
+//	go metrics.Monitor(ctx, recorder, dispatcher, updater, 0)
+//	http.Handle("/metrics", recorder)
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// The names of the metrics recorded by this package.
+const (
+	// APIRequests counts bot API requests, by "method" and response "code".
+	APIRequests = "gotgbot_api_requests_total"
+	// APIRequestErrors counts failed bot API requests, by "method" and response "code".
+	// The code is "network" for requests which failed before a response was received.
+	APIRequestErrors = "gotgbot_api_request_errors_total"
+	// APIRequestDuration observes the duration of bot API requests in seconds, by "method".
+	APIRequestDuration = "gotgbot_api_request_duration_seconds"
+	// Updates counts processed updates, by update "type".
+	Updates = "gotgbot_updates_total"
+	// UpdateDuration observes the time taken to process each update in seconds, by update "type".
+	UpdateDuration = "gotgbot_update_duration_seconds"
+	// HandlerDuration observes the time taken by each matched handler in seconds, by "handler" name.
+	HandlerDuration = "gotgbot_handler_duration_seconds"
+	// HandlerErrors counts the errors returned by each handler, by "handler" name.
+	// ContinueGroups and EndGroups are not counted as errors.
+	HandlerErrors = "gotgbot_handler_errors_total"
+	// DispatcherUsage is the number of updates currently being processed by the dispatcher.
+	DispatcherUsage = "gotgbot_dispatcher_usage"
+	// DispatcherMaxUsage is the maximum number of updates the dispatcher can process concurrently.
+	DispatcherMaxUsage = "gotgbot_dispatcher_max_usage"
+	// WebhookQueueDepth is the number of incoming webhook updates waiting for the dispatcher.
+	WebhookQueueDepth = "gotgbot_webhook_queue_depth"
+)
+
+// DefaultMonitorInterval is the default interval at which Monitor records the dispatcher and updater gauges.
+const DefaultMonitorInterval = 5 * time.Second
+
+// Label is a metric label name and value.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Recorder allows you to define custom backends for the metrics recorded by this package.
+// Each metric name is always used with the same type of metric, and the same label names, in the same order.
+type Recorder interface {
+	// Add adds the value to a counter.
+	Add(name string, value float64, labels ...Label)
+	// Observe adds an observation to a histogram.
+	Observe(name string, value float64, labels ...Label)
+	// Set sets the value of a gauge.
+	Set(name string, value float64, labels ...Label)
+}
+
+// Collect records the current dispatcher concurrency and webhook queue depth gauges.
+// Either the dispatcher or the updater can be nil, to skip their gauges.
+func Collect(r Recorder, d *ext.Dispatcher, u *ext.Updater) {
+	if d != nil {
+		r.Set(DispatcherUsage, float64(d.CurrentUsage()))
+		r.Set(DispatcherMaxUsage, float64(d.MaxUsage()))
+	}
+	if u != nil {
+		r.Set(WebhookQueueDepth, float64(u.WebhookQueueDepth()))
+	}
+}
+
+// Monitor calls Collect at every interval, until the context is cancelled. This is a blocking method; it should be
+// called as a goroutine.
+// If interval is 0, DefaultMonitorInterval is used.
+func Monitor(ctx context.Context, r Recorder, d *ext.Dispatcher, u *ext.Updater, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		Collect(r, d, u)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
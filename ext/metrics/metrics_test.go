@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/metrics"
+)
+
+var errTestHandler = errors.New("test handler error")
+
+func TestPrometheusFormat(t *testing.T) {
+	p := metrics.NewPrometheus(&metrics.PrometheusOpts{Buckets: []float64{0.1, 1}})
+	p.Add(metrics.Updates, 1, metrics.Label{Name: "type", Value: "message"})
+	p.Add(metrics.Updates, 2, metrics.Label{Name: "type", Value: "message"})
+	p.Add("custom_total", 1, metrics.Label{Name: "text", Value: "a \"quoted\"\nvalue\\"})
+	p.Set(metrics.DispatcherUsage, 3)
+	p.Observe(metrics.HandlerDuration, 0.05, metrics.Label{Name: "handler", Value: "echo"})
+	p.Observe(metrics.HandlerDuration, 0.5, metrics.Label{Name: "handler", Value: "echo"})
+	p.Observe(metrics.HandlerDuration, 5, metrics.Label{Name: "handler", Value: "echo"})
+
+	expected := `# TYPE custom_total counter
+custom_total{text="a \"quoted\"\nvalue\\"} 1
+# HELP gotgbot_dispatcher_usage Number of updates currently being processed by the dispatcher.
+# TYPE gotgbot_dispatcher_usage gauge
+gotgbot_dispatcher_usage 3
+# HELP gotgbot_handler_duration_seconds Time taken by each matched handler.
+# TYPE gotgbot_handler_duration_seconds histogram
+gotgbot_handler_duration_seconds_bucket{handler="echo",le="0.1"} 1
+gotgbot_handler_duration_seconds_bucket{handler="echo",le="1"} 2
+gotgbot_handler_duration_seconds_bucket{handler="echo",le="+Inf"} 3
+gotgbot_handler_duration_seconds_sum{handler="echo"} 5.55
+gotgbot_handler_duration_seconds_count{handler="echo"} 3
+# HELP gotgbot_updates_total Number of processed updates.
+# TYPE gotgbot_updates_total counter
+gotgbot_updates_total{type="message"} 3
+`
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if out := rec.Body.String(); out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+}
+
+func TestInstrumentedBot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: message to delete not found"}`))
+	}))
+	defer server.Close()
+
+	p := metrics.NewPrometheus(nil)
+	b := &gotgbot.Bot{
+		User:  gotgbot.User{Id: 1},
+		Token: "SOME_TOKEN",
+		BotClient: metrics.NewClient(&gotgbot.BaseBotClient{
+			DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL},
+		}, p),
+	}
+
+	d := ext.NewDispatcher(nil)
+	metrics.Instrument(d, p)
+	d.AddHandler(handlers.NewNamedhandler("reply", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		if _, err := b.SendMessage(ctx.EffectiveChat.Id, "hello", nil); err != nil {
+			return err
+		}
+		if _, err := b.DeleteMessage(ctx.EffectiveChat.Id, 2, nil); err != nil {
+			return errTestHandler
+		}
+		return nil
+	})))
+
+	err := d.ProcessUpdate(b, &gotgbot.Update{Message: &gotgbot.Message{Text: "hello", Chat: gotgbot.Chat{Id: 123}}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error while processing update: %s", err.Error())
+	}
+	metrics.Collect(p, d, ext.NewUpdater(d, nil))
+
+	out := strings.Builder{}
+	if _, err = p.WriteTo(&out); err != nil {
+		t.Fatalf("failed to write metrics: %s", err.Error())
+	}
+
+	for _, line := range []string{
+		`gotgbot_api_requests_total{method="sendMessage",code="200"} 1`,
+		`gotgbot_api_requests_total{method="deleteMessage",code="400"} 1`,
+		`gotgbot_api_request_errors_total{method="deleteMessage",code="400"} 1`,
+		`gotgbot_api_request_duration_seconds_count{method="sendMessage"} 1`,
+		`gotgbot_updates_total{type="message"} 1`,
+		`gotgbot_update_duration_seconds_count{type="message"} 1`,
+		`gotgbot_handler_duration_seconds_count{handler="reply"} 1`,
+		`gotgbot_handler_errors_total{handler="reply"} 1`,
+		`gotgbot_dispatcher_max_usage 50`,
+		`gotgbot_dispatcher_usage 0`,
+		`gotgbot_webhook_queue_depth 0`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing metric %q in:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets used by Prometheus, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// helpText contains the descriptions of this package's metrics.
+var helpText = map[string]string{
+	APIRequests:        "Number of requests made to the bot API.",
+	APIRequestErrors:   "Number of failed requests made to the bot API.",
+	APIRequestDuration: "Duration of requests made to the bot API.",
+	Updates:            "Number of processed updates.",
+	UpdateDuration:     "Time taken to process each update.",
+	HandlerDuration:    "Time taken by each matched handler.",
+	HandlerErrors:      "Number of errors returned by handlers.",
+	DispatcherUsage:    "Number of updates currently being processed by the dispatcher.",
+	DispatcherMaxUsage: "Maximum number of updates the dispatcher can process concurrently.",
+	WebhookQueueDepth:  "Number of incoming webhook updates waiting for the dispatcher.",
+}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// Prometheus is a thread-safe Recorder which keeps all metrics in memory, and serves them over HTTP in the
+// Prometheus text exposition format. It has no dependencies on the Prometheus client libraries.
+type Prometheus struct {
+	// buckets are the upper bounds of the histogram buckets.
+	buckets []float64
+
+	lock    sync.Mutex
+	metrics map[string]*metric
+}
+
+type metric struct {
+	typ    metricType
+	series map[string]*series
+}
+
+type series struct {
+	labels []Label
+	// value is the value of counters and gauges.
+	value float64
+	// buckets, sum and count are used by histograms. Buckets are not cumulative.
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// PrometheusOpts can be used to configure or override default Prometheus behaviours.
+type PrometheusOpts struct {
+	// Buckets are the upper bounds of the histogram buckets, in increasing order. Defaults to DefaultBuckets.
+	Buckets []float64
+}
+
+var (
+	_ Recorder     = &Prometheus{}
+	_ http.Handler = &Prometheus{}
+)
+
+// NewPrometheus creates a new Prometheus recorder.
+func NewPrometheus(opts *PrometheusOpts) *Prometheus {
+	buckets := DefaultBuckets
+	if opts != nil && len(opts.Buckets) != 0 {
+		buckets = opts.Buckets
+	}
+
+	return &Prometheus{
+		buckets: buckets,
+		metrics: map[string]*metric{},
+	}
+}
+
+func (p *Prometheus) Add(name string, value float64, labels ...Label) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.getSeries(name, counterType, labels).value += value
+}
+
+func (p *Prometheus) Set(name string, value float64, labels ...Label) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.getSeries(name, gaugeType, labels).value = value
+}
+
+func (p *Prometheus) Observe(name string, value float64, labels ...Label) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := p.getSeries(name, histogramType, labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(p.buckets))
+	}
+	for idx, bound := range p.buckets {
+		if value <= bound {
+			s.buckets[idx]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// getSeries gets (or creates) the series with the given labels. The lock must be held.
+func (p *Prometheus) getSeries(name string, typ metricType, labels []Label) *series {
+	m, ok := p.metrics[name]
+	if !ok {
+		m = &metric{typ: typ, series: map[string]*series{}}
+		p.metrics[name] = m
+	}
+
+	key := formatLabels(labels)
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labels: append([]Label{}, labels...)}
+		m.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP serves all metrics in the Prometheus text format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(w)
+}
+
+// WriteTo writes all metrics to w in the Prometheus text format, sorted by name and labels.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	buf := bytes.Buffer{}
+
+	names := make([]string, 0, len(p.metrics))
+	for name := range p.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := p.metrics[name]
+		if help, ok := helpText[name]; ok {
+			buf.WriteString("# HELP " + name + " " + help + "\n")
+		}
+		buf.WriteString("# TYPE " + name + " " + string(m.typ) + "\n")
+
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := m.series[key]
+			if m.typ != histogramType {
+				buf.WriteString(name + key + " " + formatFloat(s.value) + "\n")
+				continue
+			}
+
+			var cumulative uint64
+			for idx, bound := range p.buckets {
+				cumulative += s.buckets[idx]
+				le := formatLabels(append(append([]Label{}, s.labels...), Label{Name: "le", Value: formatFloat(bound)}))
+				buf.WriteString(name + "_bucket" + le + " " + strconv.FormatUint(cumulative, 10) + "\n")
+			}
+			le := formatLabels(append(append([]Label{}, s.labels...), Label{Name: "le", Value: "+Inf"}))
+			buf.WriteString(name + "_bucket" + le + " " + strconv.FormatUint(s.count, 10) + "\n")
+			buf.WriteString(name + "_sum" + key + " " + formatFloat(s.sum) + "\n")
+			buf.WriteString(name + "_count" + key + " " + strconv.FormatUint(s.count, 10) + "\n")
+		}
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// formatLabels formats labels as {name="value",...}, or an empty string if there are none.
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	bd := strings.Builder{}
+	bd.WriteByte('{')
+	for idx, l := range labels {
+		if idx > 0 {
+			bd.WriteByte(',')
+		}
+		bd.WriteString(l.Name)
+		bd.WriteString(`="`)
+		bd.WriteString(labelEscaper.Replace(l.Value))
+		bd.WriteByte('"')
+	}
+	bd.WriteByte('}')
+	return bd.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
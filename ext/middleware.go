@@ -0,0 +1,59 @@
+package ext
+
+import (
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Middleware wraps a Handler to add behaviour around it, such as logging, authorisation, or timing.
+//
+// Middlewares receive the handler being checked; next.Name() identifies which handler is about to run. A middleware
+// can:
+//   - short-circuit a handler by not calling next.HandleUpdate; returning nil still counts as the handler having
+//     matched, while returning ContinueGroups or EndGroups affects group iteration as usual.
+//   - observe the error returned by next.HandleUpdate, including ContinueGroups and EndGroups.
+//   - change whether a handler matches, by overriding CheckUpdate.
+//
+// MiddlewareHandler makes it easy to only override HandleUpdate.
+type Middleware func(next Handler) Handler
+
+// MiddlewareHandler is a Handler which replaces the HandleUpdate method of the Handler it wraps. All other methods
+// are inherited from the wrapped Handler.
+type MiddlewareHandler struct {
+	// Inlined version of the wrapped handler to inherit methods.
+	Handler
+	// Handle replaces the wrapped handler's HandleUpdate method. Call Handler.HandleUpdate to run the wrapped handler.
+	Handle func(b *gotgbot.Bot, ctx *Context) error
+}
+
+// NewMiddlewareHandler creates a MiddlewareHandler which runs the handle function instead of next.HandleUpdate.
+func NewMiddlewareHandler(next Handler, handle func(b *gotgbot.Bot, ctx *Context) error) MiddlewareHandler {
+	return MiddlewareHandler{
+		Handler: next,
+		Handle:  handle,
+	}
+}
+
+func (m MiddlewareHandler) HandleUpdate(b *gotgbot.Bot, ctx *Context) error {
+	return m.Handle(b, ctx)
+}
+
+// BotCommands exposes the command menu entries of the wrapped handler, if it has any.
+func (m MiddlewareHandler) BotCommands() []BotCommandEntry {
+	if d, ok := m.Handler.(CommandDescriber); ok {
+		return d.BotCommands()
+	}
+	return nil
+}
+
+// WithMiddlewares wraps a single handler with the given middlewares, which will only apply to that handler.
+// The first middleware is the outermost one, and will be called first.
+//
+// For example:
+//
+//	d.AddHandler(ext.WithMiddlewares(handlers.NewCommand("ban", ban), adminOnly, logCalls))
+func WithMiddlewares(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
@@ -0,0 +1,108 @@
+package ext_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+)
+
+// recordMiddleware records the name of the middleware and of the handler it wraps, as well as the handler's result.
+func recordMiddleware(name string, events *[]string) ext.Middleware {
+	return func(next ext.Handler) ext.Handler {
+		return ext.NewMiddlewareHandler(next, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			*events = append(*events, name+">"+next.Name())
+			err := next.HandleUpdate(b, ctx)
+			switch {
+			case errors.Is(err, ext.EndGroups):
+				*events = append(*events, name+"<end")
+			case errors.Is(err, ext.ContinueGroups):
+				*events = append(*events, name+"<continue")
+			default:
+				*events = append(*events, name+"<"+next.Name())
+			}
+			return err
+		})
+	}
+}
+
+func TestDispatcherMiddlewares(t *testing.T) {
+	var events []string
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		Middlewares: []ext.Middleware{recordMiddleware("global", &events)},
+	})
+	d.UseInGroup(1, recordMiddleware("group", &events))
+
+	d.AddHandlerToGroup(handlers.NewNamedhandler("first", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		events = append(events, "first")
+		return ext.ContinueGroups
+	})), 0)
+	d.AddHandlerToGroup(handlers.NewNamedhandler("second", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		events = append(events, "second")
+		return nil
+	})), 0)
+	d.AddHandlerToGroup(ext.WithMiddlewares(
+		handlers.NewNamedhandler("third", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			events = append(events, "third")
+			return ext.EndGroups
+		})),
+		recordMiddleware("handler", &events),
+	), 1)
+	d.AddHandlerToGroup(handlers.NewNamedhandler("unreached", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		t.Error("handler should not run after EndGroups")
+		return nil
+	})), 2)
+
+	err := d.ProcessUpdate(&gotgbot.Bot{}, &gotgbot.Update{Message: &gotgbot.Message{Text: "test text"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error while processing update: %s", err.Error())
+	}
+
+	expected := []string{
+		"global>first", "first", "global<continue",
+		"global>second", "second", "global<second",
+		"global>third", "group>third", "handler>third", "third", "handler<end", "group<end", "global<end",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events:\n%v\ngot:\n%v", expected, events)
+	}
+}
+
+func TestDispatcherMiddlewareShortCircuit(t *testing.T) {
+	const adminId = 1
+
+	d := ext.NewDispatcher(nil)
+	d.Use(func(next ext.Handler) ext.Handler {
+		return ext.NewMiddlewareHandler(next, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			if ctx.EffectiveSender.Id() != adminId {
+				// Stop processing entirely for non-admins.
+				return ext.EndGroups
+			}
+			return next.HandleUpdate(b, ctx)
+		})
+	})
+
+	var runs int
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		runs++
+		return nil
+	}))
+
+	for _, userId := range []int64{adminId, 2} {
+		err := d.ProcessUpdate(&gotgbot.Bot{}, &gotgbot.Update{Message: &gotgbot.Message{
+			Text: "test text",
+			From: &gotgbot.User{Id: userId},
+		}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error while processing update: %s", err.Error())
+		}
+	}
+
+	if runs != 1 {
+		t.Errorf("expected handler to only run for admin, ran %d times", runs)
+	}
+}
@@ -0,0 +1,180 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Call is an API request made to a FakeBotClient.
+type Call struct {
+	// Method is the bot API method, eg sendMessage.
+	Method string `json:"method"`
+	// Params are the request parameters.
+	Params map[string]string `json:"params,omitempty"`
+	// Files are the names of the fields containing uploaded files.
+	Files []string `json:"files,omitempty"`
+}
+
+// FakeBotClient is a gotgbot.BotClient which doesn't make any requests. Instead, it records all calls, and returns a
+// placeholder result matching the return type of each method: true for methods returning a boolean, an empty object
+// for methods returning structs, and so on. Methods returning a union type (eg getChatMember) return one of the union's
+// types; use Responses to return a specific one.
+type FakeBotClient struct {
+	// Responses overrides the results returned for API methods, by method name (eg sendMessage).
+	// Use SetResponse to change responses while requests are being made.
+	Responses map[string]json.RawMessage
+
+	mux   sync.Mutex
+	calls []Call
+}
+
+var (
+	_ gotgbot.BotClient      = &FakeBotClient{}
+	_ gotgbot.FileDownloader = &FakeBotClient{}
+)
+
+// NewFakeBotClient creates a new FakeBotClient.
+func NewFakeBotClient() *FakeBotClient {
+	return &FakeBotClient{
+		Responses: map[string]json.RawMessage{},
+	}
+}
+
+func (c *FakeBotClient) RequestWithContext(_ context.Context, _ string, method string, params map[string]string, data map[string]gotgbot.FileReader, _ *gotgbot.RequestOpts) (json.RawMessage, error) {
+	call := Call{Method: method}
+	if len(params) != 0 {
+		call.Params = make(map[string]string, len(params))
+		for k, v := range params {
+			call.Params[k] = v
+		}
+	}
+	for field := range data {
+		call.Files = append(call.Files, field)
+	}
+	sort.Strings(call.Files)
+
+	c.mux.Lock()
+	c.calls = append(c.calls, call)
+	r, ok := c.Responses[method]
+	c.mux.Unlock()
+
+	if ok {
+		return r, nil
+	}
+	if r, ok := defaultResponses()[method]; ok {
+		return r, nil
+	}
+	return json.RawMessage("true"), nil
+}
+
+// DownloadFileWithContext records the download as a call to the "downloadFile" method, and returns an empty file.
+func (c *FakeBotClient) DownloadFileWithContext(_ context.Context, _ string, tgFilePath string, offset int64, _ *gotgbot.RequestOpts) (io.ReadCloser, error) {
+	c.mux.Lock()
+	c.calls = append(c.calls, Call{
+		Method: "downloadFile",
+		Params: map[string]string{"file_path": tgFilePath, "offset": strconv.FormatInt(offset, 10)},
+	})
+	c.mux.Unlock()
+
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (c *FakeBotClient) GetAPIURL(_ *gotgbot.RequestOpts) string {
+	return gotgbot.DefaultAPIURL
+}
+
+func (c *FakeBotClient) FileURL(token string, tgFilePath string, opts *gotgbot.RequestOpts) string {
+	return c.GetAPIURL(opts) + "/file/bot" + token + "/" + tgFilePath
+}
+
+// SetResponse overrides the result returned for an API method. It is safe to call while requests are being made.
+func (c *FakeBotClient) SetResponse(method string, r json.RawMessage) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.Responses == nil {
+		c.Responses = map[string]json.RawMessage{}
+	}
+	c.Responses[method] = r
+}
+
+// Calls returns all calls made so far.
+func (c *FakeBotClient) Calls() []Call {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return append([]Call{}, c.calls...)
+}
+
+// TakeCalls returns all calls made so far, and clears them.
+func (c *FakeBotClient) TakeCalls() []Call {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	calls := c.calls
+	c.calls = nil
+	return calls
+}
+
+// kindResponses are the placeholder results for methods returning non-struct types.
+var kindResponses = map[reflect.Kind]string{
+	reflect.Bool:    "true",
+	reflect.Slice:   "[]",
+	reflect.String:  `""`,
+	reflect.Int64:   "0",
+	reflect.Float64: "0",
+}
+
+// unionResponses are the placeholder results for methods returning union types, which can only be unmarshalled as one
+// of their concrete types.
+var unionResponses = map[reflect.Type]interface{}{
+	reflect.TypeOf((*gotgbot.ChatMember)(nil)).Elem(): gotgbot.ChatMemberMember{},
+	reflect.TypeOf((*gotgbot.MenuButton)(nil)).Elem(): gotgbot.MenuButtonDefault{},
+}
+
+var (
+	responsesOnce sync.Once
+	responses     map[string]json.RawMessage
+)
+
+// defaultResponses returns placeholder results for each bot API method, based on the return types of the
+// gotgbot.Bot methods.
+func defaultResponses() map[string]json.RawMessage {
+	responsesOnce.Do(func() {
+		responses = map[string]json.RawMessage{}
+
+		t := reflect.TypeOf(&gotgbot.Bot{})
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			// API methods return a result and an error; their WithContext variants have the same results.
+			if strings.HasSuffix(m.Name, "WithContext") || m.Type.NumOut() < 2 {
+				continue
+			}
+
+			name := strings.ToLower(m.Name[:1]) + m.Name[1:]
+			if v, ok := unionResponses[m.Type.Out(0)]; ok {
+				bs, err := json.Marshal(v)
+				if err == nil {
+					responses[name] = bs
+					continue
+				}
+			}
+
+			r, ok := kindResponses[m.Type.Out(0).Kind()]
+			if !ok {
+				// Structs and pointers to structs.
+				r = "{}"
+			}
+			responses[name] = json.RawMessage(r)
+		}
+	})
+	return responses
+}
@@ -0,0 +1,282 @@
+// Package replay records incoming updates, and replays them into a Dispatcher to debug handler routing.
+//
+// A Recorder writes raw updates to a JSON lines file, redacting bot tokens and (optionally) personal information.
+// Recordings are replayed by a Replayer, which feeds each update into a Dispatcher backed by a FakeBotClient, and
+// reports which handlers matched each update, as well as which API calls would have been made.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// RedactedToken replaces bot tokens in recorded updates.
+	RedactedToken = "[redacted-token]"
+	// RedactedText replaces personal information in recorded updates.
+	RedactedText = "[redacted]"
+)
+
+// DefaultPIIFields are the JSON fields which are redacted by default when RecorderOpts.RedactPII is set.
+var DefaultPIIFields = []string{
+	"first_name",
+	"last_name",
+	"username",
+	"active_usernames",
+	"phone_number",
+	"email",
+	"vcard",
+	"bio",
+	"name",
+	"street_line1",
+	"street_line2",
+	"post_code",
+	"latitude",
+	"longitude",
+}
+
+// tokenPattern matches anything which looks like a bot token.
+var tokenPattern = regexp.MustCompile(`\d{5,}:[A-Za-z0-9_-]{30,}`)
+
+// Record is a single recorded update.
+type Record struct {
+	// BotId is the ID of the bot which received the update.
+	BotId int64 `json:"bot_id"`
+	// Time is when the update was recorded.
+	Time time.Time `json:"time"`
+	// Update contains the raw update.
+	Update json.RawMessage `json:"update"`
+}
+
+// Recorder writes updates to a JSON lines file, one Record per line.
+type Recorder struct {
+	// redactPII defines whether piiFields are redacted.
+	redactPII bool
+	// piiFields are the JSON fields to redact.
+	piiFields map[string]struct{}
+	// keepTokens disables token redaction.
+	keepTokens bool
+
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// RecorderOpts can be used to configure or override default Recorder behaviours.
+type RecorderOpts struct {
+	// RedactPII replaces the values of PIIFields in recorded updates: strings are replaced with RedactedText, numbers
+	// with 0, and lists are emptied. IDs are kept, so that updates can still be routed to the right handlers.
+	RedactPII bool
+	// PIIFields are the JSON fields redacted when RedactPII is set.
+	// Defaults to DefaultPIIFields.
+	PIIFields []string
+	// KeepTokens disables bot token redaction. By default, the recording bot's token, as well as anything which looks
+	// like a bot token, is replaced with RedactedToken.
+	KeepTokens bool
+}
+
+var _ ext.UpdateSink = &Recorder{}
+
+// NewRecorder creates a new Recorder, writing records to w.
+func NewRecorder(w io.Writer, opts *RecorderOpts) *Recorder {
+	piiFields := DefaultPIIFields
+	redactPII := false
+	keepTokens := false
+
+	if opts != nil {
+		redactPII = opts.RedactPII
+		keepTokens = opts.KeepTokens
+		if opts.PIIFields != nil {
+			piiFields = opts.PIIFields
+		}
+	}
+
+	fields := make(map[string]struct{}, len(piiFields))
+	for _, f := range piiFields {
+		fields[f] = struct{}{}
+	}
+
+	return &Recorder{
+		redactPII:  redactPII,
+		piiFields:  fields,
+		keepTokens: keepTokens,
+		w:          w,
+	}
+}
+
+// Record writes an update received by a bot.
+func (r *Recorder) Record(b *gotgbot.Bot, update json.RawMessage) error {
+	return r.record(b.Id, b.Token, update)
+}
+
+// Put writes an update received by a bot, allowing the Recorder to be used as an ext.UpdateSink.
+// Since the bot's token is unknown, only values which look like bot tokens are redacted.
+func (r *Recorder) Put(_ context.Context, botId int64, update json.RawMessage) error {
+	return r.record(botId, "", update)
+}
+
+func (r *Recorder) record(botId int64, token string, update json.RawMessage) error {
+	redacted, err := r.redact(update, token)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(Record{
+		BotId:  botId,
+		Time:   time.Now().UTC(),
+		Update: redacted,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, err := r.w.Write(append(bs, '\n')); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+// redact applies the configured redactions to an update.
+func (r *Recorder) redact(update json.RawMessage, token string) (json.RawMessage, error) {
+	dec := json.NewDecoder(strings.NewReader(string(update)))
+	// Keep numbers as-is, to avoid losing precision on IDs.
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %w", ext.ErrInvalidUpdate, err)
+	}
+
+	bs, err := json.Marshal(r.redactValue(v, token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal redacted update: %w", err)
+	}
+	return bs, nil
+}
+
+func (r *Recorder) redactValue(v interface{}, token string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if _, ok := r.piiFields[key]; ok && r.redactPII {
+				v[key] = redactedValue(val)
+				continue
+			}
+			v[key] = r.redactValue(val, token)
+		}
+		return v
+	case []interface{}:
+		for idx, val := range v {
+			v[idx] = r.redactValue(val, token)
+		}
+		return v
+	case string:
+		if r.keepTokens {
+			return v
+		}
+		if token != "" {
+			v = strings.ReplaceAll(v, token, RedactedToken)
+		}
+		return tokenPattern.ReplaceAllString(v, RedactedToken)
+	default:
+		return v
+	}
+}
+
+// redactedValue returns a placeholder of the same JSON type as v, so that redacted updates can still be unmarshalled.
+func redactedValue(v interface{}) interface{} {
+	switch v.(type) {
+	case string:
+		return RedactedText
+	case json.Number:
+		return json.Number("0")
+	case []interface{}:
+		return []interface{}{}
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	default:
+		return v
+	}
+}
+
+// ReadRecords reads all records from a recording.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("failed to decode record %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// RecordingDispatcher is an ext.UpdateDispatcher which records all incoming updates, before passing them on to the
+// wrapped dispatcher.
+type RecordingDispatcher struct {
+	// Dispatcher is the wrapped dispatcher, which processes the updates.
+	Dispatcher ext.UpdateDispatcher
+	// Recorder is where updates are recorded.
+	Recorder *Recorder
+	// UnhandledErrFunc provides more flexibility for dealing with updates which failed to be recorded.
+	// If nil, the error is logged to slog.Default(). Updates are processed even if they can't be recorded.
+	UnhandledErrFunc ext.ErrorFunc
+}
+
+var _ ext.ContextUpdateDispatcher = &RecordingDispatcher{}
+
+// NewRecordingDispatcher wraps a dispatcher to record all the updates it receives.
+func NewRecordingDispatcher(d ext.UpdateDispatcher, r *Recorder) *RecordingDispatcher {
+	return &RecordingDispatcher{
+		Dispatcher: d,
+		Recorder:   r,
+	}
+}
+
+func (d *RecordingDispatcher) Start(b *gotgbot.Bot, updates <-chan json.RawMessage) {
+	d.StartWithContext(context.Background(), b, updates)
+}
+
+// StartWithContext records incoming updates, and passes them on to the wrapped dispatcher. The context is only used if
+// the wrapped dispatcher supports it.
+func (d *RecordingDispatcher) StartWithContext(ctx context.Context, b *gotgbot.Bot, updates <-chan json.RawMessage) {
+	tee := make(chan json.RawMessage)
+	go func() {
+		defer close(tee)
+		for upd := range updates {
+			if err := d.Recorder.Record(b, upd); err != nil {
+				if d.UnhandledErrFunc != nil {
+					d.UnhandledErrFunc(err)
+				} else {
+					slog.Default().Error("Failed to record update", slog.Any(ext.LogKeyError, err), slog.Int64(ext.LogKeyBotId, b.Id))
+				}
+			}
+			tee <- upd
+		}
+	}()
+
+	if cd, ok := d.Dispatcher.(ext.ContextUpdateDispatcher); ok {
+		cd.StartWithContext(ctx, b, tee)
+		return
+	}
+	d.Dispatcher.Start(b, tee)
+}
+
+// Stop stops the wrapped dispatcher.
+func (d *RecordingDispatcher) Stop() {
+	d.Dispatcher.Stop()
+}
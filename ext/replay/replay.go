@@ -0,0 +1,250 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+var ErrMissingRecording = errors.New("missing recording file")
+
+// Result describes how a single recorded update was handled.
+type Result struct {
+	BotId      int64  `json:"bot_id"`
+	UpdateId   int64  `json:"update_id"`
+	UpdateType string `json:"update_type"`
+	// Handlers are the handlers which matched the update, in the order in which they ran.
+	Handlers []HandlerResult `json:"handlers"`
+	// Calls are the API calls which would have been made while handling the update.
+	Calls []Call `json:"calls"`
+	// Error is set if the update could not be processed.
+	Error string `json:"error,omitempty"`
+}
+
+// HandlerResult describes a handler which matched an update.
+type HandlerResult struct {
+	Name string `json:"name"`
+	// Error is the error returned by the handler, if any. ContinueGroups and EndGroups are not reported as errors.
+	Error string `json:"error,omitempty"`
+}
+
+// Replayer feeds recorded updates into a Dispatcher, one at a time.
+type Replayer struct {
+	// Dispatcher processes the replayed updates.
+	Dispatcher *ext.Dispatcher
+	// Client is the BotClient used by the replayed bots; no requests are actually sent.
+	Client *FakeBotClient
+	// BotUser describes the replayed bot. Its ID is replaced by the ID of each record's bot.
+	BotUser gotgbot.User
+
+	mux     sync.Mutex
+	matched []HandlerResult
+}
+
+// ReplayerOpts can be used to configure or override default Replayer behaviours.
+type ReplayerOpts struct {
+	// Client is the FakeBotClient used by the replayed bots, eg to configure responses.
+	// Defaults to NewFakeBotClient().
+	Client *FakeBotClient
+	// BotUser describes the replayed bot; set the username to replay commands addressed to a specific bot.
+	// Defaults to a bot named "replay_bot".
+	BotUser *gotgbot.User
+}
+
+// NewReplayer creates a new Replayer for the given Dispatcher. A global middleware is added to the dispatcher to track
+// matched handlers, so the dispatcher should only be used for replays.
+func NewReplayer(d *ext.Dispatcher, opts *ReplayerOpts) *Replayer {
+	client := NewFakeBotClient()
+	botUser := gotgbot.User{IsBot: true, FirstName: "Replay", Username: "replay_bot"}
+
+	if opts != nil {
+		if opts.Client != nil {
+			client = opts.Client
+		}
+		if opts.BotUser != nil {
+			botUser = *opts.BotUser
+		}
+	}
+
+	r := &Replayer{
+		Dispatcher: d,
+		Client:     client,
+		BotUser:    botUser,
+	}
+	d.Use(r.trackHandlers)
+	return r
+}
+
+// trackHandlers is a middleware which records the handlers which matched the current update.
+func (r *Replayer) trackHandlers(next ext.Handler) ext.Handler {
+	return ext.NewMiddlewareHandler(next, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		err := next.HandleUpdate(b, ctx)
+
+		res := HandlerResult{Name: next.Name()}
+		if err != nil && !errors.Is(err, ext.ContinueGroups) && !errors.Is(err, ext.EndGroups) {
+			res.Error = err.Error()
+		}
+
+		r.mux.Lock()
+		r.matched = append(r.matched, res)
+		r.mux.Unlock()
+		return err
+	})
+}
+
+// Replay processes each record in order, and reports how it was handled.
+func (r *Replayer) Replay(ctx context.Context, records []Record) ([]Result, error) {
+	results := make([]Result, 0, len(records))
+	for _, rec := range records {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results = append(results, r.replayRecord(ctx, rec))
+	}
+	return results, nil
+}
+
+func (r *Replayer) replayRecord(ctx context.Context, rec Record) Result {
+	res := Result{BotId: rec.BotId}
+
+	var upd gotgbot.Update
+	if err := json.Unmarshal(rec.Update, &upd); err != nil {
+		res.Error = "failed to unmarshal update: " + err.Error()
+		return res
+	}
+	res.UpdateId = upd.UpdateId
+	res.UpdateType = upd.GetType()
+
+	botUser := r.BotUser
+	botUser.Id = rec.BotId
+	b := &gotgbot.Bot{
+		User:      botUser,
+		Token:     RedactedToken,
+		BotClient: r.Client,
+	}
+
+	// Discard anything left over from previous updates, eg from handlers started in the background.
+	r.Client.TakeCalls()
+	r.mux.Lock()
+	r.matched = nil
+	r.mux.Unlock()
+
+	if err := r.Dispatcher.ProcessUpdateWithContext(ctx, b, &upd, nil); err != nil {
+		res.Error = err.Error()
+	}
+
+	r.mux.Lock()
+	res.Handlers = r.matched
+	r.matched = nil
+	r.mux.Unlock()
+	res.Calls = r.Client.TakeCalls()
+	return res
+}
+
+// WriteReport writes a human-readable report of the replay results.
+func WriteReport(w io.Writer, results []Result) error {
+	bd := strings.Builder{}
+	for _, res := range results {
+		fmt.Fprintf(&bd, "update %d (%s) for bot %d\n", res.UpdateId, res.UpdateType, res.BotId)
+		if res.Error != "" {
+			fmt.Fprintf(&bd, "  error: %s\n", res.Error)
+		}
+		if len(res.Handlers) == 0 {
+			bd.WriteString("  no handlers matched\n")
+		}
+		for _, h := range res.Handlers {
+			if h.Error != "" {
+				fmt.Fprintf(&bd, "  handler %s: error: %s\n", h.Name, h.Error)
+				continue
+			}
+			fmt.Fprintf(&bd, "  handler %s\n", h.Name)
+		}
+		for _, c := range res.Calls {
+			fmt.Fprintf(&bd, "  call %s%s\n", c.Method, formatParams(c))
+		}
+	}
+
+	_, err := io.WriteString(w, bd.String())
+	return err
+}
+
+// formatParams formats the parameters of a call as sorted key=value pairs. Empty parameters are omitted, to keep the
+// report readable.
+func formatParams(c Call) string {
+	keys := make([]string, 0, len(c.Params))
+	for k, v := range c.Params {
+		if v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bd := strings.Builder{}
+	for _, k := range keys {
+		fmt.Fprintf(&bd, " %s=%q", k, c.Params[k])
+	}
+	for _, f := range c.Files {
+		fmt.Fprintf(&bd, " %s=<file>", f)
+	}
+	return bd.String()
+}
+
+// RunCLI implements a small command line interface to replay a recording into a Dispatcher, and write a report of the
+// results to w. It is intended to be called from a bot's main function, with the bot's own Dispatcher:
+//
+//	replay [-json] [-bot-username name] recording.jsonl
+func RunCLI(ctx context.Context, args []string, d *ext.Dispatcher, w io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(w)
+	asJSON := fs.Bool("json", false, "write results as JSON lines")
+	botUsername := fs.String("bot-username", "replay_bot", "username of the replayed bot")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return ErrMissingRecording
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	records, err := ReadRecords(f)
+	if err != nil {
+		return err
+	}
+
+	r := NewReplayer(d, &ReplayerOpts{
+		BotUser: &gotgbot.User{IsBot: true, FirstName: "Replay", Username: *botUsername},
+	})
+	results, err := r.Replay(ctx, records)
+	if err != nil {
+		return fmt.Errorf("failed to replay recording: %w", err)
+	}
+
+	if !*asJSON {
+		return WriteReport(w, results)
+	}
+
+	enc := json.NewEncoder(w)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return fmt.Errorf("failed to write result: %w", err)
+		}
+	}
+	return nil
+}
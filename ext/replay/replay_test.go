@@ -0,0 +1,262 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/replay"
+)
+
+var errTestHandler = errors.New("test handler error")
+
+const (
+	botToken   = "123456:abcdefghijklmnopqrstuvwxyz0123456789AB"
+	otherToken = "654321:ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789ab"
+)
+
+func TestRecorderRedaction(t *testing.T) {
+	update := `{"update_id": 10, "message": {"message_id": 1, "text": "my token is ` + botToken + ` and ` + otherToken + `",
+		"from": {"id": 99, "is_bot": false, "first_name": "Jane", "username": "jane"},
+		"chat": {"id": 99, "type": "private", "first_name": "Jane"},
+		"location": {"latitude": 51.5, "longitude": -0.12}}}`
+
+	for name, tc := range map[string]struct {
+		opts     *replay.RecorderOpts
+		contains []string
+		excludes []string
+	}{
+		"tokens redacted by default": {
+			opts:     nil,
+			contains: []string{`"first_name":"Jane"`, `"latitude":51.5`, replay.RedactedToken},
+			excludes: []string{botToken, otherToken},
+		},
+		"pii redacted": {
+			opts:     &replay.RecorderOpts{RedactPII: true},
+			contains: []string{`"first_name":"[redacted]"`, `"username":"[redacted]"`, `"latitude":0`, `"id":99`, `"update_id":10`},
+			excludes: []string{"Jane", "jane", botToken},
+		},
+		"custom pii fields": {
+			opts:     &replay.RecorderOpts{RedactPII: true, PIIFields: []string{"text"}},
+			contains: []string{`"text":"[redacted]"`, `"first_name":"Jane"`},
+		},
+		"tokens kept": {
+			opts:     &replay.RecorderOpts{KeepTokens: true},
+			contains: []string{botToken, otherToken},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			r := replay.NewRecorder(&buf, tc.opts)
+			if err := r.Record(&gotgbot.Bot{User: gotgbot.User{Id: 123456}, Token: botToken}, json.RawMessage(update)); err != nil {
+				t.Fatalf("failed to record update: %v", err)
+			}
+
+			out := buf.String()
+			if strings.Count(out, "\n") != 1 {
+				t.Errorf("expected a single line, got: %s", out)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("expected recording to contain %q, got: %s", s, out)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(out, s) {
+					t.Errorf("expected recording to not contain %q, got: %s", s, out)
+				}
+			}
+
+			records, err := replay.ReadRecords(&buf)
+			if err != nil {
+				t.Fatalf("failed to read records: %v", err)
+			}
+			var upd gotgbot.Update
+			if len(records) != 1 || records[0].BotId != 123456 || json.Unmarshal(records[0].Update, &upd) != nil || upd.UpdateId != 10 {
+				t.Errorf("expected redacted update to be readable, got %+v", records)
+			}
+		})
+	}
+}
+
+func TestRecordingDispatcher(t *testing.T) {
+	buf := bytes.Buffer{}
+	received := make(chan string, 1)
+
+	d := ext.NewDispatcher(nil)
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		received <- ctx.EffectiveMessage.Text
+		return nil
+	}))
+	rd := replay.NewRecordingDispatcher(d, replay.NewRecorder(&buf, nil))
+
+	updates := make(chan json.RawMessage)
+	done := make(chan struct{})
+	go func() {
+		rd.Start(&gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: botToken}, updates)
+		close(done)
+	}()
+	updates <- json.RawMessage(`{"update_id": 1, "message": {"text": "hello"}}`)
+	close(updates)
+	<-done
+	rd.Stop()
+
+	if text := <-received; text != "hello" {
+		t.Errorf("expected update to be processed, got %q", text)
+	}
+	records, err := replay.ReadRecords(&buf)
+	if err != nil || len(records) != 1 || records[0].BotId != 1 {
+		t.Errorf("expected update to be recorded, got %+v, %v", records, err)
+	}
+}
+
+func newTestDispatcher() *ext.Dispatcher {
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
+			return ext.DispatcherActionNoop
+		},
+	})
+	d.AddHandler(handlers.NewNamedhandler("start", handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+		_, err := b.SendMessage(ctx.EffectiveChat.Id, "welcome", nil)
+		return err
+	})))
+	d.AddHandler(handlers.NewNamedhandler("delete", handlers.NewMessage(message.Text, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		if _, err := b.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil); err != nil {
+			return err
+		}
+		return errTestHandler
+	})))
+	return d
+}
+
+func TestReplayer(t *testing.T) {
+	records := []replay.Record{
+		{BotId: 1, Update: json.RawMessage(`{"update_id": 1, "message": {"message_id": 5, "text": "/start", "entities": [{"type": "bot_command", "offset": 0, "length": 6}], "chat": {"id": 42, "type": "private"}}}`)},
+		{BotId: 1, Update: json.RawMessage(`{"update_id": 2, "message": {"message_id": 6, "text": "hi", "chat": {"id": 42, "type": "private"}}}`)},
+		{BotId: 1, Update: json.RawMessage(`{"update_id": 3, "callback_query": {"id": "1", "data": "x"}}`)},
+	}
+
+	r := replay.NewReplayer(newTestDispatcher(), nil)
+	results, err := r.Replay(context.Background(), records)
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	if res := results[0]; len(res.Handlers) != 1 || res.Handlers[0].Name != "start" ||
+		len(res.Calls) != 1 || res.Calls[0].Method != "sendMessage" || res.Calls[0].Params["chat_id"] != "42" {
+		t.Errorf("unexpected result for /start: %+v", res)
+	}
+	if res := results[1]; len(res.Handlers) != 1 || res.Handlers[0].Name != "delete" || res.Handlers[0].Error != errTestHandler.Error() ||
+		len(res.Calls) != 1 || res.Calls[0].Method != "deleteMessage" {
+		t.Errorf("unexpected result for text message: %+v", res)
+	}
+	if res := results[2]; res.UpdateType != gotgbot.UpdateTypeCallbackQuery || len(res.Handlers) != 0 || len(res.Calls) != 0 {
+		t.Errorf("unexpected result for callback query: %+v", res)
+	}
+}
+
+func TestRunCLI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create recording: %v", err)
+	}
+	rec := replay.NewRecorder(f, nil)
+	if err := rec.Put(context.Background(), 1, json.RawMessage(`{"update_id": 1, "message": {"message_id": 5, "text": "/start", "entities": [{"type": "bot_command", "offset": 0, "length": 6}], "chat": {"id": 42, "type": "private"}}}`)); err != nil {
+		t.Fatalf("failed to record update: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close recording: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	if err := replay.RunCLI(context.Background(), []string{path}, newTestDispatcher(), &out); err != nil {
+		t.Fatalf("failed to run replay: %v", err)
+	}
+	expected := `update 1 (message) for bot 1
+  handler start
+  call sendMessage chat_id="42" text="welcome"
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := replay.RunCLI(context.Background(), []string{"-json", path}, newTestDispatcher(), &out); err != nil {
+		t.Fatalf("failed to run replay: %v", err)
+	}
+	var res replay.Result
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil || res.UpdateId != 1 || len(res.Calls) != 1 {
+		t.Errorf("unexpected JSON result: %s, %v", out.String(), err)
+	}
+
+	if err := replay.RunCLI(context.Background(), nil, newTestDispatcher(), &out); !errors.Is(err, replay.ErrMissingRecording) {
+		t.Errorf("expected missing recording error, got %v", err)
+	}
+}
+
+func TestFakeBotClientResponses(t *testing.T) {
+	b := &gotgbot.Bot{Token: "SOME_TOKEN", BotClient: replay.NewFakeBotClient()}
+
+	// Union types can only be unmarshalled as one of their concrete types, so need a specific placeholder.
+	v := reflect.ValueOf(b)
+	for i := 0; i < v.NumMethod(); i++ {
+		m := v.Type().Method(i)
+		if strings.HasSuffix(m.Name, "WithContext") || m.Type.NumOut() < 2 || m.Type.Out(0).Kind() != reflect.Interface {
+			continue
+		}
+
+		args := make([]reflect.Value, m.Type.NumIn()-1)
+		for j := range args {
+			args[j] = reflect.Zero(m.Type.In(j + 1))
+		}
+		out := v.Method(i).Call(args)
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			t.Errorf("%s: failed to use placeholder result: %s", m.Name, err.Error())
+		}
+	}
+
+	member, err := b.GetChatMember(1, 2, nil)
+	if err != nil {
+		t.Fatalf("failed to get chat member: %s", err.Error())
+	}
+	if _, ok := member.(gotgbot.ChatMemberMember); !ok {
+		t.Errorf("expected a ChatMemberMember placeholder, got %T", member)
+	}
+}
+
+func TestFakeBotClientSetResponse(t *testing.T) {
+	client := replay.NewFakeBotClient()
+	b := &gotgbot.Bot{Token: "SOME_TOKEN", BotClient: client}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, _ = b.GetChatMember(1, 2, nil)
+		}
+	}()
+	client.SetResponse("getChatMember", json.RawMessage(`{"status": "administrator", "user": {"id": 2}}`))
+	<-done
+
+	member, err := b.GetChatMember(1, 2, nil)
+	if err != nil {
+		t.Fatalf("failed to get chat member: %s", err.Error())
+	}
+	if _, ok := member.(gotgbot.ChatMemberAdministrator); !ok {
+		t.Errorf("expected the overridden response, got %T", member)
+	}
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Client is a gotgbot.BotClient middleware which creates a span for each bot API request. The span is a child of any
+// span contained in the request context.
+type Client struct {
+	// Inlined version of the wrapped client, to inherit the other BotClient methods.
+	gotgbot.BotClient
+	// Tracer is used to create spans.
+	Tracer Tracer
+}
+
+var (
+	_ gotgbot.BotClient         = Client{}
+	_ gotgbot.FileDownloader    = Client{}
+	_ gotgbot.LocalFileResolver = Client{}
+)
+
+// NewClient wraps a BotClient to trace the requests it makes.
+func NewClient(client gotgbot.BotClient, t Tracer) Client {
+	return Client{
+		BotClient: client,
+		Tracer:    t,
+	}
+}
+
+func (c Client) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]gotgbot.FileReader, opts *gotgbot.RequestOpts) (json.RawMessage, error) {
+	attrs := []Attribute{{Key: AttrMethod, Value: method}}
+	if attr, ok := chatIdAttr(params); ok {
+		attrs = append(attrs, attr)
+	}
+
+	ctx, span := c.Tracer.Start(ctx, "api "+method, attrs...)
+	defer span.End()
+
+	r, err := c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	if err != nil {
+		var tgErr *gotgbot.TelegramError
+		if errors.As(err, &tgErr) {
+			span.SetAttributes(Attribute{Key: AttrErrorCode, Value: tgErr.Code})
+		}
+		span.RecordError(err)
+	}
+	return r, err
+}
+
+// DownloadFileWithContext downloads files through the wrapped client. Downloads are not traced.
+func (c Client) DownloadFileWithContext(ctx context.Context, token string, tgFilePath string, offset int64, opts *gotgbot.RequestOpts) (io.ReadCloser, error) {
+	return gotgbot.OpenFile(ctx, c.BotClient, token, tgFilePath, offset, opts)
+}
+
+// LocalFilePath finds local files using the wrapped client.
+func (c Client) LocalFilePath(tgFilePath string) (string, bool) {
+	return gotgbot.ResolveLocalFilePath(c.BotClient, tgFilePath)
+}
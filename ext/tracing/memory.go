@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span, as recorded by the InMemoryTracer.
+type SpanData struct {
+	// Name is the name of the span.
+	Name string
+	// TraceId is shared by all spans in the same trace, as a hex string.
+	TraceId string
+	// SpanId identifies the span, as a hex string.
+	SpanId string
+	// ParentId is the SpanId of the parent span; empty for root spans.
+	ParentId string
+	// Attributes are the attributes set on the span.
+	Attributes map[string]interface{}
+	// Err is the error recorded on the span, if any.
+	Err error
+	// Start and End are the times at which the span started and ended.
+	Start time.Time
+	End   time.Time
+}
+
+// InMemoryTracer is a thread-safe Tracer which keeps all finished spans in memory. It is mostly useful for tests.
+type InMemoryTracer struct {
+	lock  sync.Mutex
+	spans []SpanData
+}
+
+var _ Tracer = &InMemoryTracer{}
+
+// NewInMemoryTracer creates a new InMemoryTracer.
+func NewInMemoryTracer() *InMemoryTracer {
+	return &InMemoryTracer{}
+}
+
+// inMemorySpanKey is the context key used to store the current span of an InMemoryTracer.
+type inMemorySpanKey struct{}
+
+func (t *InMemoryTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &inMemorySpan{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			SpanId:     newId(8),
+			Attributes: map[string]interface{}{},
+			Start:      time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(inMemorySpanKey{}).(*inMemorySpan); ok && parent.tracer == t {
+		s.data.TraceId = parent.data.TraceId
+		s.data.ParentId = parent.data.SpanId
+	} else {
+		s.data.TraceId = newId(16)
+	}
+	s.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, inMemorySpanKey{}, s), s
+}
+
+// Spans returns all finished spans, in the order in which they ended.
+func (t *InMemoryTracer) Spans() []SpanData {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]SpanData{}, t.spans...)
+}
+
+// Reset removes all finished spans.
+func (t *InMemoryTracer) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.spans = nil
+}
+
+type inMemorySpan struct {
+	tracer *InMemoryTracer
+
+	lock  sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *inMemorySpan) SetAttributes(attrs ...Attribute) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *inMemorySpan) RecordError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data.Err = err
+}
+
+func (s *inMemorySpan) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	data.Attributes = make(map[string]interface{}, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	s.lock.Unlock()
+
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.tracer.spans = append(s.tracer.spans, data)
+}
+
+// newId generates a random hex ID of n bytes.
+func newId(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
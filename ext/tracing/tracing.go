@@ -0,0 +1,170 @@
+// Package tracing records traces of update processing: a span for each update, with child spans for each handler which
+// runs, and for each bot API request made while handling it.
+//
+// Spans are created through the Tracer interface, which is modelled after the OpenTelemetry tracing API, so that it
+// can be implemented by a thin adapter around any tracing library; see samples/tracingBot for an OpenTelemetry adapter.
+// InMemoryTracer is a simple implementation which keeps all finished spans in memory, for use in tests.
+//
+// Span contexts are propagated through the ext.Context, which is a context.Context. For API requests to be part of an
+// update's trace, handlers should pass the ext.Context to the *WithContext bot methods:
+//
+//	func reply(b *gotgbot.Bot, ctx *ext.Context) error {
+//		_, err := b.SendMessageWithContext(ctx, ctx.EffectiveChat.Id, "hello", nil)
+//		return err
+//	}
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// The attribute keys set on spans by this package.
+const (
+	AttrBotId        = "gotgbot.bot.id"
+	AttrUpdateId     = "gotgbot.update.id"
+	AttrUpdateType   = "gotgbot.update.type"
+	AttrChatId       = "gotgbot.chat.id"
+	AttrHandler      = "gotgbot.handler"
+	AttrMethod       = "gotgbot.api.method"
+	AttrErrorCode    = "gotgbot.api.error_code"
+	AttrDispatchFlow = "gotgbot.dispatch.flow"
+)
+
+// Attribute is a key-value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer allows you to define custom backends for the spans created by this package.
+type Tracer interface {
+	// Start creates a new span. If the context contains a span from this Tracer, the new span is its child.
+	// The returned context contains the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a single operation within a trace.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+	// RecordError marks the span as failed, with the given error.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// Instrument sets up the dispatcher to trace updates and handlers: its Processor is wrapped with a Processor, and a
+// Middleware is added as a global middleware.
+// API requests are traced by wrapping the bot's BotClient with a Client.
+func Instrument(d *ext.Dispatcher, t Tracer) {
+	d.Processor = NewProcessor(d.Processor, t)
+	d.Use(Middleware(t))
+}
+
+// Processor is an ext.Processor which creates a span for each update. The span is stored in the ext.Context, such that
+// handler and API request spans are its children.
+type Processor struct {
+	// Processor is the wrapped processor.
+	Processor ext.Processor
+	// Tracer is used to create spans.
+	Tracer Tracer
+}
+
+var _ ext.Processor = Processor{}
+
+// NewProcessor wraps a Processor to trace updates. If the processor is nil, ext.BaseProcessor is used.
+func NewProcessor(p ext.Processor, t Tracer) Processor {
+	if p == nil {
+		p = ext.BaseProcessor{}
+	}
+	return Processor{
+		Processor: p,
+		Tracer:    t,
+	}
+}
+
+func (p Processor) ProcessUpdate(d *ext.Dispatcher, b *gotgbot.Bot, ctx *ext.Context) (err error) {
+	updateType := ctx.Update.GetType()
+	attrs := []Attribute{
+		{Key: AttrBotId, Value: b.Id},
+		{Key: AttrUpdateId, Value: ctx.UpdateId},
+		{Key: AttrUpdateType, Value: updateType},
+	}
+	if ctx.EffectiveChat != nil {
+		attrs = append(attrs, Attribute{Key: AttrChatId, Value: ctx.EffectiveChat.Id})
+	}
+
+	parent := ctx.Context
+	var span Span
+	ctx.Context, span = p.Tracer.Start(parent, "update "+updateType, attrs...)
+
+	completed := false
+	defer func() {
+		// Panics are recovered by the Dispatcher; we only mark the span as failed, to avoid changing the stack trace.
+		if !completed {
+			span.RecordError(ext.ErrPanicRecovered)
+		}
+		span.End()
+		ctx.Context = parent
+	}()
+
+	err = p.Processor.ProcessUpdate(d, b, ctx)
+	completed = true
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// Middleware returns an ext.Middleware which creates a span for each handler which runs. While the handler runs, the
+// ext.Context contains the handler span.
+// ContinueGroups and EndGroups are not recorded as errors; they are set as the gotgbot.dispatch.flow attribute instead.
+func Middleware(t Tracer) ext.Middleware {
+	return func(next ext.Handler) ext.Handler {
+		return ext.NewMiddlewareHandler(next, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			parent := ctx.Context
+			var span Span
+			ctx.Context, span = t.Start(parent, "handler "+next.Name(), Attribute{Key: AttrHandler, Value: next.Name()})
+
+			completed := false
+			defer func() {
+				if !completed {
+					span.RecordError(ext.ErrPanicRecovered)
+				}
+				span.End()
+				ctx.Context = parent
+			}()
+
+			err := next.HandleUpdate(b, ctx)
+			completed = true
+			switch {
+			case err == nil:
+			case errors.Is(err, ext.ContinueGroups):
+				span.SetAttributes(Attribute{Key: AttrDispatchFlow, Value: "continue_groups"})
+			case errors.Is(err, ext.EndGroups):
+				span.SetAttributes(Attribute{Key: AttrDispatchFlow, Value: "end_groups"})
+			default:
+				span.RecordError(err)
+			}
+			return err
+		})
+	}
+}
+
+// chatIdAttr returns the chat ID attribute for an API request, if the request has a chat ID.
+func chatIdAttr(params map[string]string) (Attribute, bool) {
+	chatId, ok := params["chat_id"]
+	if !ok {
+		return Attribute{}, false
+	}
+	if id, err := strconv.ParseInt(chatId, 10, 64); err == nil {
+		return Attribute{Key: AttrChatId, Value: id}, true
+	}
+	// Channel usernames.
+	return Attribute{Key: AttrChatId, Value: chatId}, true
+}
@@ -0,0 +1,185 @@
+package tracing_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/tracing"
+)
+
+var errTestHandler = errors.New("test handler error")
+
+func TestTracedBot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: message to delete not found"}`))
+	}))
+	defer server.Close()
+
+	tracer := tracing.NewInMemoryTracer()
+	b := &gotgbot.Bot{
+		User:  gotgbot.User{Id: 1},
+		Token: "SOME_TOKEN",
+		BotClient: tracing.NewClient(&gotgbot.BaseBotClient{
+			DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL},
+		}, tracer),
+	}
+
+	d := ext.NewDispatcher(nil)
+	tracing.Instrument(d, tracer)
+	d.AddHandler(handlers.NewNamedhandler("reply", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		if _, err := b.SendMessageWithContext(ctx, ctx.EffectiveChat.Id, "hello", nil); err != nil {
+			return err
+		}
+		if _, err := b.DeleteMessageWithContext(ctx, ctx.EffectiveChat.Id, 2, nil); err != nil {
+			return errTestHandler
+		}
+		return nil
+	})))
+
+	err := d.ProcessUpdate(b, &gotgbot.Update{UpdateId: 10, Message: &gotgbot.Message{Text: "hello", Chat: gotgbot.Chat{Id: 123}}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error while processing update: %s", err.Error())
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d: %+v", len(spans), spans)
+	}
+	// Spans are recorded in the order in which they end.
+	sendSpan, deleteSpan, handlerSpan, updateSpan := spans[0], spans[1], spans[2], spans[3]
+
+	for name, s := range map[string]struct {
+		span   tracing.SpanData
+		name   string
+		parent tracing.SpanData
+		attrs  map[string]interface{}
+		err    error
+	}{
+		"update": {
+			span: updateSpan,
+			name: "update message",
+			attrs: map[string]interface{}{
+				tracing.AttrBotId:      int64(1),
+				tracing.AttrUpdateId:   int64(10),
+				tracing.AttrUpdateType: "message",
+				tracing.AttrChatId:     int64(123),
+			},
+		},
+		"handler": {
+			span:   handlerSpan,
+			name:   "handler reply",
+			parent: updateSpan,
+			attrs:  map[string]interface{}{tracing.AttrHandler: "reply"},
+			err:    errTestHandler,
+		},
+		"sendMessage": {
+			span:   sendSpan,
+			name:   "api sendMessage",
+			parent: handlerSpan,
+			attrs: map[string]interface{}{
+				tracing.AttrMethod: "sendMessage",
+				tracing.AttrChatId: int64(123),
+			},
+		},
+		"deleteMessage": {
+			span:   deleteSpan,
+			name:   "api deleteMessage",
+			parent: handlerSpan,
+			attrs: map[string]interface{}{
+				tracing.AttrMethod:    "deleteMessage",
+				tracing.AttrChatId:    int64(123),
+				tracing.AttrErrorCode: 400,
+			},
+			err: &gotgbot.TelegramError{},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if s.span.Name != s.name {
+				t.Errorf("expected span name %q, got %q", s.name, s.span.Name)
+			}
+			if s.span.TraceId != updateSpan.TraceId {
+				t.Errorf("expected trace ID %s, got %s", updateSpan.TraceId, s.span.TraceId)
+			}
+			if s.span.ParentId != s.parent.SpanId {
+				t.Errorf("expected parent ID %q, got %q", s.parent.SpanId, s.span.ParentId)
+			}
+			for k, v := range s.attrs {
+				if s.span.Attributes[k] != v {
+					t.Errorf("expected attribute %s=%v (%T), got %v (%T)", k, v, v, s.span.Attributes[k], s.span.Attributes[k])
+				}
+			}
+
+			var tgErr *gotgbot.TelegramError
+			switch {
+			case s.err == nil:
+				if s.span.Err != nil {
+					t.Errorf("unexpected span error: %s", s.span.Err.Error())
+				}
+			case errors.As(s.err, &tgErr):
+				if !errors.As(s.span.Err, &tgErr) {
+					t.Errorf("expected telegram error, got: %v", s.span.Err)
+				}
+			case !errors.Is(s.span.Err, s.err):
+				t.Errorf("expected span error %v, got: %v", s.err, s.span.Err)
+			}
+		})
+	}
+}
+
+func TestTracedPanic(t *testing.T) {
+	tracer := tracing.NewInMemoryTracer()
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		Panic: func(b *gotgbot.Bot, ctx *ext.Context, r interface{}) {},
+	})
+	tracing.Instrument(d, tracer)
+	d.AddHandler(handlers.NewNamedhandler("panic", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		panic("oops")
+	})))
+
+	_ = d.ProcessUpdate(&gotgbot.Bot{}, &gotgbot.Update{Message: &gotgbot.Message{Text: "hello"}}, nil)
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d: %+v", len(spans), spans)
+	}
+	for _, s := range spans {
+		if !errors.Is(s.Err, ext.ErrPanicRecovered) {
+			t.Errorf("expected span %q to record the panic, got: %v", s.Name, s.Err)
+		}
+	}
+}
+
+func TestTracedContinueGroups(t *testing.T) {
+	tracer := tracing.NewInMemoryTracer()
+	d := ext.NewDispatcher(nil)
+	tracing.Instrument(d, tracer)
+	d.AddHandler(handlers.NewNamedhandler("continue", handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return ext.ContinueGroups
+	})))
+
+	if err := d.ProcessUpdate(&gotgbot.Bot{}, &gotgbot.Update{Message: &gotgbot.Message{Text: "hello"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d: %+v", len(spans), spans)
+	}
+	if spans[0].Err != nil || spans[0].Attributes[tracing.AttrDispatchFlow] != "continue_groups" {
+		t.Errorf("expected continue_groups flow without error, got: %+v", spans[0])
+	}
+	if spans[1].Err != nil {
+		t.Errorf("unexpected update span error: %s", spans[1].Err.Error())
+	}
+}
@@ -0,0 +1,320 @@
+package ext
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUpdateLogPollInterval is the default interval at which a FileUpdateLog checks for updates written by other
+// processes.
+const DefaultUpdateLogPollInterval = time.Second
+
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// FileUpdateLog is a durable UpdateSink and UpdateSource, which appends each bot's updates to a JSON lines file.
+// The offset of the last acknowledged update is stored alongside it, so that processing resumes from the first
+// unacknowledged update after a restart.
+//
+// The log files can be shared between processes, such as a webhook receiver writing updates, and a worker reading them;
+// readers check for new updates every PollInterval. Each bot's updates should only be read by one consumer.
+// Log files are not truncated; they should be rotated while no processes are using them.
+type FileUpdateLog struct {
+	// dir is the directory containing the log files.
+	dir string
+	// pollInterval is the interval at which Next checks for updates written by other processes.
+	pollInterval time.Duration
+	// noSync disables syncing the log file after each update.
+	noSync bool
+
+	mux sync.Mutex
+	// writers contains the open log files, by bot ID.
+	writers map[int64]*os.File
+	// readers contains the readers of each bot's log file, by bot ID.
+	readers map[int64]*logReader
+	// notify is closed, and replaced, whenever an update is added.
+	notify chan struct{}
+	closed bool
+}
+
+// FileUpdateLogOpts can be used to configure or override default FileUpdateLog behaviours.
+type FileUpdateLogOpts struct {
+	// PollInterval is the interval at which Next checks for updates written by other processes.
+	// Defaults to DefaultUpdateLogPollInterval.
+	PollInterval time.Duration
+	// NoSync disables syncing the log file to disk after each update. This is faster, but updates may be lost if the
+	// machine crashes.
+	NoSync bool
+}
+
+var (
+	_ UpdateSink   = &FileUpdateLog{}
+	_ UpdateSource = &FileUpdateLog{}
+)
+
+// NewFileUpdateLog creates a new FileUpdateLog, storing its files in the given directory. The directory is created if
+// it doesn't exist.
+func NewFileUpdateLog(dir string, opts *FileUpdateLogOpts) (*FileUpdateLog, error) {
+	pollInterval := DefaultUpdateLogPollInterval
+	noSync := false
+
+	if opts != nil {
+		if opts.PollInterval > 0 {
+			pollInterval = opts.PollInterval
+		}
+		noSync = opts.NoSync
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create update log directory: %w", err)
+	}
+
+	return &FileUpdateLog{
+		dir:          dir,
+		pollInterval: pollInterval,
+		noSync:       noSync,
+		writers:      map[int64]*os.File{},
+		readers:      map[int64]*logReader{},
+		notify:       make(chan struct{}),
+	}, nil
+}
+
+func (l *FileUpdateLog) logPath(botId int64) string {
+	return filepath.Join(l.dir, strconv.FormatInt(botId, 10)+".jsonl")
+}
+
+func (l *FileUpdateLog) offsetPath(botId int64) string {
+	return filepath.Join(l.dir, strconv.FormatInt(botId, 10)+".offset")
+}
+
+// Put appends an update to the bot's log file. The update is compacted, to be stored on a single line.
+func (l *FileUpdateLog) Put(_ context.Context, botId int64, update json.RawMessage) error {
+	buf := bytes.Buffer{}
+	if err := json.Compact(&buf, update); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidUpdate, err)
+	}
+	buf.WriteByte('\n')
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.closed {
+		return ErrUpdateSourceClosed
+	}
+
+	f, ok := l.writers[botId]
+	if !ok {
+		var err error
+		f, err = os.OpenFile(l.logPath(botId), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open update log: %w", err)
+		}
+		l.writers[botId] = f
+	}
+
+	// Updates are written in a single call, so that readers never see interleaved updates.
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if !l.noSync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync update log: %w", err)
+		}
+	}
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+	return nil
+}
+
+// logReader reads a bot's updates from its log file. The file is kept open between reads, so that each update is only
+// read once.
+type logReader struct {
+	// mux is held while reading or acknowledging the bot's updates, so that reads don't block other bots, or Put.
+	mux sync.Mutex
+	// f is the open log file; nil until the file exists.
+	f *os.File
+	// r buffers reads from f.
+	r *bufio.Reader
+	// pos is the file offset of the next update to read.
+	pos int64
+	// loaded is true once pos has been set from the stored offset.
+	loaded bool
+	// partial contains the start of an update which is still being written.
+	partial []byte
+	// closed is true once the FileUpdateLog has been closed.
+	closed bool
+}
+
+// reader returns the bot's logReader, creating it if needed.
+func (l *FileUpdateLog) reader(botId int64) *logReader {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	r, ok := l.readers[botId]
+	if !ok {
+		r = &logReader{}
+		l.readers[botId] = r
+	}
+	return r
+}
+
+// Next returns the next update from the bot's log file, waiting for one to be written if needed.
+func (l *FileUpdateLog) Next(ctx context.Context, botId int64) (SourcedUpdate, error) {
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+
+	r := l.reader(botId)
+	for {
+		l.mux.Lock()
+		if l.closed {
+			l.mux.Unlock()
+			return SourcedUpdate{}, ErrUpdateSourceClosed
+		}
+		notify := l.notify
+		l.mux.Unlock()
+
+		upd, ok, err := l.readNext(botId, r)
+		if err != nil {
+			return SourcedUpdate{}, err
+		}
+		if ok {
+			return upd, nil
+		}
+
+		select {
+		case <-notify:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return SourcedUpdate{}, ctx.Err()
+		}
+	}
+}
+
+// readNext reads the next update from the bot's log file, if a complete one is available.
+func (l *FileUpdateLog) readNext(botId int64, r *logReader) (SourcedUpdate, bool, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.closed {
+		return SourcedUpdate{}, false, ErrUpdateSourceClosed
+	}
+	if !r.loaded {
+		pos, err := l.readOffset(botId)
+		if err != nil {
+			return SourcedUpdate{}, false, err
+		}
+		r.pos = pos
+		r.loaded = true
+	}
+
+	if r.f == nil {
+		f, err := os.Open(l.logPath(botId))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return SourcedUpdate{}, false, nil
+			}
+			return SourcedUpdate{}, false, fmt.Errorf("failed to open update log: %w", err)
+		}
+		if _, err := f.Seek(r.pos, io.SeekStart); err != nil {
+			f.Close()
+			return SourcedUpdate{}, false, fmt.Errorf("failed to seek update log: %w", err)
+		}
+		r.f = f
+		r.r = bufio.NewReader(f)
+	}
+
+	line, err := r.r.ReadBytes('\n')
+	r.partial = append(r.partial, line...)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			// No complete update yet; it may still be being written.
+			return SourcedUpdate{}, false, nil
+		}
+		return SourcedUpdate{}, false, fmt.Errorf("failed to read update log: %w", err)
+	}
+
+	line, r.partial = r.partial, nil
+	r.pos += int64(len(line))
+	return SourcedUpdate{Offset: r.pos, Data: bytes.TrimSuffix(line, []byte{'\n'})}, true, nil
+}
+
+// readOffset reads the offset of the last acknowledged update of a bot.
+func (l *FileUpdateLog) readOffset(botId int64) (int64, error) {
+	bs, err := os.ReadFile(l.offsetPath(botId))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read update log offset: %w", err)
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(bs)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse update log offset: %w", err)
+	}
+	return offset, nil
+}
+
+// Ack stores the offset of the last processed update, such that processing resumes after it after a restart.
+func (l *FileUpdateLog) Ack(_ context.Context, botId int64, offset int64) error {
+	r := l.reader(botId)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	// Write to a temporary file first, so that the offset is replaced atomically.
+	tmp := l.offsetPath(botId) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0o600); err != nil {
+		return fmt.Errorf("failed to write update log offset: %w", err)
+	}
+	if err := os.Rename(tmp, l.offsetPath(botId)); err != nil {
+		return fmt.Errorf("failed to replace update log offset: %w", err)
+	}
+	return nil
+}
+
+// Close closes all open log files. Put and Next return ErrUpdateSourceClosed once the log is closed.
+func (l *FileUpdateLog) Close() error {
+	l.mux.Lock()
+	if l.closed {
+		l.mux.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.notify)
+
+	var errs []error
+	for botId, f := range l.writers {
+		if err := f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close update log for bot %d: %w", botId, err))
+		}
+	}
+	l.writers = nil
+	readers := make([]*logReader, 0, len(l.readers))
+	for _, r := range l.readers {
+		readers = append(readers, r)
+	}
+	l.mux.Unlock()
+
+	// Wait for any ongoing reads to complete before closing the readers.
+	for _, r := range readers {
+		r.mux.Lock()
+		r.closed = true
+		if r.f != nil {
+			// The reader's file is opened read-only, so closing it can't lose any data.
+			_ = r.f.Close()
+		}
+		r.mux.Unlock()
+	}
+	return errors.Join(errs...)
+}
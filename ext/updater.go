@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -20,6 +23,7 @@ var (
 	ErrExpectedEmptyServer  = errors.New("expected server to be nil")
 	ErrNotFound             = errors.New("not found")
 	ErrEmptyPath            = errors.New("empty path")
+	ErrMissingDispatcher    = errors.New("missing dispatcher")
 )
 
 type ErrorFunc func(error)
@@ -28,33 +32,61 @@ type Updater struct {
 	// Dispatcher is where all the incoming updates are sent to be processed.
 	// The Dispatcher runs in a separate goroutine, allowing for parallel update processing and dispatching.
 	// Once the Updater has received an update, it sends it to the Dispatcher over a JSON channel.
+	// Bots can also be added with their own UpdateDispatcher, in which case this one isn't used for them; if all bots
+	// have their own, this can be nil.
 	Dispatcher UpdateDispatcher
+	// JobQueue is an optional JobQueue to run scheduled jobs for the Updater's bots.
+	// It is started once a bot is added to the Updater, and stopped when the Updater is stopped.
+	JobQueue *JobQueue
 
 	// UnhandledErrFunc provides more flexibility for dealing with previously unhandled errors, such as failures to get
 	// updates (when long-polling), or failures to unmarshal.
-	// If nil, the error goes to ErrorLog.
+	// If nil, the error is logged to Logger.
 	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for unexpected behavior, such as polling failures.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
 	// ErrorLog specifies an optional logger for unexpected behavior from handlers.
-	// If nil, logging is done via the log package's standard logger.
+	// If nil, logging is done via slog.Default().
 	ErrorLog *log.Logger
 
 	// stopIdling is the channel that blocks the main thread from exiting, to keep the bots running.
 	stopIdling chan struct{}
 	// webhookServer is the server in charge of receiving all incoming webhook updates.
 	webhookServer *http.Server
+	// healthServer is the server in charge of the health endpoints, if started with StartHealthServer.
+	healthServer *http.Server
 
 	// botMapping keeps track of the data required for each bot, in a thread-safe manner.
 	botMapping botMapping
+
+	// ctx is the Updater's lifecycle context, from which all update contexts are derived. It is cancelled by Stop.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ctxMux protects ctx and cancel.
+	ctxMux sync.Mutex
+
+	// stopping is set once Stop has been called, until a new bot is added.
+	stopping atomic.Bool
+	// webhookInfo caches the getWebhookInfo results used by readiness checks.
+	webhookInfo webhookInfoCache
 }
 
 // UpdaterOpts defines various fields that can be changed to configure a new Updater.
 type UpdaterOpts struct {
+	// JobQueue is an optional JobQueue to run scheduled jobs for the Updater's bots.
+	// It is started once a bot is added to the Updater, and stopped when the Updater is stopped.
+	JobQueue *JobQueue
+
 	// UnhandledErrFunc provides more flexibility for dealing with previously unhandled errors, such as failures to get
 	// updates (when long-polling), or failures to unmarshal.
-	// If nil, the error goes to ErrorLog.
+	// If nil, the error is logged to Logger.
 	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for unexpected behavior, such as polling failures.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
 	// ErrorLog specifies an optional logger for unexpected behavior from handlers.
-	// If nil, logging is done via the log package's standard logger.
+	// If nil, logging is done via slog.Default().
 	ErrorLog *log.Logger
 }
 
@@ -62,29 +94,32 @@ type UpdaterOpts struct {
 func NewUpdater(dispatcher UpdateDispatcher, opts *UpdaterOpts) *Updater {
 	var unhandledErrFunc ErrorFunc
 	var errLog *log.Logger
+	var logger *slog.Logger
+	var jobQueue *JobQueue
 
 	if opts != nil {
 		unhandledErrFunc = opts.UnhandledErrFunc
 		errLog = opts.ErrorLog
+		logger = opts.Logger
+		jobQueue = opts.JobQueue
 	}
 
 	return &Updater{
 		Dispatcher:       dispatcher,
+		JobQueue:         jobQueue,
 		UnhandledErrFunc: unhandledErrFunc,
+		Logger:           logger,
 		ErrorLog:         errLog,
 		botMapping: botMapping{
 			errFunc:  unhandledErrFunc,
+			logger:   logger,
 			errorLog: errLog,
 		},
 	}
 }
 
-func (u *Updater) logf(format string, args ...interface{}) {
-	if u.ErrorLog != nil {
-		u.ErrorLog.Printf(format, args...)
-	} else {
-		log.Printf(format, args...)
-	}
+func (u *Updater) logger() *slog.Logger {
+	return resolveLogger(u.Logger, u.ErrorLog)
 }
 
 // PollingOpts represents the optional values to start long polling.
@@ -107,6 +142,10 @@ type PollingOpts struct {
 	//    long-polling, Telegram responds to your request as soon as new messages are available.
 	//    When setting this, it is recommended you set your PollingOpts.Timeout value to be slightly bigger (eg, +1).
 	GetUpdatesOpts *gotgbot.GetUpdatesOpts
+	// Dispatcher optionally defines a separate UpdateDispatcher for this bot's updates, instead of the Updater's
+	// Dispatcher. This allows for each bot to have its own handlers and concurrency limits.
+	// It is stopped when the bot is stopped, unless it is still used by other bots.
+	Dispatcher UpdateDispatcher
 }
 
 // StartPolling starts polling updates from telegram using getUpdates long-polling.
@@ -119,8 +158,11 @@ func (u *Updater) StartPolling(b *gotgbot.Bot, opts *PollingOpts) error {
 	//  - unnecessary unmarshalling of multiple full Update structs.
 	v := map[string]string{}
 	var reqOpts *gotgbot.RequestOpts
+	var dispatcher UpdateDispatcher
 
 	if opts != nil {
+		dispatcher = opts.Dispatcher
+
 		if opts.EnableWebhookDeletion || opts.DropPendingUpdates {
 			// For polling to work, we want to make sure we don't have an existing webhook.
 			// Extra perk - we can also use this to drop pending updates!
@@ -157,12 +199,23 @@ func (u *Updater) StartPolling(b *gotgbot.Bot, opts *PollingOpts) error {
 		}
 	}
 
-	bData, err := u.botMapping.addBot(b, "", "")
+	if dispatcher == nil && u.Dispatcher == nil {
+		return fmt.Errorf("failed to add bot with long polling: %w", ErrMissingDispatcher)
+	}
+
+	if err := u.startJobQueue(b); err != nil {
+		return err
+	}
+
+	bData, err := u.botMapping.addBot(b, "", "", dispatcher)
 	if err != nil {
 		return fmt.Errorf("failed to add bot with long polling: %w", err)
 	}
+	u.stopping.Store(false)
+	// Polling bots are considered live from the moment they are added.
+	bData.lastPoll.Store(time.Now().UnixNano())
 
-	go u.Dispatcher.Start(b, bData.updateChan)
+	go u.startDispatcher(bData)
 	go u.pollingLoop(bData, reqOpts, v)
 
 	return nil
@@ -182,25 +235,24 @@ func (u *Updater) pollingLoop(bData *botData, opts *gotgbot.RequestOpts, v map[s
 		// unnecessary reallocation of url.Values in the polling loop.
 		r, err := bData.bot.Request("getUpdates", v, nil, opts)
 		if err != nil {
-			if u.UnhandledErrFunc != nil {
-				u.UnhandledErrFunc(err)
-			} else {
-				u.logf("Failed to get updates; sleeping 1s: %s", err.Error())
+			handleUnhandledErr(u.UnhandledErrFunc, u.logger(), "Failed to get updates; sleeping 1s", err,
+				slog.Int64(LogKeyBotId, bData.bot.Id), slog.String(LogKeyMethod, "getUpdates"))
+			if u.UnhandledErrFunc == nil {
 				time.Sleep(time.Second)
 			}
 			continue
 
-		} else if len(r) == 0 {
+		}
+		bData.lastPoll.Store(time.Now().UnixNano())
+
+		if len(r) == 0 {
 			continue
 		}
 
 		var rawUpdates []json.RawMessage
 		if err := json.Unmarshal(r, &rawUpdates); err != nil {
-			if u.UnhandledErrFunc != nil {
-				u.UnhandledErrFunc(err)
-			} else {
-				u.logf("Failed to unmarshal updates: %s", err.Error())
-			}
+			handleUnhandledErr(u.UnhandledErrFunc, u.logger(), "Failed to unmarshal updates", err,
+				slog.Int64(LogKeyBotId, bData.bot.Id), slog.String(LogKeyMethod, "getUpdates"))
 			continue
 		}
 
@@ -214,11 +266,8 @@ func (u *Updater) pollingLoop(bData *botData, opts *gotgbot.RequestOpts, v map[s
 
 		// Only unmarshal the last update, so we can get the next update ID.
 		if err := json.Unmarshal(rawUpdates[len(rawUpdates)-1], &lastUpdate); err != nil {
-			if u.UnhandledErrFunc != nil {
-				u.UnhandledErrFunc(err)
-			} else {
-				u.logf("Failed to unmarshal last update: %s", err.Error())
-			}
+			handleUnhandledErr(u.UnhandledErrFunc, u.logger(), "Failed to unmarshal last update", err,
+				slog.Int64(LogKeyBotId, bData.bot.Id), slog.String(LogKeyMethod, "getUpdates"))
 			continue
 		}
 
@@ -240,11 +289,15 @@ func (u *Updater) Idle() {
 	<-u.stopIdling
 }
 
-// Stop stops the current updater and dispatcher instances.
+// Stop stops the current updater and dispatcher instances, including the dispatchers of bots added with their own.
+// The Context of any updates which are still being processed is cancelled, so that handlers passing it to API calls
+// can return early.
 //
 // When using long polling, Stop() will wait for the getUpdates call to return, which may cause a delay due to the
 // request timeout.
 func (u *Updater) Stop() error {
+	u.stopping.Store(true)
+
 	// Stop any running servers.
 	if u.webhookServer != nil {
 		err := u.webhookServer.Shutdown(context.Background())
@@ -254,10 +307,36 @@ func (u *Updater) Stop() error {
 	}
 
 	// Close all existing bot channels.
-	u.StopAllBots()
+	dispatchers := u.stopAllBots()
+
+	// Cancel any in-flight update processing.
+	u.ctxMux.Lock()
+	if u.cancel != nil {
+		u.cancel()
+		u.ctx, u.cancel = nil, nil
+	}
+	u.ctxMux.Unlock()
+
+	// Stop the dispatchers from processing any further updates.
+	for _, d := range dispatchers {
+		d.Stop()
+	}
+	if u.Dispatcher != nil {
+		u.Dispatcher.Stop()
+	}
+
+	// Wait for any running jobs to complete.
+	if u.JobQueue != nil {
+		u.JobQueue.Stop()
+	}
 
-	// Stop the dispatcher from processing any further updates.
-	u.Dispatcher.Stop()
+	// Keep the health server running until everything else has stopped, so that probes can see the Updater stopping.
+	if u.healthServer != nil {
+		err := u.healthServer.Shutdown(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to shutdown health server: %w", err)
+		}
+	}
 
 	// Finally, atop idling.
 	if u.stopIdling != nil {
@@ -266,6 +345,10 @@ func (u *Updater) Stop() error {
 	return nil
 }
 
+// StopBot stops receiving updates for a single bot, and removes it from the Updater. Other bots are unaffected, so
+// this can be used to remove bots at runtime.
+// If the bot was added with its own dispatcher, StopBot waits for that dispatcher to stop, unless it is still used by
+// other bots.
 func (u *Updater) StopBot(token string) bool {
 	bData, ok := u.botMapping.removeBot(token)
 	if !ok {
@@ -273,13 +356,41 @@ func (u *Updater) StopBot(token string) bool {
 	}
 
 	bData.stop()
+	u.webhookInfo.remove(token)
+	if bData.dispatcher != nil && bData.dispatcher != u.Dispatcher && !u.botMapping.hasDispatcher(bData.dispatcher) {
+		bData.dispatcher.Stop()
+	}
 	return true
 }
 
+// StopAllBots stops receiving updates for all bots, and removes them from the Updater.
+// Any dispatchers which the bots were added with are also stopped.
 func (u *Updater) StopAllBots() {
+	for _, d := range u.stopAllBots() {
+		d.Stop()
+	}
+}
+
+// stopAllBots stops and removes all bots, and returns the distinct dispatchers they were added with, which should be
+// stopped by the caller.
+func (u *Updater) stopAllBots() []UpdateDispatcher {
+	var dispatchers []UpdateDispatcher
 	for _, bData := range u.botMapping.removeAllBots() {
 		bData.stop()
+		u.webhookInfo.remove(bData.bot.Token)
+
+		if bData.dispatcher == nil || bData.dispatcher == u.Dispatcher {
+			continue
+		}
+		seen := false
+		for _, d := range dispatchers {
+			seen = seen || d == bData.dispatcher
+		}
+		if !seen {
+			dispatchers = append(dispatchers, bData.dispatcher)
+		}
 	}
+	return dispatchers
 }
 
 // StartWebhook starts the webhook server for a single bot instance.
@@ -302,9 +413,14 @@ func (u *Updater) StartWebhook(b *gotgbot.Bot, urlPath string, opts WebhookOpts)
 type AddWebhookOpts struct {
 	// The secret token to be used to validate webhook authenticity.
 	SecretToken string
+	// Dispatcher optionally defines a separate UpdateDispatcher for this bot's updates, instead of the Updater's
+	// Dispatcher. This allows for each bot to have its own handlers and concurrency limits.
+	// It is stopped when the bot is stopped, unless it is still used by other bots.
+	Dispatcher UpdateDispatcher
 }
 
 // AddWebhook prepares the webhook server to receive webhook updates for one bot, on a specific path.
+// Bots can be added while the webhook server is running; use StopBot to remove them.
 func (u *Updater) AddWebhook(b *gotgbot.Bot, urlPath string, opts *AddWebhookOpts) error {
 	// We expect webhooks to use unique URL paths; otherwise, we wouldnt be able to differentiate them from polling, or
 	// from each other.
@@ -313,20 +429,77 @@ func (u *Updater) AddWebhook(b *gotgbot.Bot, urlPath string, opts *AddWebhookOpt
 	}
 
 	secretToken := ""
+	var dispatcher UpdateDispatcher
 	if opts != nil {
 		secretToken = opts.SecretToken
+		dispatcher = opts.Dispatcher
 	}
 
-	bData, err := u.botMapping.addBot(b, urlPath, secretToken)
+	if dispatcher == nil && u.Dispatcher == nil {
+		return fmt.Errorf("failed to add webhook for bot: %w", ErrMissingDispatcher)
+	}
+
+	if err := u.startJobQueue(b); err != nil {
+		return err
+	}
+
+	bData, err := u.botMapping.addBot(b, urlPath, secretToken, dispatcher)
 	if err != nil {
 		return fmt.Errorf("failed to add webhook for bot: %w", err)
 	}
+	u.stopping.Store(false)
 
 	// Webhook has been added; relevant dispatcher should also be started.
-	go u.Dispatcher.Start(b, bData.updateChan)
+	go u.startDispatcher(bData)
+	return nil
+}
+
+// startDispatcher starts the bot's dispatcher, or the Updater's Dispatcher, for a bot's updates. If the dispatcher
+// supports it, updates are processed within the Updater's lifecycle context, such that stopping the Updater cancels
+// any in-flight update processing.
+func (u *Updater) startDispatcher(bData *botData) {
+	dispatcher := u.Dispatcher
+	if bData.dispatcher != nil {
+		dispatcher = bData.dispatcher
+	}
+
+	if d, ok := dispatcher.(ContextUpdateDispatcher); ok {
+		d.StartWithContext(u.lifecycleContext(), bData.bot, bData.updateChan)
+		return
+	}
+	dispatcher.Start(bData.bot, bData.updateChan)
+}
+
+// lifecycleContext returns the Updater's lifecycle context, creating a new one if the Updater was previously stopped.
+func (u *Updater) lifecycleContext() context.Context {
+	u.ctxMux.Lock()
+	defer u.ctxMux.Unlock()
+
+	if u.ctx == nil {
+		u.ctx, u.cancel = context.WithCancel(context.Background())
+	}
+	return u.ctx
+}
+
+// startJobQueue makes the bot available to the JobQueue, and starts it if it hasn't been started yet.
+func (u *Updater) startJobQueue(b *gotgbot.Bot) error {
+	if u.JobQueue == nil {
+		return nil
+	}
+
+	u.JobQueue.AddBot(b)
+	if err := u.JobQueue.Start(); err != nil {
+		return fmt.Errorf("failed to start job queue: %w", err)
+	}
 	return nil
 }
 
+// WebhookQueueDepth returns the number of incoming webhook updates, across all bots, which have been received but are
+// still waiting for the Dispatcher to start processing them. A growing queue means that the Dispatcher is saturated.
+func (u *Updater) WebhookQueueDepth() int {
+	return int(u.botMapping.webhookQueueDepth())
+}
+
 // SetAllBotWebhooks sets all the webhooks for the bots that have been added to this updater via AddWebhook.
 func (u *Updater) SetAllBotWebhooks(domain string, opts *gotgbot.SetWebhookOpts) error {
 	for _, data := range u.botMapping.getBots() {
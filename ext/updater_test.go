@@ -335,6 +335,234 @@ func TestUpdaterAllowsWebhookDeletion(t *testing.T) {
 	}
 }
 
+func TestUpdaterStopCancelsUpdates(t *testing.T) {
+	b := &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{},
+	}
+
+	d := ext.NewDispatcher(nil)
+	started := make(chan struct{})
+	var handlerErr error
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		close(started)
+		<-ctx.Done()
+		handlerErr = ctx.Err()
+		return nil
+	}))
+
+	u := ext.NewUpdater(d, nil)
+	if err := u.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %v", err)
+	}
+
+	s := httptest.NewServer(u.GetHandlerFunc("/"))
+	defer s.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.URL+"/test", strings.NewReader(`{"update_id": 1, "message": {"text": "test"}}`))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	r, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send update: %v", err)
+	}
+	r.Body.Close()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+
+	// Stop waits for the dispatcher to finish, so the handler must have returned after being cancelled.
+	if err = u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+	if !errors.Is(handlerErr, context.Canceled) {
+		t.Errorf("expected handler context to be cancelled, got %v", handlerErr)
+	}
+}
+
+func TestUpdaterWebhookQueueDepth(t *testing.T) {
+	b := &gotgbot.Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{},
+	}
+
+	// Only process one update at a time, so that further updates queue up.
+	d := ext.NewDispatcher(&ext.DispatcherOpts{MaxRoutines: 1})
+	release := make(chan struct{})
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		<-release
+		return nil
+	}))
+
+	u := ext.NewUpdater(d, nil)
+	if err := u.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %v", err)
+	}
+
+	s := httptest.NewServer(u.GetHandlerFunc("/"))
+	defer s.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.URL+"/test", strings.NewReader(`{"message": {"text": "test"}}`))
+			if err != nil {
+				t.Errorf("failed to build request: %v", err)
+				return
+			}
+			r, err := s.Client().Do(req)
+			if err != nil {
+				t.Errorf("failed to send update: %v", err)
+				return
+			}
+			r.Body.Close()
+		}()
+	}
+
+	// One update is being processed, one is waiting for the dispatcher's limiter, and one is queued in the webhook.
+	deadline := time.Now().Add(time.Second)
+	for u.WebhookQueueDepth() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if depth := u.WebhookQueueDepth(); depth != 1 {
+		t.Errorf("expected webhook queue depth of 1, got %d", depth)
+	}
+
+	close(release)
+	wg.Wait()
+	if depth := u.WebhookQueueDepth(); depth != 0 {
+		t.Errorf("expected empty webhook queue, got %d", depth)
+	}
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+}
+
+// stopRecordingDispatcher records whether the dispatcher has been stopped.
+type stopRecordingDispatcher struct {
+	*ext.Dispatcher
+	stopped atomic.Bool
+}
+
+func (d *stopRecordingDispatcher) Stop() {
+	d.stopped.Store(true)
+	d.Dispatcher.Stop()
+}
+
+func TestUpdaterPerBotDispatchers(t *testing.T) {
+	received := make(chan string, 10)
+	newDispatcher := func(name string) *stopRecordingDispatcher {
+		d := ext.NewDispatcher(&ext.DispatcherOpts{MaxRoutines: 1})
+		d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			received <- name + ":" + ctx.EffectiveMessage.Text
+			return nil
+		}))
+		return &stopRecordingDispatcher{Dispatcher: d}
+	}
+
+	// No shared dispatcher; each bot has its own.
+	u := ext.NewUpdater(nil, nil)
+	s := httptest.NewServer(u.GetHandlerFunc("/"))
+	defer s.Close()
+
+	send := func(path string) int {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.URL+"/"+path, strings.NewReader(`{"message": {"text": "`+path+`"}}`))
+		if err != nil {
+			t.Fatalf("failed to build request: %v", err)
+		}
+		r, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatalf("failed to send update: %v", err)
+		}
+		r.Body.Close()
+		return r.StatusCode
+	}
+	expect := func(msg string) {
+		select {
+		case got := <-received:
+			if got != msg {
+				t.Errorf("expected %q to be handled, got %q", msg, got)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("timed out waiting for %q to be handled", msg)
+		}
+	}
+
+	b1 := &gotgbot.Bot{Token: "TOKEN_1", BotClient: &gotgbot.BaseBotClient{}}
+	d1 := newDispatcher("first")
+	if err := u.AddWebhook(b1, "one", &ext.AddWebhookOpts{Dispatcher: d1}); err != nil {
+		t.Fatalf("failed to add first bot: %v", err)
+	}
+
+	b2 := &gotgbot.Bot{Token: "TOKEN_2", BotClient: &gotgbot.BaseBotClient{}}
+	d2 := newDispatcher("second")
+	if err := u.AddWebhook(b2, "two", &ext.AddWebhookOpts{Dispatcher: d2}); err != nil {
+		t.Fatalf("failed to add second bot: %v", err)
+	}
+
+	send("one")
+	expect("first:one")
+	send("two")
+	expect("second:two")
+
+	// Removing a bot at runtime stops its dispatcher, and leaves the other bot running.
+	if !u.StopBot(b1.Token) {
+		t.Fatalf("failed to stop first bot")
+	}
+	if !d1.stopped.Load() {
+		t.Errorf("expected first bot's dispatcher to be stopped")
+	}
+	if d2.stopped.Load() {
+		t.Errorf("expected second bot's dispatcher to still be running")
+	}
+	if code := send("one"); code != http.StatusNotFound {
+		t.Errorf("expected removed bot to return 404, got %d", code)
+	}
+	send("two")
+	expect("second:two")
+
+	// A removed bot can be added again, with the same dispatcher.
+	if err := u.AddWebhook(b1, "one", &ext.AddWebhookOpts{Dispatcher: d1}); err != nil {
+		t.Fatalf("failed to re-add first bot: %v", err)
+	}
+	send("one")
+	expect("first:one")
+
+	// Bots can be added while the server is running.
+	b3 := &gotgbot.Bot{Token: "TOKEN_3", BotClient: &gotgbot.BaseBotClient{}}
+	d3 := newDispatcher("third")
+	if err := u.AddWebhook(b3, "three", &ext.AddWebhookOpts{Dispatcher: d3}); err != nil {
+		t.Fatalf("failed to add third bot: %v", err)
+	}
+	send("three")
+	expect("third:three")
+
+	if err := u.Stop(); err != nil {
+		t.Fatalf("failed to stop updater: %v", err)
+	}
+	if !d2.stopped.Load() || !d3.stopped.Load() {
+		t.Errorf("expected all bot dispatchers to be stopped")
+	}
+}
+
+func TestUpdaterRequiresDispatcher(t *testing.T) {
+	b := &gotgbot.Bot{Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+	u := ext.NewUpdater(nil, nil)
+
+	if err := u.AddWebhook(b, "test", nil); !errors.Is(err, ext.ErrMissingDispatcher) {
+		t.Errorf("expected missing dispatcher error for webhook, got %v", err)
+	}
+	if err := u.StartPolling(b, nil); !errors.Is(err, ext.ErrMissingDispatcher) {
+		t.Errorf("expected missing dispatcher error for polling, got %v", err)
+	}
+}
+
 func TestUpdaterSupportsTwoPollingBots(t *testing.T) {
 	server := basicTestServer(t, map[string]*testEndpoint{
 		"getUpdates": {reply: `{"ok": true, "result": []}`},
@@ -0,0 +1,368 @@
+package ext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+var ErrUpdateSourceClosed = errors.New("update source closed")
+
+// UpdateSink stores incoming updates, to be processed elsewhere. Together with an UpdateSource, it allows for update
+// ingestion (eg, a webhook receiver) and update processing (eg, a pool of workers) to be split across services.
+type UpdateSink interface {
+	// Put stores a raw update received for the given bot.
+	Put(ctx context.Context, botId int64, update json.RawMessage) error
+}
+
+// SourcedUpdate is an update read from an UpdateSource.
+type SourcedUpdate struct {
+	// Offset identifies the position of the update in the source; it should be passed to UpdateSource.Ack.
+	Offset int64
+	// Data contains the raw update.
+	Data json.RawMessage
+}
+
+// UpdateSource provides the updates stored by an UpdateSink.
+// Each bot's updates are expected to be read by a single consumer.
+type UpdateSource interface {
+	// Next blocks until an update is available for the given bot, and returns it.
+	// It returns ErrUpdateSourceClosed once the source is closed.
+	Next(ctx context.Context, botId int64) (SourcedUpdate, error)
+	// Ack marks all of a bot's updates up to the given offset as consumed, such that they are not returned again.
+	Ack(ctx context.Context, botId int64, offset int64) error
+}
+
+// SinkDispatcher is an UpdateDispatcher which stores all incoming updates in an UpdateSink, rather than processing
+// them. It allows an Updater to be used for ingestion only.
+type SinkDispatcher struct {
+	// Sink is where all incoming updates are stored.
+	Sink UpdateSink
+
+	// UnhandledErrFunc provides more flexibility for dealing with updates which failed to be stored.
+	// If nil, the error is logged to Logger.
+	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for unexpected behavior, such as failures to store updates.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
+	// ErrorLog specifies an optional logger for unexpected behavior.
+	// If nil, logging is done via slog.Default().
+	ErrorLog *log.Logger
+
+	// waitGroup tracks the running Start calls.
+	waitGroup sync.WaitGroup
+}
+
+// SinkDispatcherOpts can be used to configure or override default SinkDispatcher behaviours.
+type SinkDispatcherOpts struct {
+	// UnhandledErrFunc provides more flexibility for dealing with updates which failed to be stored.
+	// If nil, the error is logged to Logger.
+	UnhandledErrFunc ErrorFunc
+	// Logger specifies an optional structured logger for unexpected behavior, such as failures to store updates.
+	// If nil, ErrorLog is used.
+	Logger *slog.Logger
+	// ErrorLog specifies an optional logger for unexpected behavior.
+	// If nil, logging is done via slog.Default().
+	ErrorLog *log.Logger
+}
+
+var _ UpdateDispatcher = &SinkDispatcher{}
+
+// NewSinkDispatcher creates a new SinkDispatcher, storing updates in the given UpdateSink.
+func NewSinkDispatcher(sink UpdateSink, opts *SinkDispatcherOpts) *SinkDispatcher {
+	var unhandledErrFunc ErrorFunc
+	var logger *slog.Logger
+	var errLog *log.Logger
+
+	if opts != nil {
+		unhandledErrFunc = opts.UnhandledErrFunc
+		logger = opts.Logger
+		errLog = opts.ErrorLog
+	}
+
+	return &SinkDispatcher{
+		Sink:             sink,
+		UnhandledErrFunc: unhandledErrFunc,
+		Logger:           logger,
+		ErrorLog:         errLog,
+	}
+}
+
+// Start stores incoming updates in the Sink, until the updates channel is closed.
+// Updates are stored with a background context, so that stopping the Updater doesn't drop updates it has already
+// received.
+func (d *SinkDispatcher) Start(b *gotgbot.Bot, updates <-chan json.RawMessage) {
+	d.waitGroup.Add(1)
+	defer d.waitGroup.Done()
+
+	for upd := range updates {
+		if err := d.Sink.Put(context.Background(), b.Id, upd); err != nil {
+			handleUnhandledErr(d.UnhandledErrFunc, resolveLogger(d.Logger, d.ErrorLog), "Failed to store update", err,
+				slog.Int64(LogKeyBotId, b.Id))
+		}
+	}
+}
+
+// Stop waits for all received updates to be stored.
+func (d *SinkDispatcher) Stop() {
+	d.waitGroup.Wait()
+}
+
+// ProcessSourceOpts can be used to configure or override default ProcessSource behaviours.
+type ProcessSourceOpts struct {
+	// AckOnHandOff acknowledges updates as soon as they have been handed to the dispatcher, similarly to how long
+	// polling confirms updates before they are processed. This gives at-most-once processing: updates which are still
+	// being processed when the process stops or crashes are not returned by the source again.
+	AckOnHandOff bool
+}
+
+// ProcessSource sends a bot's updates from an UpdateSource to an UpdateDispatcher, until the context is cancelled or
+// the source is closed. This is a blocking method; the dispatcher should be stopped once it returns, to wait for the
+// remaining updates to be processed. If the dispatcher supports it, updates are processed within the given context.
+//
+// When using a *Dispatcher, updates are acknowledged once they have been processed, giving at-least-once processing:
+// updates which were being processed when the process stopped or crashed are returned by the source again.
+// Since updates are processed concurrently, an update is only acknowledged once all the updates before it have also
+// been processed. Other dispatchers don't report when processing is complete, so their updates are acknowledged once
+// handed off, as with ProcessSourceOpts.AckOnHandOff.
+func ProcessSource(ctx context.Context, src UpdateSource, b *gotgbot.Bot, d UpdateDispatcher, opts *ProcessSourceOpts) error {
+	ackOnHandOff := false
+	if opts != nil {
+		ackOnHandOff = opts.AckOnHandOff
+	}
+
+	// readCtx is cancelled if acknowledging a processed update fails, to stop reading new updates.
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	acks := &sourceAcks{src: src, botId: b.Id, cancel: cancel}
+
+	dispatcher, isDispatcher := d.(*Dispatcher)
+	ackOnHandOff = ackOnHandOff || !isDispatcher
+
+	updates := make(chan json.RawMessage)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if !ackOnHandOff {
+			dispatcher.start(ctx, b, updates, acks.processed)
+			return
+		}
+		if cd, ok := d.(ContextUpdateDispatcher); ok {
+			cd.StartWithContext(ctx, b, updates)
+			return
+		}
+		d.Start(b, updates)
+	}()
+	defer func() {
+		close(updates)
+		<-done
+	}()
+
+	for {
+		upd, err := src.Next(readCtx, b.Id)
+		if err != nil {
+			if ackErr := acks.error(); ackErr != nil {
+				return ackErr
+			}
+			if errors.Is(err, ErrUpdateSourceClosed) || readCtx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to get next update: %w", err)
+		}
+
+		if !ackOnHandOff {
+			acks.add(upd.Offset)
+		}
+		select {
+		case updates <- upd.Data:
+		case <-readCtx.Done():
+			return acks.error()
+		}
+
+		if ackOnHandOff {
+			// The update has been handed over; make sure it is acknowledged, even if we are stopping.
+			if err := src.Ack(context.WithoutCancel(ctx), b.Id, upd.Offset); err != nil {
+				return fmt.Errorf("failed to acknowledge update: %w", err)
+			}
+		}
+	}
+}
+
+// sourceAcks acknowledges the updates from an UpdateSource once they have been processed. Updates are only acknowledged
+// once all the updates before them have also been processed, since acknowledging an offset acknowledges all the updates
+// up to it.
+type sourceAcks struct {
+	src   UpdateSource
+	botId int64
+	// cancel stops ProcessSource if an update fails to be acknowledged.
+	cancel context.CancelFunc
+
+	// mux is also held while acknowledging, so that offsets are acknowledged in order.
+	mux sync.Mutex
+	// offsets contains the source offsets of the unacknowledged updates, in the order they were handed off; offsets[0]
+	// is the update with index base.
+	offsets []int64
+	base    int64
+	// done contains the indexes of the processed updates which haven't been acknowledged yet.
+	done map[int64]bool
+	// err is the first error returned when acknowledging updates.
+	err error
+}
+
+// add records the offset of the next update to be handed off.
+func (a *sourceAcks) add(offset int64) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.offsets = append(a.offsets, offset)
+}
+
+// processed marks the update with the given index as processed, and acknowledges all the updates which have been
+// processed so far.
+func (a *sourceAcks) processed(idx int64) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.done == nil {
+		a.done = map[int64]bool{}
+	}
+	a.done[idx] = true
+
+	var offset int64
+	acked := false
+	for a.done[a.base] {
+		delete(a.done, a.base)
+		offset, acked = a.offsets[0], true
+		a.offsets = a.offsets[1:]
+		a.base++
+	}
+	if !acked || a.err != nil {
+		return
+	}
+
+	// The update has been processed; make sure it is acknowledged, even if we are stopping.
+	if err := a.src.Ack(context.Background(), a.botId, offset); err != nil {
+		a.err = fmt.Errorf("failed to acknowledge update: %w", err)
+		a.cancel()
+	}
+}
+
+// error returns the first error returned when acknowledging updates, if any.
+func (a *sourceAcks) error() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.err
+}
+
+// InMemoryUpdateQueue is a thread-safe UpdateSink and UpdateSource which stores updates in memory.
+// It is mostly useful for tests, or for splitting ingestion and processing within the same process.
+type InMemoryUpdateQueue struct {
+	mux    sync.Mutex
+	queues map[int64]*memoryQueue
+	// notify is closed, and replaced, whenever an update is added.
+	notify chan struct{}
+	closed bool
+}
+
+// memoryQueue contains the unacknowledged updates of a bot.
+type memoryQueue struct {
+	// updates are the unacknowledged updates; updates[0] has offset base+1.
+	updates []json.RawMessage
+	base    int64
+	// next is the offset of the last update returned by Next.
+	next int64
+}
+
+var (
+	_ UpdateSink   = &InMemoryUpdateQueue{}
+	_ UpdateSource = &InMemoryUpdateQueue{}
+)
+
+// NewInMemoryUpdateQueue creates a new InMemoryUpdateQueue.
+func NewInMemoryUpdateQueue() *InMemoryUpdateQueue {
+	return &InMemoryUpdateQueue{
+		queues: map[int64]*memoryQueue{},
+		notify: make(chan struct{}),
+	}
+}
+
+func (q *InMemoryUpdateQueue) getQueue(botId int64) *memoryQueue {
+	mq, ok := q.queues[botId]
+	if !ok {
+		mq = &memoryQueue{}
+		q.queues[botId] = mq
+	}
+	return mq
+}
+
+func (q *InMemoryUpdateQueue) Put(_ context.Context, botId int64, update json.RawMessage) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return ErrUpdateSourceClosed
+	}
+
+	mq := q.getQueue(botId)
+	mq.updates = append(mq.updates, update)
+	close(q.notify)
+	q.notify = make(chan struct{})
+	return nil
+}
+
+func (q *InMemoryUpdateQueue) Next(ctx context.Context, botId int64) (SourcedUpdate, error) {
+	for {
+		q.mux.Lock()
+		mq := q.getQueue(botId)
+		if idx := mq.next - mq.base; idx < int64(len(mq.updates)) {
+			mq.next++
+			upd := SourcedUpdate{Offset: mq.next, Data: mq.updates[idx]}
+			q.mux.Unlock()
+			return upd, nil
+		}
+		if q.closed {
+			q.mux.Unlock()
+			return SourcedUpdate{}, ErrUpdateSourceClosed
+		}
+		notify := q.notify
+		q.mux.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return SourcedUpdate{}, ctx.Err()
+		}
+	}
+}
+
+func (q *InMemoryUpdateQueue) Ack(_ context.Context, botId int64, offset int64) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	mq := q.getQueue(botId)
+	if offset <= mq.base {
+		return nil
+	}
+	if offset > mq.next {
+		offset = mq.next
+	}
+	mq.updates = mq.updates[offset-mq.base:]
+	mq.base = offset
+	return nil
+}
+
+// Close closes the queue: Put returns ErrUpdateSourceClosed, and Next does too once all updates have been read.
+func (q *InMemoryUpdateQueue) Close() {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.notify)
+	}
+}
@@ -0,0 +1,321 @@
+package ext_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+)
+
+func TestInMemoryUpdateQueue(t *testing.T) {
+	q := ext.NewInMemoryUpdateQueue()
+	ctx := context.Background()
+
+	for _, upd := range []string{`{"update_id": 1}`, `{"update_id": 2}`} {
+		if err := q.Put(ctx, 1, json.RawMessage(upd)); err != nil {
+			t.Fatalf("failed to put update: %v", err)
+		}
+	}
+
+	first, err := q.Next(ctx, 1)
+	if err != nil || string(first.Data) != `{"update_id": 1}` {
+		t.Fatalf("unexpected first update: %s, %v", first.Data, err)
+	}
+	if err := q.Ack(ctx, 1, first.Offset); err != nil {
+		t.Fatalf("failed to ack update: %v", err)
+	}
+	second, err := q.Next(ctx, 1)
+	if err != nil || string(second.Data) != `{"update_id": 2}` {
+		t.Fatalf("unexpected second update: %s, %v", second.Data, err)
+	}
+
+	// Other bots have separate queues.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Next(timeoutCtx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected empty queue to time out, got %v", err)
+	}
+
+	q.Close()
+	if _, err := q.Next(ctx, 1); !errors.Is(err, ext.ErrUpdateSourceClosed) {
+		t.Errorf("expected closed queue error, got %v", err)
+	}
+	if err := q.Put(ctx, 1, json.RawMessage(`{}`)); !errors.Is(err, ext.ErrUpdateSourceClosed) {
+		t.Errorf("expected closed queue error, got %v", err)
+	}
+}
+
+func TestFileUpdateLogResumes(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	l, err := ext.NewFileUpdateLog(dir, &ext.FileUpdateLogOpts{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create update log: %v", err)
+	}
+	// Multi-line updates are compacted.
+	for _, upd := range []string{"{\n  \"update_id\": 1\n}", `{"update_id": 2}`, `{"update_id": 3}`} {
+		if err := l.Put(ctx, 1, json.RawMessage(upd)); err != nil {
+			t.Fatalf("failed to put update: %v", err)
+		}
+	}
+	if err := l.Put(ctx, 1, json.RawMessage(`not json`)); !errors.Is(err, ext.ErrInvalidUpdate) {
+		t.Errorf("expected invalid update error, got %v", err)
+	}
+
+	first, err := l.Next(ctx, 1)
+	if err != nil || string(first.Data) != `{"update_id":1}` {
+		t.Fatalf("unexpected first update: %s, %v", first.Data, err)
+	}
+	if err := l.Ack(ctx, 1, first.Offset); err != nil {
+		t.Fatalf("failed to ack update: %v", err)
+	}
+	// Read, but never acknowledged.
+	if _, err := l.Next(ctx, 1); err != nil {
+		t.Fatalf("failed to read second update: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close update log: %v", err)
+	}
+
+	// After a restart, reading resumes from the first unacknowledged update.
+	l, err = ext.NewFileUpdateLog(dir, &ext.FileUpdateLogOpts{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to reopen update log: %v", err)
+	}
+	defer l.Close()
+
+	for _, expected := range []string{`{"update_id":2}`, `{"update_id":3}`} {
+		upd, err := l.Next(ctx, 1)
+		if err != nil || string(upd.Data) != expected {
+			t.Errorf("expected %s, got %s, %v", expected, upd.Data, err)
+		}
+	}
+
+	// Updates written by another process are picked up by polling.
+	other, err := ext.NewFileUpdateLog(dir, &ext.FileUpdateLogOpts{NoSync: true})
+	if err != nil {
+		t.Fatalf("failed to open second update log: %v", err)
+	}
+	defer other.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		if err := other.Put(ctx, 1, json.RawMessage(`{"update_id": 4}`)); err != nil {
+			t.Errorf("failed to put update from other log: %v", err)
+		}
+	}()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	upd, err := l.Next(timeoutCtx, 1)
+	if err != nil || string(upd.Data) != `{"update_id":4}` {
+		t.Errorf("expected update from other log, got %s, %v", upd.Data, err)
+	}
+}
+
+func TestSplitIngestionAndProcessing(t *testing.T) {
+	l, err := ext.NewFileUpdateLog(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("failed to create update log: %v", err)
+	}
+	defer l.Close()
+
+	b := &gotgbot.Bot{
+		User:      gotgbot.User{Id: 1},
+		Token:     "SOME_TOKEN",
+		BotClient: &gotgbot.BaseBotClient{},
+	}
+
+	// Ingestion: the webhook receiver stores updates in the log.
+	receiver := ext.NewUpdater(ext.NewSinkDispatcher(l, nil), nil)
+	if err := receiver.AddWebhook(b, "test", nil); err != nil {
+		t.Fatalf("failed to add webhook: %v", err)
+	}
+	s := httptest.NewServer(receiver.GetHandlerFunc("/"))
+	defer s.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.URL+"/test", strings.NewReader(`{"update_id": 1, "message": {"text": "hello"}}`))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	r, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send update: %v", err)
+	}
+	r.Body.Close()
+
+	// Stopping the receiver waits for the update to be stored.
+	if err := receiver.Stop(); err != nil {
+		t.Fatalf("failed to stop receiver: %v", err)
+	}
+
+	// Processing: the worker reads updates from the log.
+	received := make(chan string, 1)
+	d := ext.NewDispatcher(nil)
+	d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		received <- ctx.EffectiveMessage.Text
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ext.ProcessSource(ctx, l, b, d, nil)
+	}()
+
+	select {
+	case text := <-received:
+		if text != "hello" {
+			t.Errorf("expected 'hello', got %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("timed out waiting for update to be processed")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error from ProcessSource: %v", err)
+	}
+	d.Stop()
+}
+
+// ackRecordingSource records the offsets acknowledged through it.
+type ackRecordingSource struct {
+	ext.UpdateSource
+	acks chan int64
+}
+
+func (s ackRecordingSource) Ack(ctx context.Context, botId int64, offset int64) error {
+	s.acks <- offset
+	return s.UpdateSource.Ack(ctx, botId, offset)
+}
+
+// expectAck waits for updates to be acknowledged up to the given offset.
+func expectAck(t *testing.T, acks chan int64, expected int64) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case offset := <-acks:
+			if offset == expected {
+				return
+			}
+		case <-timeout:
+			t.Errorf("timed out waiting for offset %d to be acknowledged", expected)
+			return
+		}
+	}
+}
+
+func TestProcessSourceAcks(t *testing.T) {
+	for _, ackOnHandOff := range []bool{false, true} {
+		ackOnHandOff := ackOnHandOff
+		t.Run("AckOnHandOff="+strconv.FormatBool(ackOnHandOff), func(t *testing.T) {
+			q := ext.NewInMemoryUpdateQueue()
+			src := ackRecordingSource{UpdateSource: q, acks: make(chan int64, 10)}
+			b := &gotgbot.Bot{User: gotgbot.User{Id: 1}, Token: "SOME_TOKEN", BotClient: &gotgbot.BaseBotClient{}}
+
+			release := make(chan struct{})
+			handled := make(chan string, 2)
+			d := ext.NewDispatcher(nil)
+			d.AddHandler(handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				if ctx.EffectiveMessage.Text == "slow" {
+					<-release
+				}
+				handled <- ctx.EffectiveMessage.Text
+				return nil
+			}))
+
+			for _, upd := range []string{`{"update_id": 1, "message": {"text": "slow"}}`, `{"update_id": 2, "message": {"text": "fast"}}`} {
+				if err := q.Put(context.Background(), b.Id, json.RawMessage(upd)); err != nil {
+					t.Fatalf("failed to put update: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- ext.ProcessSource(ctx, src, b, d, &ext.ProcessSourceOpts{AckOnHandOff: ackOnHandOff})
+			}()
+
+			select {
+			case text := <-handled:
+				if text != "fast" {
+					t.Fatalf("expected the fast update to be handled first, got %q", text)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for update to be processed")
+			}
+
+			// The slow update is still being processed.
+			if ackOnHandOff {
+				expectAck(t, src.acks, 2)
+			} else {
+				select {
+				case offset := <-src.acks:
+					t.Errorf("expected no updates to be acknowledged before the first one is processed, got offset %d", offset)
+				default:
+				}
+			}
+
+			close(release)
+			if !ackOnHandOff {
+				expectAck(t, src.acks, 2)
+			}
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("unexpected error from ProcessSource: %v", err)
+			}
+			d.Stop()
+		})
+	}
+}
+
+func TestFileUpdateLogPartialWrites(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	l, err := ext.NewFileUpdateLog(dir, &ext.FileUpdateLogOpts{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create update log: %v", err)
+	}
+	defer l.Close()
+
+	// Simulate another process which has only written part of an update.
+	f, err := os.OpenFile(filepath.Join(dir, "1.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("failed to open log file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(`{"update_id":`); err != nil {
+		t.Fatalf("failed to write partial update: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if upd, err := l.Next(timeoutCtx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected partial update to be skipped, got %s, %v", upd.Data, err)
+	}
+
+	if _, err := f.WriteString("1}\n"); err != nil {
+		t.Fatalf("failed to write rest of update: %v", err)
+	}
+	upd, err := l.Next(ctx, 1)
+	if err != nil || string(upd.Data) != `{"update_id":1}` {
+		t.Errorf("expected complete update, got %s, %v", upd.Data, err)
+	}
+}
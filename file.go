@@ -1,9 +1,17 @@
 package gotgbot
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 // InputFile (https://core.telegram.org/bots/api#inputfile)
@@ -30,10 +38,25 @@ var (
 )
 
 type FileReader struct {
+	// Name is the file name sent to telegram. If empty, it is detected from the file's path, if any.
 	Name string
+	// Data is the one-shot reader containing the file's contents. Once read, the same FileReader cannot be reused;
+	// use Open instead to allow for retrying failed requests.
 	Data io.Reader
+	// Open returns a new reader containing the file's contents each time it is called, and is used instead of Data
+	// when set. This allows for the same FileReader to be sent multiple times, eg when retrying a failed upload.
+	Open func() (io.ReadCloser, error)
+	// Size is the size of the file contents in bytes, used for upload progress reporting. If 0, it is detected from
+	// the data source when possible.
+	Size int64
+	// ContentType is the MIME type of the file. If empty, it is detected from the file name, or from its contents.
+	ContentType string
+	// CacheKey identifies the file's contents in a FileIDCache. If empty, a hash of the contents is used.
+	CacheKey string
 
 	value string
+	// path is the path of the file on disk, if any; used to send local files to local bot API servers.
+	path string
 }
 
 func (f *FileReader) MarshalJSON() ([]byte, error) {
@@ -45,7 +68,7 @@ var ErrAttachmentKeyAlreadyExists = errors.New("key already exists")
 func (f *FileReader) justFiles() {}
 
 func (f *FileReader) Attach(key string, data map[string]FileReader) error {
-	if f.Data == nil {
+	if f.Data == nil && f.Open == nil {
 		// if no data, this must be a string; nothing to "attach".
 		return nil
 	}
@@ -92,3 +115,159 @@ func InputFileByID(fileID string) InputFileOrString {
 func InputFileByReader(name string, r io.Reader) InputFile {
 	return &FileReader{Name: name, Data: r}
 }
+
+// InputFileByPath is used to send a file from disk. The file is opened when the request is sent, and reopened if the
+// same InputFile is sent again; this allows for failed uploads to be retried.
+// When running against a local bot API server, the path is sent instead of the file contents.
+//
+// For example:
+//
+//	m, err := b.SendVideo(<chat_id>, gotgbot.InputFileByPath("videos/large.mp4"), nil)
+func InputFileByPath(path string) InputFile {
+	return &FileReader{
+		Name: filepath.Base(path),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+		path: path,
+	}
+}
+
+// InputFileByReaderAt is used to send the first size bytes of an io.ReaderAt. Unlike InputFileByReader, the same
+// InputFile can be sent multiple times; this allows for failed uploads to be retried.
+func InputFileByReaderAt(name string, r io.ReaderAt, size int64) InputFile {
+	return &FileReader{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(r, 0, size)), nil
+		},
+		Size: size,
+	}
+}
+
+// InputFileByBytes is used to send a byte slice as a file. Unlike InputFileByReader, the same InputFile can be sent
+// multiple times; this allows for failed uploads to be retried.
+func InputFileByBytes(name string, data []byte) InputFile {
+	return &FileReader{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+		Size: int64(len(data)),
+	}
+}
+
+// replaceAttachment replaces all references to an attached file in the request params with the given value, such as a
+// file_id or URL; the file itself can then be removed from the request data.
+func replaceAttachment(params map[string]string, key string, value string) {
+	attachRef := "attach://" + key
+	jsonAttachRef, _ := json.Marshal(attachRef)
+	jsonValue, _ := json.Marshal(value)
+	for k, v := range params {
+		if v == attachRef {
+			params[k] = value
+			continue
+		}
+		// Files in InputMedia and similar objects are referenced from inside JSON values.
+		params[k] = strings.ReplaceAll(v, string(jsonAttachRef), string(jsonValue))
+	}
+}
+
+// reader returns a reader for the file's contents, opening the file if needed.
+func (f *FileReader) reader() (io.ReadCloser, error) {
+	if f.Open != nil {
+		return f.Open()
+	}
+	// One-shot readers are owned by the caller, so are not closed.
+	return io.NopCloser(f.Data), nil
+}
+
+// fileName returns the name of the file, detecting it from the file's path if it has not been set.
+func (f *FileReader) fileName() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	if f.path != "" {
+		return filepath.Base(f.path)
+	}
+	if named, ok := f.Data.(interface{ Name() string }); ok {
+		return filepath.Base(named.Name())
+	}
+	return ""
+}
+
+// size returns the size of the file contents, or -1 if it is unknown.
+func (f *FileReader) size() int64 {
+	if f.Size > 0 {
+		return f.Size
+	}
+	if f.path != "" {
+		if stat, err := os.Stat(f.path); err == nil {
+			return stat.Size()
+		}
+		return -1
+	}
+	switch r := f.Data.(type) {
+	case interface{ Len() int }:
+		// Eg bytes.Buffer, bytes.Reader and strings.Reader.
+		return int64(r.Len())
+	case *os.File:
+		stat, err := r.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return stat.Size() - offset
+	}
+	return -1
+}
+
+// totalFileSize returns the total size of all the files, or -1 if any of their sizes are unknown.
+func totalFileSize(data map[string]FileReader) int64 {
+	var total int64
+	for _, file := range data {
+		file := file
+		size := file.size()
+		if size < 0 {
+			return -1
+		}
+		total += size
+	}
+	return total
+}
+
+// detectContentType returns the content type of a file, using (in order) its ContentType field, its file extension,
+// or its first 512 bytes. The returned reader must be used instead of the input reader.
+func detectContentType(file FileReader, fileName string, r io.Reader) (io.Reader, string, error) {
+	if file.ContentType != "" {
+		return r, file.ContentType, nil
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(fileName)); contentType != "" {
+		return r, contentType, nil
+	}
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, "", fmt.Errorf("failed to read file header: %w", err)
+	}
+	return br, http.DetectContentType(head), nil
+}
+
+// progressWriter reports the number of file bytes written to the multipart form.
+type progressWriter struct {
+	w        io.Writer
+	progress UploadProgressFunc
+	sent     int64
+	total    int64
+}
+
+func (p *progressWriter) Write(bs []byte) (int, error) {
+	n, err := p.w.Write(bs)
+	p.sent += int64(n)
+	p.progress(p.sent, p.total)
+	return n, err
+}
@@ -0,0 +1,420 @@
+package gotgbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrFileIDNotFound = errors.New("file ID not found")
+
+// FileIDStore stores the file IDs of files which have been uploaded to telegram, for use by a FileIDCache.
+// Implementations backed by persistent storage allow for file IDs to be reused across restarts.
+type FileIDStore interface {
+	// GetFileID returns the file ID stored for a key, or ErrFileIDNotFound if there is none.
+	GetFileID(key string) (string, error)
+	// SetFileID stores the file ID for a key.
+	SetFileID(key string, fileId string) error
+	// DeleteFileID removes the file ID stored for a key; for example, when telegram no longer accepts it.
+	DeleteFileID(key string) error
+}
+
+// InMemoryFileIDStore is an in-memory implementation of the FileIDStore interface.
+type InMemoryFileIDStore struct {
+	// ids is the map of cache keys to file IDs.
+	ids map[string]string
+
+	// lock allows for concurrent access to the ids map.
+	lock sync.RWMutex
+}
+
+var _ FileIDStore = &InMemoryFileIDStore{}
+
+func NewInMemoryFileIDStore() *InMemoryFileIDStore {
+	return &InMemoryFileIDStore{
+		ids: map[string]string{},
+	}
+}
+
+func (s *InMemoryFileIDStore) GetFileID(key string) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	fileId, ok := s.ids[key]
+	if !ok {
+		return "", ErrFileIDNotFound
+	}
+	return fileId, nil
+}
+
+func (s *InMemoryFileIDStore) SetFileID(key string, fileId string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ids[key] = fileId
+	return nil
+}
+
+func (s *InMemoryFileIDStore) DeleteFileID(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.ids, key)
+	return nil
+}
+
+// FileIDCache is a BotClient which avoids re-uploading identical files. Once telegram returns a file_id for an
+// uploaded file, it is stored; when the same file is sent again, its file_id is sent instead of the file contents.
+//
+// Files are identified by their FileReader.CacheKey if set, or by a hash of their contents otherwise. Note that
+// hashing a one-shot reader (eg from InputFileByReader) requires reading it into memory.
+// Files are only cached when sent with one of the Send* methods for media (eg Bot.SendPhoto, Bot.SendDocument,
+// Bot.SendMediaGroup) or with Bot.EditMessageMedia. If telegram rejects a cached file_id, it is removed from the store
+// and the file is uploaded again.
+//
+// For example:
+//
+//	b.BotClient = gotgbot.NewFileIDCache(b.BotClient, nil)
+type FileIDCache struct {
+	// BotClient is the wrapped client, used to make requests.
+	BotClient
+	// Store is used to store file IDs.
+	Store FileIDStore
+}
+
+var (
+	_ BotClient         = &FileIDCache{}
+	_ FileDownloader    = &FileIDCache{}
+	_ LocalFileResolver = &FileIDCache{}
+)
+
+// FileIDCacheOpts contains the optional fields for the NewFileIDCache constructor.
+type FileIDCacheOpts struct {
+	// Store is used to store file IDs. Defaults to an InMemoryFileIDStore; use a persistent store to keep file IDs
+	// across restarts.
+	Store FileIDStore
+}
+
+// NewFileIDCache wraps a BotClient with a FileIDCache.
+func NewFileIDCache(client BotClient, opts *FileIDCacheOpts) *FileIDCache {
+	var store FileIDStore = NewInMemoryFileIDStore()
+	if opts != nil && opts.Store != nil {
+		store = opts.Store
+	}
+
+	return &FileIDCache{
+		BotClient: client,
+		Store:     store,
+	}
+}
+
+// RequestWithContext replaces any cached files with their file_id, before sending the request with the wrapped
+// BotClient. The file IDs of any uploaded files are then stored.
+func (c *FileIDCache) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]FileReader, opts *RequestOpts) (json.RawMessage, error) {
+	mediaTypes := cacheableFiles(method, params)
+	if len(data) == 0 || len(mediaTypes) == 0 {
+		return c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	}
+
+	// Map of data keys to cache keys.
+	cacheKeys := map[string]string{}
+	data = copyFileReaders(data)
+	for field, file := range data {
+		mediaType, ok := mediaTypes[field]
+		if !ok {
+			continue
+		}
+
+		key, err := fileCacheKey(&file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cache key for field %s: %w", field, err)
+		}
+		data[field] = file
+		cacheKeys[field] = mediaType + ":" + key
+	}
+
+	cachedParams := copyParams(params)
+	cachedData := copyFileReaders(data)
+	var cached []string
+	for field, key := range cacheKeys {
+		fileId, err := c.Store.GetFileID(key)
+		if err != nil {
+			if errors.Is(err, ErrFileIDNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get cached file ID for field %s: %w", field, err)
+		}
+
+		replaceAttachment(cachedParams, field, fileId)
+		delete(cachedData, field)
+		cached = append(cached, key)
+	}
+
+	// Record where the uploaded readers start, so that they can be sent again if a cached file ID is rejected.
+	offsets, rewindable := readerOffsets(cachedData)
+
+	r, err := c.BotClient.RequestWithContext(ctx, token, method, cachedParams, cachedData, opts)
+	if err != nil && len(cached) > 0 && isInvalidFileIDError(err) {
+		// A cached file ID is no longer valid; forget them all, and upload the files again.
+		for _, key := range cached {
+			if err := c.Store.DeleteFileID(key); err != nil {
+				return nil, fmt.Errorf("failed to delete invalid file ID: %w", err)
+			}
+		}
+		if !rewindable {
+			// Some of the files have already been read, and can't be sent again.
+			return nil, err
+		}
+		if err := rewindReaders(cachedData, offsets); err != nil {
+			return nil, fmt.Errorf("failed to rewind files: %w", err)
+		}
+		cachedData = data
+		r, err = c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for field, fileId := range uploadedFileIDs(method, r, mediaTypes) {
+		if _, ok := cachedData[field]; !ok {
+			// This file wasn't uploaded, so was either already cached or not cacheable.
+			continue
+		}
+		key, ok := cacheKeys[field]
+		if !ok {
+			continue
+		}
+		if err := c.Store.SetFileID(key, fileId); err != nil {
+			return nil, fmt.Errorf("failed to store file ID for field %s: %w", field, err)
+		}
+	}
+	return r, nil
+}
+
+// DownloadFileWithContext opens a file using the wrapped BotClient.
+func (c *FileIDCache) DownloadFileWithContext(ctx context.Context, token string, tgFilePath string, offset int64, opts *RequestOpts) (io.ReadCloser, error) {
+	return OpenFile(ctx, c.BotClient, token, tgFilePath, offset, opts)
+}
+
+// LocalFilePath finds local files using the wrapped client.
+func (c *FileIDCache) LocalFilePath(tgFilePath string) (string, bool) {
+	return ResolveLocalFilePath(c.BotClient, tgFilePath)
+}
+
+// cacheableMethods maps methods with a single file to the name of their file field, which is also the media type.
+var cacheableMethods = map[string]string{
+	"sendPhoto":     "photo",
+	"sendDocument":  "document",
+	"sendVideo":     "video",
+	"sendAudio":     "audio",
+	"sendAnimation": "animation",
+	"sendVoice":     "voice",
+	"sendVideoNote": "video_note",
+	"sendSticker":   "sticker",
+}
+
+// cacheableFiles returns the data keys of the files which can be cached for a method, mapped to their media type.
+func cacheableFiles(method string, params map[string]string) map[string]string {
+	if field, ok := cacheableMethods[method]; ok {
+		return map[string]string{field: field}
+	}
+
+	switch method {
+	case "sendMediaGroup":
+		var media []struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(params["media"]), &media); err != nil {
+			return nil
+		}
+		mediaTypes := map[string]string{}
+		for idx, m := range media {
+			mediaTypes["media"+strconv.Itoa(idx)] = m.Type
+		}
+		return mediaTypes
+
+	case "editMessageMedia":
+		var media struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(params["media"]), &media); err != nil {
+			return nil
+		}
+		return map[string]string{"media": media.Type}
+	}
+	return nil
+}
+
+// uploadedFileIDs returns the file IDs in a method's response, mapped to the data key of the file they were sent as.
+func uploadedFileIDs(method string, r json.RawMessage, mediaTypes map[string]string) map[string]string {
+	fileIds := map[string]string{}
+	if method == "sendMediaGroup" {
+		var msgs []Message
+		if err := json.Unmarshal(r, &msgs); err != nil {
+			return nil
+		}
+		for idx, msg := range msgs {
+			field := "media" + strconv.Itoa(idx)
+			if fileId := messageFileID(msg, mediaTypes[field]); fileId != "" {
+				fileIds[field] = fileId
+			}
+		}
+		return fileIds
+	}
+
+	var msg Message
+	if err := json.Unmarshal(r, &msg); err != nil {
+		// Eg editMessageMedia on inline messages, which returns true.
+		return nil
+	}
+	for field, mediaType := range mediaTypes {
+		if fileId := messageFileID(msg, mediaType); fileId != "" {
+			fileIds[field] = fileId
+		}
+	}
+	return fileIds
+}
+
+// messageFileID returns the file ID of the given media type in a message, if any.
+func messageFileID(msg Message, mediaType string) string {
+	switch mediaType {
+	case "photo":
+		// Use the largest photo size, to avoid losing quality when resending.
+		var fileId string
+		var largest int64
+		for _, p := range msg.Photo {
+			if size := p.Width * p.Height; fileId == "" || size > largest {
+				fileId, largest = p.FileId, size
+			}
+		}
+		return fileId
+	case "document":
+		if msg.Document != nil {
+			return msg.Document.FileId
+		}
+	case "video":
+		if msg.Video != nil {
+			return msg.Video.FileId
+		}
+	case "audio":
+		if msg.Audio != nil {
+			return msg.Audio.FileId
+		}
+	case "animation":
+		if msg.Animation != nil {
+			return msg.Animation.FileId
+		}
+	case "voice":
+		if msg.Voice != nil {
+			return msg.Voice.FileId
+		}
+	case "video_note":
+		if msg.VideoNote != nil {
+			return msg.VideoNote.FileId
+		}
+	case "sticker":
+		if msg.Sticker != nil {
+			return msg.Sticker.FileId
+		}
+	}
+	return ""
+}
+
+// fileCacheKey returns the cache key of a file; either its CacheKey, or the hash of its contents.
+// One-shot readers are read into memory, and replaced with a reader over the read contents.
+func fileCacheKey(file *FileReader) (string, error) {
+	if file.CacheKey != "" {
+		return file.CacheKey, nil
+	}
+
+	h := sha256.New()
+	if file.Open != nil {
+		r, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open file: %w", err)
+		}
+		defer r.Close()
+
+		if _, err = io.Copy(h, r); err != nil {
+			return "", fmt.Errorf("failed to hash file: %w", err)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	bs, err := io.ReadAll(file.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if file.Name == "" {
+		// Keep the detected name, since the original reader is being replaced.
+		file.Name = file.fileName()
+	}
+	file.Data = bytes.NewReader(bs)
+	h.Write(bs)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readerOffsets returns the current offsets of the one-shot readers in data. Files with an Open function are reopened
+// each time they are sent, so don't need rewinding. Returns false if any one-shot reader can't be rewound.
+func readerOffsets(data map[string]FileReader) (map[string]int64, bool) {
+	offsets := map[string]int64{}
+	for field, file := range data {
+		if file.Open != nil || file.Data == nil {
+			continue
+		}
+		s, ok := file.Data.(io.Seeker)
+		if !ok {
+			return nil, false
+		}
+		offset, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, false
+		}
+		offsets[field] = offset
+	}
+	return offsets, true
+}
+
+// rewindReaders seeks the one-shot readers in data back to the offsets returned by readerOffsets.
+func rewindReaders(data map[string]FileReader, offsets map[string]int64) error {
+	for field, offset := range offsets {
+		s, ok := data[field].Data.(io.Seeker)
+		if !ok {
+			continue
+		}
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind field %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// isInvalidFileIDError returns true if telegram rejected a request due to an invalid file ID.
+func isInvalidFileIDError(err error) bool {
+	var tgErr *TelegramError
+	return errors.As(err, &tgErr) && strings.Contains(strings.ToLower(tgErr.Description), "file identifier")
+}
+
+func copyParams(params map[string]string) map[string]string {
+	newParams := make(map[string]string, len(params))
+	for k, v := range params {
+		newParams[k] = v
+	}
+	return newParams
+}
+
+func copyFileReaders(data map[string]FileReader) map[string]FileReader {
+	newData := make(map[string]FileReader, len(data))
+	for k, v := range data {
+		newData[k] = v
+	}
+	return newData
+}
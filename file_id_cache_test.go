@@ -0,0 +1,200 @@
+package gotgbot
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/internal/apitest"
+)
+
+func newFileIDCacheTestBot(t *testing.T, invalidFileIds map[string]bool) (*Bot, *apitest.Server) {
+	server := apitest.NewServer(t, &apitest.ServerOpts{
+		Reply: func(req apitest.Request) string {
+			for fileId := range invalidFileIds {
+				if strings.Contains(req.Params["document"], fileId) || strings.Contains(req.Params["media"], fileId) {
+					return `{"ok": false, "error_code": 400, "description": "Bad Request: wrong file identifier/HTTP URL specified"}`
+				}
+			}
+
+			var result interface{}
+			switch req.Method {
+			case "sendPhoto":
+				result = Message{Photo: []PhotoSize{
+					{FileId: "photo-small", Width: 90, Height: 90},
+					{FileId: "photo-large", Width: 800, Height: 800},
+					{FileId: "photo-medium", Width: 320, Height: 320},
+				}}
+			case "sendDocument":
+				result = Message{Document: &Document{FileId: "doc-" + strings.Join(req.Uploaded(), ",")}}
+			case "sendMediaGroup":
+				result = []Message{
+					{Document: &Document{FileId: "group-doc-0"}},
+					{Document: &Document{FileId: "group-doc-1"}},
+				}
+			}
+			bs, _ := json.Marshal(map[string]interface{}{"ok": true, "result": result})
+			return string(bs)
+		},
+	})
+
+	return &Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: NewFileIDCache(&BaseBotClient{DefaultRequestOpts: &RequestOpts{APIURL: server.URL}}, nil),
+	}, server
+}
+
+func TestFileIDCache(t *testing.T) {
+	b, server := newFileIDCacheTestBot(t, nil)
+
+	send := func(f func() error) {
+		t.Helper()
+		if err := f(); err != nil {
+			t.Fatalf("failed to send: %s", err.Error())
+		}
+	}
+	send(func() error {
+		_, err := b.SendDocument(1, InputFileByReader("a.txt", strings.NewReader("contents")), nil)
+		return err
+	})
+	send(func() error {
+		// Same contents, different reader and name.
+		_, err := b.SendDocument(1, InputFileByBytes("b.txt", []byte("contents")), nil)
+		return err
+	})
+	send(func() error {
+		// Same contents, but as a photo.
+		_, err := b.SendPhoto(1, InputFileByBytes("c.jpg", []byte("contents")), nil)
+		return err
+	})
+	send(func() error {
+		_, err := b.SendPhoto(1, InputFileByBytes("c.jpg", []byte("contents")), nil)
+		return err
+	})
+	send(func() error {
+		_, err := b.SendMediaGroup(1, []InputMedia{
+			InputMediaDocument{Media: InputFileByBytes("a.txt", []byte("contents"))},
+			InputMediaDocument{Media: InputFileByBytes("d.txt", []byte("other contents"))},
+		}, nil)
+		return err
+	})
+	send(func() error {
+		_, err := b.SendDocument(1, InputFileByBytes("d.txt", []byte("other contents")), nil)
+		return err
+	})
+
+	requests := server.Requests()
+	for idx, expected := range []struct {
+		uploaded string
+		field    string
+		value    string
+	}{
+		{uploaded: "document", field: "document", value: "attach://document"},
+		{field: "document", value: "doc-document"},
+		{uploaded: "photo", field: "photo", value: "attach://photo"},
+		{field: "photo", value: "photo-large"},
+		{uploaded: "media1", field: "media", value: `"media":"doc-document"`},
+		{field: "document", value: "group-doc-1"},
+	} {
+		req := requests[idx]
+		if strings.Join(req.Uploaded(), ",") != expected.uploaded || !strings.Contains(req.Params[expected.field], expected.value) {
+			t.Errorf("request %d: expected upload %q and %s containing %q, got %q and %q", idx, expected.uploaded, expected.field, expected.value, req.Uploaded(), req.Params[expected.field])
+		}
+	}
+}
+
+func TestFileIDCacheKey(t *testing.T) {
+	b, server := newFileIDCacheTestBot(t, nil)
+
+	for _, contents := range []string{"v1", "v2"} {
+		file := &FileReader{Name: "a.txt", Data: strings.NewReader(contents), CacheKey: "logo"}
+		if _, err := b.SendDocument(1, file, nil); err != nil {
+			t.Fatalf("failed to send document: %s", err.Error())
+		}
+	}
+
+	if req := server.Requests()[1]; len(req.Files) != 0 || req.Params["document"] != "doc-document" {
+		t.Errorf("expected cache key to be used, got %+v", req)
+	}
+}
+
+func TestFileIDCacheInvalidFileID(t *testing.T) {
+	b, server := newFileIDCacheTestBot(t, map[string]bool{"expired-id": true})
+	cache, ok := b.BotClient.(*FileIDCache)
+	if !ok {
+		t.Fatalf("expected a FileIDCache, got %T", b.BotClient)
+	}
+
+	file := &FileReader{Name: "a.txt", Data: strings.NewReader("contents")}
+	key, err := fileCacheKey(file)
+	if err != nil {
+		t.Fatalf("failed to get cache key: %s", err.Error())
+	}
+	_ = cache.Store.SetFileID("document:"+key, "expired-id")
+
+	msg, err := b.SendDocument(1, file, nil)
+	if err != nil {
+		t.Fatalf("failed to send document: %s", err.Error())
+	}
+	if requests := server.Requests(); msg.Document.FileId != "doc-document" || len(requests) != 2 || len(requests[1].Files) != 1 {
+		t.Errorf("expected file to be re-uploaded after invalid file ID, got %+v", requests)
+	}
+
+	if fileId, err := cache.Store.GetFileID("document:" + key); err != nil || fileId != "doc-document" {
+		t.Errorf("expected new file ID to be stored, got %q (%v)", fileId, err)
+	}
+}
+
+func TestFileIDCacheInvalidFileIDReader(t *testing.T) {
+	for name, tc := range map[string]struct {
+		thumbnail io.Reader
+		retried   bool
+	}{
+		"seekable reader is rewound": {
+			thumbnail: strings.NewReader("thumbnail"),
+			retried:   true,
+		},
+		"one-shot reader is not resent": {
+			thumbnail: io.MultiReader(strings.NewReader("thumbnail")),
+			retried:   false,
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			b, server := newFileIDCacheTestBot(t, map[string]bool{"expired-id": true})
+			cache, ok := b.BotClient.(*FileIDCache)
+			if !ok {
+				t.Fatalf("expected a FileIDCache, got %T", b.BotClient)
+			}
+			_ = cache.Store.SetFileID("document:logo", "expired-id")
+
+			file := &FileReader{Name: "a.txt", Data: strings.NewReader("contents"), CacheKey: "logo"}
+			_, err := b.SendDocument(1, file, &SendDocumentOpts{
+				Thumbnail: InputFileByReader("thumb.jpg", tc.thumbnail),
+			})
+
+			if !tc.retried {
+				if !isInvalidFileIDError(err) || len(server.Requests()) != 1 {
+					t.Errorf("expected invalid file ID error without a retry, got %v after %d requests", err, len(server.Requests()))
+				}
+				if _, err := cache.Store.GetFileID("document:logo"); !errors.Is(err, ErrFileIDNotFound) {
+					t.Errorf("expected invalid file ID to be deleted, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to send document: %s", err.Error())
+			}
+			requests := server.Requests()
+			if len(requests) != 2 {
+				t.Fatalf("expected a retry, got %d requests", len(requests))
+			}
+			if retry := requests[1]; retry.Files["document"].Contents != "contents" || retry.Files["thumbnail"].Contents != "thumbnail" {
+				t.Errorf("expected full file contents to be re-uploaded, got %+v", retry.Files)
+			}
+		})
+	}
+}
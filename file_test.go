@@ -0,0 +1,90 @@
+package gotgbot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/internal/apitest"
+)
+
+func newUploadTestBot(t *testing.T, fail bool) (*Bot, *apitest.Server) {
+	server := apitest.NewServer(t, &apitest.ServerOpts{
+		Reply: func(req apitest.Request) string {
+			if fail {
+				return `{"ok": false, "error_code": 500, "description": "Internal Server Error"}`
+			}
+			return `{"ok": true, "result": {"message_id": 1}}`
+		},
+	})
+
+	return &Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &BaseBotClient{DefaultRequestOpts: &RequestOpts{APIURL: server.URL}},
+	}, server
+}
+
+func TestFileSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte(testFileContents), 0o600); err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+	pngHeader := "\x89PNG\x0D\x0A\x1A\x0A"
+
+	for name, test := range map[string]struct {
+		file     InputFile
+		expected apitest.UploadedFile
+	}{
+		"path": {
+			file:     InputFileByPath(path),
+			expected: apitest.UploadedFile{FileName: "notes.txt", ContentType: "text/plain; charset=utf-8", Contents: testFileContents},
+		},
+		"reader at": {
+			file:     InputFileByReaderAt("notes.txt", strings.NewReader(testFileContents+"ignored"), 18),
+			expected: apitest.UploadedFile{FileName: "notes.txt", ContentType: "text/plain; charset=utf-8", Contents: testFileContents},
+		},
+		"bytes without extension": {
+			file:     InputFileByBytes("image", []byte(pngHeader)),
+			expected: apitest.UploadedFile{FileName: "image", ContentType: "image/png", Contents: pngHeader},
+		},
+		"explicit content type": {
+			file:     &FileReader{Name: "data", Data: strings.NewReader("{}"), ContentType: "application/json"},
+			expected: apitest.UploadedFile{FileName: "data", ContentType: "application/json", Contents: "{}"},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			b, server := newUploadTestBot(t, false)
+			if _, err := b.SendDocument(1, test.file, nil); err != nil {
+				t.Fatalf("failed to send document: %s", err.Error())
+			}
+			if reqs := server.Requests(); len(reqs) != 1 || len(reqs[0].Files) != 1 || reqs[0].Files["document"] != test.expected {
+				t.Errorf("expected upload %+v, got %+v", test.expected, reqs)
+			}
+		})
+	}
+}
+
+func TestFileSourceRetry(t *testing.T) {
+	b, server := newUploadTestBot(t, true)
+	file := InputFileByBytes("file.txt", []byte(testFileContents))
+
+	var lastSent, lastTotal int64
+	opts := &SendDocumentOpts{RequestOpts: &RequestOpts{UploadProgress: func(sent int64, total int64) {
+		lastSent, lastTotal = sent, total
+	}}}
+	for i := 0; i < 2; i++ {
+		if _, err := b.SendDocument(1, file, opts); err == nil {
+			t.Fatalf("expected upload %d to fail", i)
+		}
+		if lastSent != 18 || lastTotal != 18 {
+			t.Errorf("expected final progress of 18/18, got %d/%d", lastSent, lastTotal)
+		}
+	}
+
+	reqs := server.Requests()
+	if len(reqs) != 2 || reqs[0].Files["document"].Contents != testFileContents || reqs[1].Files["document"].Contents != testFileContents {
+		t.Errorf("expected file to be uploaded in full twice, got %+v", reqs)
+	}
+}
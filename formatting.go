@@ -12,6 +12,7 @@ var mdMap = map[string]string{
 	"bold":   "*",
 	"italic": "_",
 	"code":   "`",
+	"pre":    "```",
 }
 
 var mdV2Map = map[string]string{
@@ -79,6 +80,12 @@ func getOrigMsgMD(utf16Data []uint16, ents []MessageEntity) string {
 		text := utf16.Decode(utf16Data[ent.Offset:newPrev])
 		pre, cleanCntnt, post := splitEdgeWhitespace(string(text), ent)
 		cleanCntntRune := []rune(cleanCntnt)
+		if cleanCntnt == "" {
+			// Whitespace-only entities can't be represented; keep the whitespace as plain text.
+			out.WriteString(prevText + string(text))
+			prev = newPrev
+			continue
+		}
 
 		switch ent.Type {
 		case "bold", "italic", "code":
@@ -201,8 +208,8 @@ func writeFinalHTML(data []uint16, ent MessageEntity, start int64, cntnt string)
 		if ent.Language == "" {
 			return prevText + "<pre>" + cntnt + "</pre>"
 		}
-		// <pre><code class="lang">text</code></pre>
-		return prevText + `<pre><code class="` + ent.Language + `">` + cntnt + "</code></pre>"
+		// <pre><code class="language-lang">text</code></pre>
+		return prevText + `<pre><code class="language-` + ent.Language + `">` + cntnt + "</code></pre>"
 	case "custom_emoji":
 		return prevText + `<tg-emoji emoji-id="` + ent.CustomEmojiId + `">` + cntnt + "</tg-emoji>"
 	case "text_mention":
@@ -229,6 +236,10 @@ func closeHTMLTag(s string) string {
 func writeFinalMarkdownV2(data []uint16, ent MessageEntity, start int64, cntnt string) string {
 	prevText := string(utf16.Decode(data[start:ent.Offset]))
 	pre, cleanCntnt, post := splitEdgeWhitespace(cntnt, ent)
+	if cleanCntnt == "" {
+		// Whitespace-only entities can't be represented; keep the whitespace as plain text.
+		return prevText + cntnt
+	}
 	switch ent.Type {
 	case "bold", "italic", "code", "underline", "strikethrough", "spoiler":
 		return prevText + pre + mdV2Map[ent.Type] + cleanCntnt + mdV2Map[ent.Type] + post
@@ -283,22 +294,20 @@ func getChildEntities(ent MessageEntity, ents []MessageEntity) []MessageEntity {
 }
 
 func splitEdgeWhitespace(text string, ent MessageEntity) (pre string, cntnt string, post string) {
-	keepNewLines := ent.Type == "pre"
-
-	bd := strings.Builder{}
-	rText := []rune(text)
-	for i := 0; i < len(rText) && unicode.IsSpace(rText[i]) && (!keepNewLines || rText[i] != '\n'); i++ {
-		bd.WriteRune(rText[i])
+	switch ent.Type {
+	case "pre", "code":
+		// Whitespace is meaningful in code, so it is kept as-is.
+		return "", text, ""
+	case "blockquote", "expandable_blockquote":
+		// Quotes must start at the beginning of a line, so leading whitespace stays inside. Trailing newlines would
+		// create empty quote lines, so those are moved out.
+		cntnt = strings.TrimRight(text, "\n")
+		return "", cntnt, text[len(cntnt):]
 	}
-	pre = bd.String()
 
-	text = strings.TrimPrefix(text, pre)
-	bd.Reset()
-	for i := len(rText) - 1; i >= 0 && unicode.IsSpace(rText[i]); i-- {
-		bd.WriteRune(rText[i])
-	}
-	post = bd.String()
-	return pre, strings.TrimSuffix(text, post), post
+	cntnt = strings.TrimRightFunc(text, unicode.IsSpace)
+	trimmed := strings.TrimLeftFunc(cntnt, unicode.IsSpace)
+	return cntnt[:len(cntnt)-len(trimmed)], trimmed, text[len(cntnt):]
 }
 
 func escapeContainedMDV1(data []rune, mdType []rune) string {
@@ -0,0 +1,352 @@
+// Package formatting provides helpers to safely generate formatted message texts for telegram's parse modes.
+//
+// User-provided strings should never be inserted into formatted texts without escaping them first; doing so will
+// either cause telegram to reject the message, or allow users to inject their own formatting.
+package formatting
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Formatter generates formatted texts for a specific parse mode. All the helper methods take plain, unescaped, text,
+// and escape it as required.
+//
+// To nest entities, either use a template (see Formatter.ParseTemplate), or use gotgbot.TextBuilder to avoid parse
+// modes altogether.
+type Formatter struct {
+	parseMode  string
+	escape     func(s string) string
+	escapeCode func(s string) string
+	escapeURL  func(s string) string
+	// escapeContents escapes plain text to be used inside the given entity. If nil, escapeCode is used for code and
+	// pre entities, and escape for all others.
+	escapeContents func(entity gotgbot.MessageEntity, s string) string
+	// wrap formats already escaped contents as the given entity.
+	wrap func(entity gotgbot.MessageEntity, contents string) string
+}
+
+var (
+	// MarkdownV2 generates texts for gotgbot.ParseModeMarkdownV2.
+	MarkdownV2 = Formatter{
+		parseMode:  gotgbot.ParseModeMarkdownV2,
+		escape:     EscapeMarkdownV2,
+		escapeCode: EscapeMarkdownV2Code,
+		escapeURL:  EscapeMarkdownV2URL,
+		wrap:       wrapMarkdownV2,
+	}
+
+	// Markdown generates texts for the legacy gotgbot.ParseModeMarkdown, which only supports bold, italic, code, pre,
+	// link and mention entities; other entities are formatted as plain text. Entities can't be nested, and characters
+	// which would end an entity are placed between two copies of it, as telegram recommends.
+	// Use MarkdownV2 or HTML for new code.
+	Markdown = Formatter{
+		parseMode:      gotgbot.ParseModeMarkdown,
+		escape:         EscapeMarkdown,
+		escapeCode:     EscapeMarkdownCode,
+		escapeURL:      EscapeMarkdownURL,
+		escapeContents: escapeMarkdownContents,
+		wrap:           wrapMarkdown,
+	}
+
+	// HTML generates texts for gotgbot.ParseModeHTML.
+	HTML = Formatter{
+		parseMode:  gotgbot.ParseModeHTML,
+		escape:     EscapeHTML,
+		escapeCode: EscapeHTML,
+		escapeURL:  EscapeHTML,
+		wrap:       wrapHTML,
+	}
+)
+
+// ParseMode returns the parse mode to send the generated texts with.
+func (f Formatter) ParseMode() string {
+	return f.parseMode
+}
+
+// Escape escapes plain text, so that it can be used anywhere in a formatted text, apart from code entities and URLs.
+func (f Formatter) Escape(s string) string {
+	return f.escape(s)
+}
+
+// EscapeCode escapes plain text to be used inside code entities. For all parse modes apart from legacy Markdown, this
+// also applies to pre entities.
+func (f Formatter) EscapeCode(s string) string {
+	return f.escapeCode(s)
+}
+
+// EscapeURL escapes a URL to be used in a link.
+func (f Formatter) EscapeURL(s string) string {
+	return f.escapeURL(s)
+}
+
+// Entity formats plain text as any entity type. The entity's Offset and Length are ignored.
+// Unsupported entity types, such as those detected automatically by telegram (eg hashtags), are simply escaped.
+func (f Formatter) Entity(entity gotgbot.MessageEntity, s string) string {
+	return f.wrap(entity, f.escapeEntity(entity, s))
+}
+
+// escapeEntity escapes plain text to be used inside the given entity.
+func (f Formatter) escapeEntity(entity gotgbot.MessageEntity, s string) string {
+	if f.escapeContents != nil {
+		return f.escapeContents(entity, s)
+	}
+	if entity.Type == "code" || entity.Type == "pre" {
+		return f.escapeCode(s)
+	}
+	return f.escape(s)
+}
+
+// Bold formats plain text as bold.
+func (f Formatter) Bold(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "bold"}, s)
+}
+
+// Italic formats plain text as italic.
+func (f Formatter) Italic(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "italic"}, s)
+}
+
+// Underline formats plain text as underlined.
+func (f Formatter) Underline(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "underline"}, s)
+}
+
+// Strikethrough formats plain text as strikethrough.
+func (f Formatter) Strikethrough(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "strikethrough"}, s)
+}
+
+// Spoiler formats plain text as a spoiler.
+func (f Formatter) Spoiler(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "spoiler"}, s)
+}
+
+// Code formats plain text as inline monospace code.
+func (f Formatter) Code(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "code"}, s)
+}
+
+// Pre formats plain text as a code block. The language is optional.
+func (f Formatter) Pre(s string, language string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "pre", Language: language}, s)
+}
+
+// Link formats plain text as a link to the given URL.
+func (f Formatter) Link(s string, url string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "text_link", Url: url}, s)
+}
+
+// Mention formats plain text as a mention of the user with the given ID. This works for users without usernames.
+func (f Formatter) Mention(s string, userId int64) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "text_mention", User: &gotgbot.User{Id: userId}}, s)
+}
+
+// CustomEmoji formats a custom emoji. The emoji parameter is the regular emoji shown to clients which can't display
+// the custom one.
+func (f Formatter) CustomEmoji(emoji string, customEmojiId string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "custom_emoji", CustomEmojiId: customEmojiId}, emoji)
+}
+
+// Blockquote formats plain text as a block quotation. Quotes must start on a new line.
+func (f Formatter) Blockquote(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "blockquote"}, s)
+}
+
+// ExpandableBlockquote formats plain text as a block quotation which is collapsed by default. Quotes must start on
+// a new line.
+func (f Formatter) ExpandableBlockquote(s string) string {
+	return f.Entity(gotgbot.MessageEntity{Type: "expandable_blockquote"}, s)
+}
+
+// EscapeMarkdownV2 escapes plain text for MarkdownV2, outside of code entities and URLs.
+func EscapeMarkdownV2(s string) string {
+	return escapeChars(s, "_*[]()~`>#+-=|{}.!\\")
+}
+
+// EscapeMarkdownV2Code escapes plain text for MarkdownV2 code and pre entities.
+func EscapeMarkdownV2Code(s string) string {
+	return escapeChars(s, "`\\")
+}
+
+// EscapeMarkdownV2URL escapes a URL for MarkdownV2 links.
+func EscapeMarkdownV2URL(s string) string {
+	return escapeChars(s, ")\\")
+}
+
+// EscapeMarkdown escapes plain text for legacy Markdown, outside of entities.
+//
+// Note: Legacy Markdown does not allow for escaping inside entities; use the Markdown formatter to format entities.
+func EscapeMarkdown(s string) string {
+	return escapeChars(s, "_*`[")
+}
+
+// EscapeMarkdownCode escapes plain text for legacy Markdown code entities. Backticks can't be escaped, so the code
+// entity is closed before each of them, and reopened after it.
+func EscapeMarkdownCode(s string) string {
+	return escapeMarkdownContents(gotgbot.MessageEntity{Type: "code"}, s)
+}
+
+// EscapeMarkdownURL escapes a URL for legacy Markdown links. Brackets can't be escaped, so they are percent-encoded.
+func EscapeMarkdownURL(s string) string {
+	return strings.ReplaceAll(s, ")", "%29")
+}
+
+// EscapeHTML escapes plain text for HTML. The same escaping applies to text, code entities, and attribute values.
+func EscapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// escapeChars prefixes all the given characters in s with a backslash.
+func escapeChars(s string, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+
+	bd := strings.Builder{}
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			bd.WriteByte('\\')
+		}
+		bd.WriteRune(r)
+	}
+	return bd.String()
+}
+
+func wrapMarkdownV2(entity gotgbot.MessageEntity, contents string) string {
+	switch entity.Type {
+	case "bold":
+		return "*" + contents + "*"
+	case "italic":
+		// "__" is always read as underline; the \r character is ignored, and is used to separate the markers.
+		if strings.HasPrefix(contents, "_") {
+			contents = "\r" + contents
+		}
+		if strings.HasSuffix(contents, "_") {
+			contents += "\r"
+		}
+		return "_" + contents + "_"
+	case "underline":
+		if strings.HasSuffix(contents, "_") {
+			contents += "\r"
+		}
+		return "__" + contents + "__"
+	case "strikethrough":
+		return "~" + contents + "~"
+	case "spoiler":
+		return "||" + contents + "||"
+	case "code":
+		return "`" + contents + "`"
+	case "pre":
+		return "```" + entity.Language + "\n" + contents + "```"
+	case "text_link":
+		return "[" + contents + "](" + EscapeMarkdownV2URL(entity.Url) + ")"
+	case "text_mention":
+		return "[" + contents + "](tg://user?id=" + strconv.FormatInt(userId(entity), 10) + ")"
+	case "custom_emoji":
+		return "![" + contents + "](tg://emoji?id=" + EscapeMarkdownV2URL(entity.CustomEmojiId) + ")"
+	case "blockquote":
+		return ">" + strings.ReplaceAll(contents, "\n", "\n>")
+	case "expandable_blockquote":
+		return "**>" + strings.ReplaceAll(contents, "\n", "\n>") + "||"
+	default:
+		return contents
+	}
+}
+
+// markdownMarkers returns the legacy Markdown markers which open and close an entity, if it is supported.
+func markdownMarkers(entity gotgbot.MessageEntity) (string, string, bool) {
+	switch entity.Type {
+	case "bold":
+		return "*", "*", true
+	case "italic":
+		return "_", "_", true
+	case "code":
+		return "`", "`", true
+	case "pre":
+		if entity.Language == "" {
+			return "```", "```", true
+		}
+		return "```" + entity.Language + "\n", "```", true
+	case "text_link":
+		return "[", "](" + EscapeMarkdownURL(entity.Url) + ")", true
+	case "text_mention":
+		return "[", "](tg://user?id=" + strconv.FormatInt(userId(entity), 10) + ")", true
+	default:
+		return "", "", false
+	}
+}
+
+// escapeMarkdownContents escapes plain text for use inside a legacy Markdown entity. Escaping isn't possible inside
+// entities, so the entity is closed before each character which would end it, and reopened after it.
+func escapeMarkdownContents(entity gotgbot.MessageEntity, s string) string {
+	open, end, ok := markdownMarkers(entity)
+	if !ok {
+		return EscapeMarkdown(s)
+	}
+	if !strings.Contains(s, end[:1]) {
+		return s
+	}
+
+	bd := strings.Builder{}
+	for _, r := range s {
+		if string(r) == end[:1] {
+			bd.WriteString(end + EscapeMarkdown(string(r)) + open)
+			continue
+		}
+		bd.WriteRune(r)
+	}
+	return bd.String()
+}
+
+func wrapMarkdown(entity gotgbot.MessageEntity, contents string) string {
+	open, end, ok := markdownMarkers(entity)
+	if !ok {
+		return contents
+	}
+	return open + contents + end
+}
+
+func wrapHTML(entity gotgbot.MessageEntity, contents string) string {
+	switch entity.Type {
+	case "bold":
+		return "<b>" + contents + "</b>"
+	case "italic":
+		return "<i>" + contents + "</i>"
+	case "underline":
+		return "<u>" + contents + "</u>"
+	case "strikethrough":
+		return "<s>" + contents + "</s>"
+	case "spoiler":
+		return "<tg-spoiler>" + contents + "</tg-spoiler>"
+	case "code":
+		return "<code>" + contents + "</code>"
+	case "pre":
+		if entity.Language == "" {
+			return "<pre>" + contents + "</pre>"
+		}
+		return `<pre><code class="language-` + EscapeHTML(entity.Language) + `">` + contents + "</code></pre>"
+	case "text_link":
+		return `<a href="` + EscapeHTML(entity.Url) + `">` + contents + "</a>"
+	case "text_mention":
+		return `<a href="tg://user?id=` + strconv.FormatInt(userId(entity), 10) + `">` + contents + "</a>"
+	case "custom_emoji":
+		return `<tg-emoji emoji-id="` + EscapeHTML(entity.CustomEmojiId) + `">` + contents + "</tg-emoji>"
+	case "blockquote":
+		return "<blockquote>" + contents + "</blockquote>"
+	case "expandable_blockquote":
+		return "<blockquote expandable>" + contents + "</blockquote>"
+	default:
+		return contents
+	}
+}
+
+func userId(entity gotgbot.MessageEntity) int64 {
+	if entity.User == nil {
+		return 0
+	}
+	return entity.User.Id
+}
@@ -0,0 +1,244 @@
+package formatting_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/formatting"
+)
+
+// userInput contains all the characters which need escaping in any of the parse modes.
+const userInput = "a_b*c[d]e(f)g~h`i>j#k+l-m=n|o{p}q.r!s\\t<u&v\"w'x__y"
+
+func TestFormatters(t *testing.T) {
+	for _, f := range []formatting.Formatter{formatting.MarkdownV2, formatting.HTML} {
+		f := f
+		t.Run(f.ParseMode(), func(t *testing.T) {
+			for name, test := range map[string]struct {
+				formatted string
+				entity    gotgbot.MessageEntity
+			}{
+				"bold":          {formatted: f.Bold(userInput), entity: gotgbot.MessageEntity{Type: "bold"}},
+				"italic":        {formatted: f.Italic(userInput), entity: gotgbot.MessageEntity{Type: "italic"}},
+				"underline":     {formatted: f.Underline(userInput), entity: gotgbot.MessageEntity{Type: "underline"}},
+				"strikethrough": {formatted: f.Strikethrough(userInput), entity: gotgbot.MessageEntity{Type: "strikethrough"}},
+				"spoiler":       {formatted: f.Spoiler(userInput), entity: gotgbot.MessageEntity{Type: "spoiler"}},
+				"code":          {formatted: f.Code(userInput), entity: gotgbot.MessageEntity{Type: "code"}},
+				"pre":           {formatted: f.Pre(userInput, "go"), entity: gotgbot.MessageEntity{Type: "pre", Language: "go"}},
+				"link": {
+					formatted: f.Link(userInput, "https://example.com/?a=(1)&b=\"2\""),
+					entity:    gotgbot.MessageEntity{Type: "text_link", Url: "https://example.com/?a=(1)&b=\"2\""},
+				},
+				"mention": {
+					formatted: f.Mention(userInput, 42),
+					entity:    gotgbot.MessageEntity{Type: "text_mention", User: &gotgbot.User{Id: 42}},
+				},
+				"blockquote": {formatted: f.Blockquote(userInput + "\n" + userInput), entity: gotgbot.MessageEntity{Type: "blockquote"}},
+				"expandable blockquote": {
+					formatted: f.ExpandableBlockquote(userInput + "\n" + userInput),
+					entity:    gotgbot.MessageEntity{Type: "expandable_blockquote"},
+				},
+			} {
+				test := test
+				t.Run(name, func(t *testing.T) {
+					text, ents, err := gotgbot.ParseText(test.formatted, f.ParseMode())
+					if err != nil {
+						t.Fatalf("failed to parse %q: %s", test.formatted, err.Error())
+					}
+
+					expectedText := userInput
+					if strings.Contains(name, "blockquote") {
+						expectedText = userInput + "\n" + userInput
+					}
+					if text != expectedText {
+						t.Errorf("expected text %q, got %q", expectedText, text)
+					}
+
+					test.entity.Length = int64(len(expectedText))
+					if len(ents) != 1 || !reflect.DeepEqual(ents[0], test.entity) {
+						t.Errorf("expected entity %+v, got %+v", test.entity, ents)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestFormatterCustomEmoji(t *testing.T) {
+	for _, f := range []formatting.Formatter{formatting.MarkdownV2, formatting.HTML} {
+		text, ents, err := gotgbot.ParseText(f.CustomEmoji("👍", "5368324170671202286"), f.ParseMode())
+		if err != nil {
+			t.Fatalf("failed to parse custom emoji: %s", err.Error())
+		}
+		if text != "👍" || len(ents) != 1 || ents[0].CustomEmojiId != "5368324170671202286" {
+			t.Errorf("unexpected custom emoji for %s: %q %+v", f.ParseMode(), text, ents)
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	text, ents, err := gotgbot.ParseMarkdown(formatting.EscapeMarkdown("snake_case *[not] `formatted`"))
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if text != "snake_case *[not] `formatted`" || len(ents) != 0 {
+		t.Errorf("unexpected result: %q %+v", text, ents)
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	for _, f := range []formatting.Formatter{formatting.MarkdownV2, formatting.HTML} {
+		f := f
+		t.Run(f.ParseMode(), func(t *testing.T) {
+			tmpl, err := f.ParseTemplate("test", `{{ define "user" }}{{ mention .Name .Id }}{{ end -}}
+Hi {{ template "user" .User }} {{ $title := .Title }}{{ bold (italic $title) }} {{ .Title }}
+{{- range .Items }} {{ code . }}{{ end }} {{ raw .Raw }} {{ pre .Code "go" }}`)
+			if err != nil {
+				t.Fatalf("failed to parse template: %s", err.Error())
+			}
+
+			raw := f.Underline("u")
+			bd := strings.Builder{}
+			err = tmpl.Execute(&bd, map[string]interface{}{
+				"User":  map[string]interface{}{"Name": "<Fox_>", "Id": int64(42)},
+				"Title": "a_b*c",
+				"Items": []string{"x`y", "1.5"},
+				"Raw":   raw,
+				"Code":  "fmt.Println(\"<\\`>\")",
+			})
+			if err != nil {
+				t.Fatalf("failed to execute template: %s", err.Error())
+			}
+
+			text, ents, err := gotgbot.ParseText(bd.String(), f.ParseMode())
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", bd.String(), err.Error())
+			}
+			if expected := "Hi <Fox_> a_b*c a_b*c x`y 1.5 u fmt.Println(\"<\\`>\")"; text != expected {
+				t.Errorf("expected text %q, got %q", expected, text)
+			}
+
+			var types []string
+			for _, e := range ents {
+				types = append(types, e.Type)
+			}
+			if expected := []string{"text_mention", "bold", "italic", "code", "code", "underline", "pre"}; !reflect.DeepEqual(types, expected) {
+				t.Errorf("expected entities %v, got %v", expected, types)
+			}
+		})
+	}
+}
+
+func TestMarkdownFormatter(t *testing.T) {
+	f := formatting.Markdown
+	for name, test := range map[string]struct {
+		format   func(s string) string
+		entity   gotgbot.MessageEntity
+		reserved string
+	}{
+		"bold":   {format: f.Bold, entity: gotgbot.MessageEntity{Type: "bold"}, reserved: "*"},
+		"italic": {format: f.Italic, entity: gotgbot.MessageEntity{Type: "italic"}, reserved: "_"},
+		"code":   {format: f.Code, entity: gotgbot.MessageEntity{Type: "code"}, reserved: "`"},
+		"pre": {
+			format:   func(s string) string { return f.Pre(s, "go") },
+			entity:   gotgbot.MessageEntity{Type: "pre", Language: "go"},
+			reserved: "`",
+		},
+		"link": {
+			format: func(s string) string { return f.Link(s, "https://example.com/?a=(1)") },
+			// Closing brackets are percent-encoded.
+			entity:   gotgbot.MessageEntity{Type: "text_link", Url: "https://example.com/?a=(1%29"},
+			reserved: "]",
+		},
+		"mention": {
+			format:   func(s string) string { return f.Mention(s, 42) },
+			entity:   gotgbot.MessageEntity{Type: "text_mention", User: &gotgbot.User{Id: 42}},
+			reserved: "]",
+		},
+		"unsupported": {format: f.Underline},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			// Without reserved characters, the whole text is a single entity.
+			text, ents, err := gotgbot.ParseMarkdown(test.format("plain text"))
+			if err != nil {
+				t.Fatalf("failed to parse plain text: %s", err.Error())
+			}
+			if text != "plain text" {
+				t.Errorf("expected text %q, got %q", "plain text", text)
+			}
+			if test.entity.Type == "" {
+				if len(ents) != 0 {
+					t.Errorf("expected no entities, got %+v", ents)
+				}
+			} else if expected := withRange(test.entity, 0, 10); len(ents) != 1 || !reflect.DeepEqual(ents[0], expected) {
+				t.Errorf("expected entity %+v, got %+v", expected, ents)
+			}
+
+			// Reserved characters are left outside the entity; everything else is within it.
+			formatted := test.format(userInput)
+			text, ents, err = gotgbot.ParseMarkdown(formatted)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", formatted, err.Error())
+			}
+			if text != userInput {
+				t.Errorf("expected text %q, got %q", userInput, text)
+			}
+			covered := make([]bool, len(text))
+			for _, e := range ents {
+				if expected := withRange(test.entity, e.Offset, e.Length); !reflect.DeepEqual(e, expected) {
+					t.Errorf("expected entity %+v, got %+v", expected, e)
+				}
+				for i := e.Offset; i < e.Offset+e.Length; i++ {
+					covered[i] = true
+				}
+			}
+			for i := range text {
+				if inEntity := test.entity.Type != "" && !strings.ContainsRune(test.reserved, rune(text[i])); covered[i] != inEntity {
+					t.Errorf("expected character %d (%q) to be in entity: %v, got %v", i, text[i], inEntity, covered[i])
+				}
+			}
+		})
+	}
+}
+
+func withRange(entity gotgbot.MessageEntity, offset int64, length int64) gotgbot.MessageEntity {
+	entity.Offset, entity.Length = offset, length
+	return entity
+}
+
+func TestMarkdownTemplate(t *testing.T) {
+	tmpl, err := formatting.Markdown.ParseTemplate("test", `Hi {{ mention .Name .Id }}, {{ .Title }} {{ bold .Title }} {{ code .Code }}`)
+	if err != nil {
+		t.Fatalf("failed to parse template: %s", err.Error())
+	}
+
+	bd := strings.Builder{}
+	err = tmpl.Execute(&bd, map[string]interface{}{
+		"Name":  "[Fox]",
+		"Id":    int64(42),
+		"Title": "a_b*c",
+		"Code":  "x`y",
+	})
+	if err != nil {
+		t.Fatalf("failed to execute template: %s", err.Error())
+	}
+
+	text, ents, err := gotgbot.ParseMarkdown(bd.String())
+	if err != nil {
+		t.Fatalf("failed to parse %q: %s", bd.String(), err.Error())
+	}
+	if expected := "Hi [Fox], a_b*c a_b*c x`y"; text != expected {
+		t.Errorf("expected text %q, got %q", expected, text)
+	}
+
+	var types []string
+	for _, e := range ents {
+		types = append(types, e.Type)
+	}
+	if expected := []string{"text_mention", "bold", "bold", "code", "code"}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected entities %v, got %v", expected, types)
+	}
+}
@@ -0,0 +1,150 @@
+package formatting
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Formatted is text which has already been formatted and escaped. Templates never escape Formatted values again.
+type Formatted string
+
+// escapeFunc is the name of the template function which is automatically applied to all template outputs.
+const escapeFunc = "escape"
+
+// FuncMap returns the template functions for this formatter. All the functions accept any value, and escape it unless
+// it is Formatted; all of them return Formatted values, so they can be nested. For example:
+//
+//	{{ bold (link .Title .URL) }} by {{ mention .User.FirstName .User.Id }}
+//
+// Available functions: escape, raw, bold, italic, underline, strikethrough, spoiler, code, pre (with an optional
+// language), link, mention, emoji, blockquote, expandableBlockquote.
+//
+// Note: Values are only escaped automatically in templates created with Formatter.ParseTemplate. When using the
+// FuncMap directly, the escape function must be called explicitly.
+//
+// Legacy Markdown does not support nested entities, so the Markdown formatter's functions should not be nested.
+func (f Formatter) FuncMap() template.FuncMap {
+	entityFunc := func(typ string) func(v interface{}) Formatted {
+		return func(v interface{}) Formatted {
+			entity := gotgbot.MessageEntity{Type: typ}
+			return Formatted(f.wrap(entity, f.escapeValue(v, entity)))
+		}
+	}
+
+	return template.FuncMap{
+		escapeFunc: func(v interface{}) Formatted {
+			return Formatted(f.escapeValue(v, gotgbot.MessageEntity{}))
+		},
+		"raw": func(s string) Formatted {
+			return Formatted(s)
+		},
+		"bold":                 entityFunc("bold"),
+		"italic":               entityFunc("italic"),
+		"underline":            entityFunc("underline"),
+		"strikethrough":        entityFunc("strikethrough"),
+		"spoiler":              entityFunc("spoiler"),
+		"code":                 entityFunc("code"),
+		"blockquote":           entityFunc("blockquote"),
+		"expandableBlockquote": entityFunc("expandable_blockquote"),
+		"pre": func(v interface{}, language ...string) Formatted {
+			entity := gotgbot.MessageEntity{Type: "pre"}
+			if len(language) > 0 {
+				entity.Language = language[0]
+			}
+			return Formatted(f.wrap(entity, f.escapeValue(v, entity)))
+		},
+		"link": func(v interface{}, url string) Formatted {
+			entity := gotgbot.MessageEntity{Type: "text_link", Url: url}
+			return Formatted(f.wrap(entity, f.escapeValue(v, entity)))
+		},
+		"mention": func(v interface{}, userId int64) Formatted {
+			entity := gotgbot.MessageEntity{Type: "text_mention", User: &gotgbot.User{Id: userId}}
+			return Formatted(f.wrap(entity, f.escapeValue(v, entity)))
+		},
+		"emoji": func(emoji string, customEmojiId string) Formatted {
+			return Formatted(f.Entity(gotgbot.MessageEntity{Type: "custom_emoji", CustomEmojiId: customEmojiId}, emoji))
+		},
+	}
+}
+
+// escapeValue escapes a template value to be used inside the given entity, unless it is already formatted. Values
+// outside of entities use an empty entity.
+func (f Formatter) escapeValue(v interface{}, entity gotgbot.MessageEntity) string {
+	if s, ok := v.(Formatted); ok {
+		return string(s)
+	}
+	return f.escapeEntity(entity, fmt.Sprint(v))
+}
+
+// Template is a parsed template, which escapes all of its output automatically. See Formatter.ParseTemplate.
+//
+// The underlying text/template is not exposed, as templates added to it later (eg with New or AddParseTree) would not
+// be escaped.
+type Template struct {
+	tmpl *template.Template
+}
+
+// Execute applies the template to the given data, and writes the output to w.
+func (t *Template) Execute(w io.Writer, data interface{}) error {
+	return t.tmpl.Execute(w, data)
+}
+
+// ParseTemplate creates a new template with this formatter's FuncMap, and parses the given text. All the values
+// output by the template are escaped automatically, unless they are Formatted; this includes the results of all the
+// FuncMap functions. The raw function can be used to output preformatted strings as-is.
+//
+// For example, with the HTML formatter:
+//
+//	t, err := formatting.HTML.ParseTemplate("welcome", "Welcome {{ .Name }}, to {{ bold .Group }}!")
+//	// ...
+//	err = t.Execute(&buf, map[string]string{"Name": "<Fox>", "Group": "Foxes & co"})
+//	// buf: "Welcome &lt;Fox&gt;, to <b>Foxes &amp; co</b>!"
+func (f Formatter) ParseTemplate(name string, text string) (*Template, error) {
+	t, err := template.New(name).Funcs(f.FuncMap()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			escapeNode(tmpl.Tree.Root)
+		}
+	}
+	return &Template{tmpl: t}, nil
+}
+
+// escapeNode appends the escape function to the pipelines of all the actions which generate output.
+func escapeNode(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeNode(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			// Variable declarations and assignments don't output anything.
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(escapeFunc).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	case *parse.RangeNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	case *parse.WithNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	}
+}
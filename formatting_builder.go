@@ -0,0 +1,171 @@
+package gotgbot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/internal/utf16util"
+)
+
+// TextBuilder builds message texts along with their MessageEntity list, avoiding the need for any parse modes (and
+// their escaping rules). All entity offsets are computed in UTF-16 code units, as expected by telegram.
+//
+// For example:
+//
+//	text, entities := gotgbot.NewTextBuilder().
+//		Text("Hello, ").
+//		Mention(ctx.EffectiveUser.FirstName, ctx.EffectiveUser.Id).
+//		Text("! Your order ").
+//		Code("#1234").
+//		Text(" is ").
+//		With(gotgbot.MessageEntity{Type: "bold"}, func(tb *gotgbot.TextBuilder) {
+//			tb.Text("ready").Italic(" for pickup")
+//		}).
+//		Build()
+//
+//	_, err := b.SendMessage(chatId, text, &gotgbot.SendMessageOpts{Entities: entities})
+type TextBuilder struct {
+	// text contains the plain text built so far.
+	text strings.Builder
+	// offset is the current length of the text, in UTF-16 code units.
+	offset int64
+	// entities contains all the entities built so far, in the order they were closed.
+	entities []MessageEntity
+}
+
+// NewTextBuilder creates a new, empty, TextBuilder.
+func NewTextBuilder() *TextBuilder {
+	return &TextBuilder{}
+}
+
+// Text appends plain, unformatted, text.
+func (tb *TextBuilder) Text(s string) *TextBuilder {
+	tb.text.WriteString(s)
+	tb.offset += utf16Len(s)
+	return tb
+}
+
+// With appends an entity of any kind, and calls f to fill its contents. Any entities added within f are nested
+// inside it.
+// The Offset and Length fields of the given entity are set by the builder.
+func (tb *TextBuilder) With(entity MessageEntity, f func(tb *TextBuilder)) *TextBuilder {
+	start := tb.offset
+	f(tb)
+
+	// Telegram drops empty entities, so we do the same.
+	if tb.offset == start {
+		return tb
+	}
+
+	entity.Offset = start
+	entity.Length = tb.offset - start
+	tb.entities = append(tb.entities, entity)
+	return tb
+}
+
+// Entity appends text wrapped in an entity of any kind.
+// The Offset and Length fields of the given entity are set by the builder.
+func (tb *TextBuilder) Entity(entity MessageEntity, s string) *TextBuilder {
+	return tb.With(entity, func(tb *TextBuilder) { tb.Text(s) })
+}
+
+// Bold appends bold text.
+func (tb *TextBuilder) Bold(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "bold"}, s)
+}
+
+// Italic appends italic text.
+func (tb *TextBuilder) Italic(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "italic"}, s)
+}
+
+// Underline appends underlined text.
+func (tb *TextBuilder) Underline(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "underline"}, s)
+}
+
+// Strikethrough appends strikethrough text.
+func (tb *TextBuilder) Strikethrough(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "strikethrough"}, s)
+}
+
+// Spoiler appends spoiler text.
+func (tb *TextBuilder) Spoiler(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "spoiler"}, s)
+}
+
+// Code appends inline monospace text.
+func (tb *TextBuilder) Code(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "code"}, s)
+}
+
+// Pre appends a monospace code block. The language is optional.
+func (tb *TextBuilder) Pre(s string, language string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "pre", Language: language}, s)
+}
+
+// Link appends text which links to the given URL.
+func (tb *TextBuilder) Link(s string, url string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "text_link", Url: url}, s)
+}
+
+// Mention appends text which mentions the user with the given ID; this works for users without usernames.
+func (tb *TextBuilder) Mention(s string, userId int64) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "text_mention", User: &User{Id: userId}}, s)
+}
+
+// CustomEmoji appends a custom emoji. The emoji parameter is the regular emoji shown to clients which can't display
+// the custom one.
+func (tb *TextBuilder) CustomEmoji(emoji string, customEmojiId string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "custom_emoji", CustomEmojiId: customEmojiId}, emoji)
+}
+
+// Blockquote appends a block quotation.
+func (tb *TextBuilder) Blockquote(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "blockquote"}, s)
+}
+
+// ExpandableBlockquote appends a block quotation which is collapsed by default.
+func (tb *TextBuilder) ExpandableBlockquote(s string) *TextBuilder {
+	return tb.Entity(MessageEntity{Type: "expandable_blockquote"}, s)
+}
+
+// Len returns the current length of the text, in UTF-16 code units. This is the length telegram uses to enforce its
+// message size limits.
+func (tb *TextBuilder) Len() int64 {
+	return tb.offset
+}
+
+// String returns the plain text built so far.
+func (tb *TextBuilder) String() string {
+	return tb.text.String()
+}
+
+// Entities returns the list of entities built so far, sorted by offset. Outer entities come before the entities
+// nested within them.
+func (tb *TextBuilder) Entities() []MessageEntity {
+	ents := make([]MessageEntity, len(tb.entities))
+	copy(ents, tb.entities)
+	sort.SliceStable(ents, func(i, j int) bool {
+		if ents[i].Offset != ents[j].Offset {
+			return ents[i].Offset < ents[j].Offset
+		}
+		return ents[i].Length > ents[j].Length
+	})
+	return ents
+}
+
+// Build returns the plain text and its entities, ready to be used with SendMessageOpts.Entities (or any of the other
+// entity fields, such as captions).
+func (tb *TextBuilder) Build() (string, []MessageEntity) {
+	return tb.String(), tb.Entities()
+}
+
+// utf16Len returns the length of a string in UTF-16 code units.
+func utf16Len(s string) int64 {
+	var l int64
+	for _, r := range s {
+		l += utf16util.RuneLen(r)
+	}
+	return l
+}
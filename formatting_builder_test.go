@@ -0,0 +1,53 @@
+package gotgbot
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestTextBuilder(t *testing.T) {
+	text, entities := NewTextBuilder().
+		Text("Hi ").
+		Mention("🦊 Fox", 42).
+		Text(", see ").
+		Link("this", "https://example.com").
+		Text(": ").
+		With(MessageEntity{Type: "bold"}, func(tb *TextBuilder) {
+			tb.Text("bold ").Italic("and italic")
+		}).
+		Text("\n").
+		Pre("fmt.Println()", "go").
+		Bold("").
+		Build()
+
+	if text != "Hi 🦊 Fox, see this: bold and italic\nfmt.Println()" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+
+	expected := []MessageEntity{
+		{Type: "text_mention", Offset: 3, Length: 6, User: &User{Id: 42}},
+		{Type: "text_link", Offset: 15, Length: 4, Url: "https://example.com"},
+		{Type: "bold", Offset: 21, Length: 15},
+		{Type: "italic", Offset: 26, Length: 10},
+		{Type: "pre", Offset: 37, Length: 13, Language: "go"},
+	}
+	if !reflect.DeepEqual(entities, expected) {
+		t.Fatalf("unexpected entities:\n%+v\nexpected:\n%+v", entities, expected)
+	}
+
+	// Offsets should line up with the existing entity-based formatting.
+	html := getOrigMsgHTML(utf16.Encode([]rune(text)), entities)
+	expectedHTML := `Hi <a href="tg://user?id=42">🦊 Fox</a>, see <a href="https://example.com">this</a>: <b>bold <i>and italic</i></b>` +
+		"\n" + `<pre><code class="language-go">fmt.Println()</code></pre>`
+	if html != expectedHTML {
+		t.Errorf("unexpected HTML:\n%s\nexpected:\n%s", html, expectedHTML)
+	}
+}
+
+func TestTextBuilderLen(t *testing.T) {
+	tb := NewTextBuilder().Text("a").CustomEmoji("👍", "123").ExpandableBlockquote("é")
+	if tb.Len() != 4 {
+		t.Errorf("expected UTF-16 length of 4, got %d", tb.Len())
+	}
+}
@@ -0,0 +1,714 @@
+package gotgbot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnknownParseMode   = errors.New("unknown parse mode")
+	ErrUnclosedEntity     = errors.New("can't find end of the entity")
+	ErrReservedCharacter  = errors.New("reserved character must be escaped with the preceding '\\'")
+	ErrUnclosedURL        = errors.New("can't find end of the URL")
+	ErrInvalidCustomEmoji = errors.New("invalid custom emoji identifier")
+	ErrUnsupportedTag     = errors.New("unsupported tag")
+	ErrUnclosedTag        = errors.New("unclosed tag")
+	ErrUnexpectedEndTag   = errors.New("unexpected end tag")
+)
+
+// ParseError describes where parsing a formatted text failed.
+// The underlying error is one of the ErrXxx parsing errors; use errors.Is to check for them.
+type ParseError struct {
+	// Offset is the byte offset of the error in the formatted text, as reported by telegram.
+	Offset int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse entities: %s at byte offset %d", e.Err.Error(), e.Offset)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseText parses a formatted text in the given parse mode (one of the ParseModeXxx constants) into plain text and
+// its entities, as telegram would.
+func ParseText(text string, parseMode string) (string, []MessageEntity, error) {
+	switch parseMode {
+	case ParseModeNone:
+		return text, nil, nil
+	case ParseModeMarkdownV2:
+		return ParseMarkdownV2(text)
+	case ParseModeMarkdown:
+		return ParseMarkdown(text)
+	case ParseModeHTML:
+		return ParseHTML(text)
+	default:
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownParseMode, parseMode)
+	}
+}
+
+// parsedText collects the plain text and entities obtained while parsing formatted text.
+type parsedText struct {
+	text strings.Builder
+	// offset is the current length of the text, in UTF-16 code units.
+	offset   int64
+	entities []parsedEntity
+	// opened counts the number of opened entities, used to order nested entities.
+	opened int
+}
+
+type parsedEntity struct {
+	MessageEntity
+	// order is the order in which the entity was opened.
+	order int
+}
+
+// openEntity is an entity which has been opened, but not yet closed.
+type openEntity struct {
+	entity MessageEntity
+	// start is the UTF-16 offset of the entity in the plain text.
+	start int64
+	// textStart is the byte offset of the entity in the plain text.
+	textStart int
+	// pos is the byte offset of the entity in the formatted text, used for errors.
+	pos   int
+	order int
+	// tag is the HTML tag which opened the entity.
+	tag string
+}
+
+func (p *parsedText) writeString(s string) {
+	p.text.WriteString(s)
+	p.offset += utf16Len(s)
+}
+
+func (p *parsedText) open(entity MessageEntity, pos int) openEntity {
+	p.opened++
+	return openEntity{
+		entity:    entity,
+		start:     p.offset,
+		textStart: p.text.Len(),
+		pos:       pos,
+		order:     p.opened,
+	}
+}
+
+// contents returns the plain text of an open entity.
+func (p *parsedText) contents(o openEntity) string {
+	return p.text.String()[o.textStart:]
+}
+
+// close adds an open entity, ending at the current offset. Empty entities are dropped.
+func (p *parsedText) close(o openEntity) {
+	if p.offset == o.start {
+		return
+	}
+	o.entity.Offset = o.start
+	o.entity.Length = p.offset - o.start
+	p.entities = append(p.entities, parsedEntity{MessageEntity: o.entity, order: o.order})
+}
+
+// result returns the plain text and its entities. Entities are sorted by offset, with outer entities first; this is
+// the order which telegram uses, and which the OriginalXxx methods expect.
+func (p *parsedText) result() (string, []MessageEntity) {
+	sort.SliceStable(p.entities, func(i, j int) bool {
+		a, b := p.entities[i], p.entities[j]
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		if a.Length != b.Length {
+			return a.Length > b.Length
+		}
+		return a.order < b.order
+	})
+
+	var ents []MessageEntity
+	for _, e := range p.entities {
+		ents = append(ents, e.MessageEntity)
+	}
+	return p.text.String(), ents
+}
+
+// linkEntity creates the entity for a link to the given URL. Links to users become text mentions.
+func linkEntity(url string) MessageEntity {
+	if strings.HasPrefix(url, "tg://user?id=") {
+		if id, err := strconv.ParseInt(url[len("tg://user?id="):], 10, 64); err == nil {
+			return MessageEntity{Type: "text_mention", User: &User{Id: id}}
+		}
+	}
+	return MessageEntity{Type: "text_link", Url: url}
+}
+
+// mdV2Reserved contains all the characters which must be escaped in MarkdownV2.
+const mdV2Reserved = "_*[]()~`>#+-=|{}.!"
+
+// ParseMarkdownV2 parses a MarkdownV2 formatted text into plain text and its entities, following telegram's
+// formatting rules: https://core.telegram.org/bots/api#markdownv2-style
+//
+// As in telegram, "__" is always greedily treated as underline; a '\r' character can be used to separate italic and
+// underline markers, and is dropped from the text.
+func ParseMarkdownV2(s string) (string, []MessageEntity, error) {
+	p := parsedText{}
+	var stack []openEntity
+	var quote *openEntity
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		lineStart := i == 0 || s[i-1] == '\n'
+
+		if c == '\r' {
+			i++
+			continue
+		}
+
+		if quote != nil && lineStart && c == '>' {
+			// Quote continuation.
+			i++
+			continue
+		}
+
+		if c == '\\' && i+1 < len(s) && s[i+1] > 0 && s[i+1] <= 126 {
+			p.writeString(s[i+1 : i+2])
+			i += 2
+			continue
+		}
+
+		if quote != nil && c == '\n' && (i+1 == len(s) || s[i+1] != '>') {
+			// The next line isn't quoted, so the quote ends here.
+			if len(stack) > 0 {
+				return "", nil, &ParseError{Offset: stack[len(stack)-1].pos, Err: ErrUnclosedEntity}
+			}
+			p.close(*quote)
+			quote = nil
+		}
+
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			switch top.entity.Type {
+			case "code", "pre":
+				// Nothing is parsed inside code, apart from escapes and the end of the entity.
+				if top.entity.Type == "code" && c == '`' || top.entity.Type == "pre" && strings.HasPrefix(s[i:], "```") {
+					p.close(top)
+					stack = stack[:len(stack)-1]
+					i += len(mdV2Map[top.entity.Type])
+					continue
+				}
+				_, size := utf8.DecodeRuneInString(s[i:])
+				p.writeString(s[i : i+size])
+				i += size
+				continue
+			}
+		}
+
+		if quote != nil && quote.entity.Type == "expandable_blockquote" && len(stack) == 0 &&
+			strings.HasPrefix(s[i:], "||") && (i+2 == len(s) || s[i+2] == '\n') {
+			// End of the expandable quote.
+			p.close(*quote)
+			quote = nil
+			i += 2
+			continue
+		}
+
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if n := mdV2EntityEnd(top.entity.Type, s[i:]); n > 0 {
+				stack = stack[:len(stack)-1]
+				i += n
+
+				switch top.entity.Type {
+				case "text_link", "custom_emoji":
+					url := p.contents(top)
+					if strings.HasPrefix(s[i:], "(") {
+						bd := strings.Builder{}
+						j := i + 1
+						for ; j < len(s) && s[j] != ')'; j++ {
+							if s[j] == '\\' && j+1 < len(s) && s[j+1] > 0 && s[j+1] <= 126 {
+								j++
+							}
+							bd.WriteByte(s[j])
+						}
+						if j == len(s) {
+							return "", nil, &ParseError{Offset: i, Err: ErrUnclosedURL}
+						}
+						url = bd.String()
+						i = j + 1
+					}
+
+					if top.entity.Type == "custom_emoji" {
+						id := strings.TrimPrefix(url, "tg://emoji?id=")
+						if _, err := strconv.ParseInt(id, 10, 64); err != nil || !strings.HasPrefix(url, "tg://emoji?id=") {
+							return "", nil, &ParseError{Offset: top.pos, Err: ErrInvalidCustomEmoji}
+						}
+						top.entity.CustomEmojiId = id
+					} else {
+						if url == "" {
+							// Invalid links are dropped.
+							continue
+						}
+						top.entity = linkEntity(url)
+					}
+				}
+
+				p.close(top)
+				continue
+			}
+		}
+
+		if lineStart && quote == nil && len(stack) == 0 && (c == '>' || strings.HasPrefix(s[i:], "**>")) {
+			typ, n := "blockquote", 1
+			if c == '*' {
+				typ, n = "expandable_blockquote", 3
+			}
+			o := p.open(MessageEntity{Type: typ}, i)
+			quote = &o
+			i += n
+			continue
+		}
+
+		var entity MessageEntity
+		n := 1
+		switch {
+		case c == '*':
+			entity.Type = "bold"
+		case strings.HasPrefix(s[i:], "__"):
+			entity.Type, n = "underline", 2
+		case c == '_':
+			entity.Type = "italic"
+		case c == '~':
+			entity.Type = "strikethrough"
+		case strings.HasPrefix(s[i:], "||"):
+			entity.Type, n = "spoiler", 2
+		case strings.HasPrefix(s[i:], "```"):
+			entity.Type, n = "pre", 3
+			j := i + n
+			for j < len(s) && s[j] != '`' && !isASCIISpace(s[j]) {
+				j++
+			}
+			if j > i+n && j < len(s) && s[j] == '\n' {
+				entity.Language = s[i+n : j]
+				n = j - i
+			}
+			if i+n < len(s) && s[i+n] == '\n' {
+				// Skip the newline at the start of the code block.
+				n++
+			}
+		case c == '`':
+			entity.Type = "code"
+		case c == '[':
+			entity.Type = "text_link"
+		case strings.HasPrefix(s[i:], "!["):
+			entity.Type, n = "custom_emoji", 2
+		case strings.IndexByte(mdV2Reserved, c) >= 0:
+			return "", nil, &ParseError{Offset: i, Err: fmt.Errorf("%w: '%c'", ErrReservedCharacter, c)}
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			p.writeString(s[i : i+size])
+			i += size
+			continue
+		}
+
+		stack = append(stack, p.open(entity, i))
+		i += n
+	}
+
+	if len(stack) > 0 {
+		return "", nil, &ParseError{Offset: stack[len(stack)-1].pos, Err: ErrUnclosedEntity}
+	}
+	if quote != nil {
+		p.close(*quote)
+	}
+
+	text, ents := p.result()
+	return text, ents, nil
+}
+
+// mdV2EntityEnd returns the length of the end marker of the given entity type, if the text starts with it.
+func mdV2EntityEnd(entityType string, s string) int {
+	switch entityType {
+	case "bold":
+		if strings.HasPrefix(s, "*") {
+			return 1
+		}
+	case "italic":
+		if strings.HasPrefix(s, "_") && !strings.HasPrefix(s, "__") {
+			return 1
+		}
+	case "underline":
+		if strings.HasPrefix(s, "__") {
+			return 2
+		}
+	case "strikethrough":
+		if strings.HasPrefix(s, "~") {
+			return 1
+		}
+	case "spoiler":
+		if strings.HasPrefix(s, "||") {
+			return 2
+		}
+	case "text_link", "custom_emoji":
+		if strings.HasPrefix(s, "]") {
+			return 1
+		}
+	}
+	return 0
+}
+
+func isASCIISpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// ParseMarkdown parses a legacy Markdown formatted text into plain text and its entities, following telegram's
+// formatting rules: https://core.telegram.org/bots/api#markdown-style
+//
+// Legacy Markdown does not support nested entities.
+func ParseMarkdown(s string) (string, []MessageEntity, error) {
+	p := parsedText{}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && strings.IndexByte("_*`[", s[i+1]) >= 0 {
+			p.writeString(s[i+1 : i+2])
+			i += 2
+			continue
+		}
+
+		start := i
+		var o openEntity
+		var end string
+		switch {
+		case c == '*':
+			o, end = p.open(MessageEntity{Type: "bold"}, i), "*"
+		case c == '_':
+			o, end = p.open(MessageEntity{Type: "italic"}, i), "_"
+		case strings.HasPrefix(s[i:], "```"):
+			o, end = p.open(MessageEntity{Type: "pre"}, i), "```"
+			j := i + len(end)
+			for j < len(s) && s[j] != '`' && !isASCIISpace(s[j]) {
+				j++
+			}
+			if j > i+len(end) && j < len(s) && s[j] == '\n' {
+				o.entity.Language = s[i+len(end) : j]
+				// Skip the language, and the newline after it.
+				i = j + 1 - len(end)
+			}
+		case c == '`':
+			o, end = p.open(MessageEntity{Type: "code"}, i), "`"
+		case c == '[':
+			o, end = p.open(MessageEntity{Type: "text_link"}, i), "]"
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			p.writeString(s[i : i+size])
+			i += size
+			continue
+		}
+
+		// Entities can't be nested, so everything up to the end marker is text.
+		escapable := end[:1]
+		if end == "]" {
+			escapable = "[]()"
+		}
+		closed := false
+		for i += len(end); i < len(s); {
+			if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(escapable, s[i+1]) >= 0 {
+				p.writeString(s[i+1 : i+2])
+				i += 2
+				continue
+			}
+			if strings.HasPrefix(s[i:], end) {
+				closed = true
+				i += len(end)
+				break
+			}
+			_, size := utf8.DecodeRuneInString(s[i:])
+			p.writeString(s[i : i+size])
+			i += size
+		}
+		if !closed {
+			return "", nil, &ParseError{Offset: start, Err: ErrUnclosedEntity}
+		}
+
+		if o.entity.Type == "text_link" {
+			if !strings.HasPrefix(s[i:], "(") {
+				// Links without a URL are kept as plain text.
+				continue
+			}
+			j := strings.IndexByte(s[i:], ')')
+			if j < 0 {
+				return "", nil, &ParseError{Offset: i, Err: ErrUnclosedURL}
+			}
+			url := s[i+1 : i+j]
+			i += j + 1
+			if url == "" {
+				continue
+			}
+			o.entity = linkEntity(url)
+		}
+
+		p.close(o)
+	}
+
+	text, ents := p.result()
+	return text, ents, nil
+}
+
+// ParseHTML parses an HTML formatted text into plain text and its entities, following telegram's formatting rules:
+// https://core.telegram.org/bots/api#html-style
+func ParseHTML(s string) (string, []MessageEntity, error) {
+	p := parsedText{}
+	var stack []openEntity
+
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '&':
+			decoded, n := decodeHTMLEntity(s[i:])
+			p.writeString(decoded)
+			i += n
+
+		case strings.HasPrefix(s[i:], "</"):
+			j := i + 2
+			for j < len(s) && isHTMLNameChar(s[j]) {
+				j++
+			}
+			name := strings.ToLower(s[i+2 : j])
+			for j < len(s) && isASCIISpace(s[j]) {
+				j++
+			}
+			if j == len(s) || s[j] != '>' {
+				return "", nil, &ParseError{Offset: i, Err: ErrUnclosedTag}
+			}
+			if len(stack) == 0 || stack[len(stack)-1].tag != name {
+				return "", nil, &ParseError{Offset: i, Err: fmt.Errorf("%w </%s>", ErrUnexpectedEndTag, name)}
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			i = j + 1
+
+			switch top.entity.Type {
+			case "text_link":
+				url := top.entity.Url
+				if url == "" {
+					url = p.contents(top)
+				}
+				top.entity = linkEntity(url)
+				if url == "" {
+					continue
+				}
+			case "pre":
+				// Code blocks are written as <pre><code class="language-xxx">; the code entity is merged into the pre.
+				if n := len(p.entities); n > 0 {
+					last := p.entities[n-1]
+					if last.Type == "code" && last.Offset == top.start && last.Offset+last.Length == p.offset {
+						top.entity.Language = last.Language
+						p.entities = p.entities[:n-1]
+					}
+				}
+			}
+			p.close(top)
+
+		case s[i] == '<':
+			name, attrs, n, err := parseHTMLTag(s[i:])
+			if err != nil {
+				return "", nil, &ParseError{Offset: i, Err: err}
+			}
+
+			var entity MessageEntity
+			switch name {
+			case "b", "strong":
+				entity.Type = "bold"
+			case "i", "em":
+				entity.Type = "italic"
+			case "u", "ins":
+				entity.Type = "underline"
+			case "s", "strike", "del":
+				entity.Type = "strikethrough"
+			case "tg-spoiler":
+				entity.Type = "spoiler"
+			case "span":
+				if attrs["class"] != "tg-spoiler" {
+					return "", nil, &ParseError{Offset: i, Err: fmt.Errorf("%w <span> without class \"tg-spoiler\"", ErrUnsupportedTag)}
+				}
+				entity.Type = "spoiler"
+			case "code":
+				entity.Type = "code"
+				// Only used when nested in a pre entity.
+				entity.Language = strings.TrimPrefix(attrs["class"], "language-")
+				if !strings.HasPrefix(attrs["class"], "language-") {
+					entity.Language = ""
+				}
+			case "pre":
+				entity.Type = "pre"
+			case "a":
+				entity.Type = "text_link"
+				entity.Url = attrs["href"]
+			case "tg-emoji":
+				entity.Type = "custom_emoji"
+				entity.CustomEmojiId = attrs["emoji-id"]
+				if _, err := strconv.ParseInt(entity.CustomEmojiId, 10, 64); err != nil {
+					return "", nil, &ParseError{Offset: i, Err: ErrInvalidCustomEmoji}
+				}
+			case "blockquote":
+				entity.Type = "blockquote"
+				if _, ok := attrs["expandable"]; ok {
+					entity.Type = "expandable_blockquote"
+				}
+			default:
+				return "", nil, &ParseError{Offset: i, Err: fmt.Errorf("%w <%s>", ErrUnsupportedTag, name)}
+			}
+
+			o := p.open(entity, i)
+			o.tag = name
+			stack = append(stack, o)
+			i += n
+
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			p.writeString(s[i : i+size])
+			i += size
+		}
+	}
+
+	if len(stack) > 0 {
+		return "", nil, &ParseError{Offset: stack[len(stack)-1].pos, Err: fmt.Errorf("%w <%s>", ErrUnclosedEntity, stack[len(stack)-1].tag)}
+	}
+
+	// Code languages are only kept for pre entities.
+	for idx := range p.entities {
+		if p.entities[idx].Type == "code" {
+			p.entities[idx].Language = ""
+		}
+	}
+
+	text, ents := p.result()
+	return text, ents, nil
+}
+
+// parseHTMLTag parses an HTML start tag, returning its lowercase name, its attributes, and its length.
+func parseHTMLTag(s string) (string, map[string]string, int, error) {
+	i := 1
+	for i < len(s) && isHTMLNameChar(s[i]) {
+		i++
+	}
+	name := strings.ToLower(s[1:i])
+	if name == "" {
+		return "", nil, 0, ErrUnsupportedTag
+	}
+
+	attrs := map[string]string{}
+	for {
+		for i < len(s) && isASCIISpace(s[i]) {
+			i++
+		}
+		if i == len(s) {
+			return "", nil, 0, ErrUnclosedTag
+		}
+		if s[i] == '>' {
+			return name, attrs, i + 1, nil
+		}
+
+		start := i
+		for i < len(s) && isHTMLNameChar(s[i]) {
+			i++
+		}
+		if i == start {
+			return "", nil, 0, ErrUnclosedTag
+		}
+		attr := strings.ToLower(s[start:i])
+
+		for i < len(s) && isASCIISpace(s[i]) {
+			i++
+		}
+		if i == len(s) || s[i] != '=' {
+			// Attribute without a value.
+			attrs[attr] = ""
+			continue
+		}
+		i++
+		for i < len(s) && isASCIISpace(s[i]) {
+			i++
+		}
+		if i == len(s) {
+			return "", nil, 0, ErrUnclosedTag
+		}
+
+		var value string
+		if s[i] == '"' || s[i] == '\'' {
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return "", nil, 0, ErrUnclosedTag
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			start := i
+			for i < len(s) && s[i] != '>' && !isASCIISpace(s[i]) {
+				i++
+			}
+			value = s[start:i]
+		}
+		attrs[attr] = unescapeHTML(value)
+	}
+}
+
+func isHTMLNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// decodeHTMLEntity decodes the HTML entity at the start of s, returning its value and length.
+// Only the entities supported by telegram are decoded; anything else is kept as-is.
+func decodeHTMLEntity(s string) (string, int) {
+	end := strings.IndexByte(s, ';')
+	if end < 0 || end > 10 {
+		return "&", 1
+	}
+
+	switch name := s[1:end]; {
+	case name == "lt":
+		return "<", end + 1
+	case name == "gt":
+		return ">", end + 1
+	case name == "amp":
+		return "&", end + 1
+	case name == "quot":
+		return "\"", end + 1
+	case strings.HasPrefix(name, "#"):
+		var code int64
+		var err error
+		if strings.HasPrefix(name, "#x") || strings.HasPrefix(name, "#X") {
+			code, err = strconv.ParseInt(name[2:], 16, 32)
+		} else {
+			code, err = strconv.ParseInt(name[1:], 10, 32)
+		}
+		if err != nil || code <= 0 || !utf8.ValidRune(rune(code)) {
+			return "&", 1
+		}
+		return string(rune(code)), end + 1
+	default:
+		return "&", 1
+	}
+}
+
+// unescapeHTML decodes all the HTML entities in s.
+func unescapeHTML(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	bd := strings.Builder{}
+	for i := 0; i < len(s); {
+		if s[i] != '&' {
+			bd.WriteByte(s[i])
+			i++
+			continue
+		}
+		decoded, n := decodeHTMLEntity(s[i:])
+		bd.WriteString(decoded)
+		i += n
+	}
+	return bd.String()
+}
@@ -0,0 +1,351 @@
+package gotgbot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type parseTest struct {
+	input    string
+	text     string
+	entities []MessageEntity
+	err      error
+	offset   int
+}
+
+func runParseTests(t *testing.T, parse func(string) (string, []MessageEntity, error), tests map[string]parseTest) {
+	t.Helper()
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			text, ents, err := parse(test.input)
+			if test.err != nil {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) || !errors.Is(err, test.err) {
+					t.Fatalf("expected error %v, got %v", test.err, err)
+				}
+				if parseErr.Offset != test.offset {
+					t.Errorf("expected error at offset %d, got %d", test.offset, parseErr.Offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if text != test.text {
+				t.Errorf("expected text %q, got %q", test.text, text)
+			}
+			if !reflect.DeepEqual(ents, test.entities) {
+				t.Errorf("unexpected entities:\n%+v\nexpected:\n%+v", ents, test.entities)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownV2(t *testing.T) {
+	runParseTests(t, ParseMarkdownV2, map[string]parseTest{
+		"plain": {
+			input: `Hello\, world\!`,
+			text:  "Hello, world!",
+		},
+		"nested": {
+			input: "*bold _italic __underline__ ~strike~_ ||spoiler||*",
+			text:  "bold italic underline strike spoiler",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 36},
+				{Type: "italic", Offset: 5, Length: 23},
+				{Type: "underline", Offset: 12, Length: 9},
+				{Type: "strikethrough", Offset: 22, Length: 6},
+				{Type: "spoiler", Offset: 29, Length: 7},
+			},
+		},
+		"same range nesting": {
+			input: "*_a_*",
+			text:  "a",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 1},
+				{Type: "italic", Offset: 0, Length: 1},
+			},
+		},
+		"italic underline separator": {
+			input: "___a_\r__",
+			text:  "a",
+			entities: []MessageEntity{
+				{Type: "underline", Offset: 0, Length: 1},
+				{Type: "italic", Offset: 0, Length: 1},
+			},
+		},
+		"links": {
+			input: "[🦊 fox](https://example.com/\\)) [user](tg://user?id=42) ![👍](tg://emoji?id=5368324170671202286)",
+			text:  "🦊 fox user 👍",
+			entities: []MessageEntity{
+				{Type: "text_link", Offset: 0, Length: 6, Url: "https://example.com/)"},
+				{Type: "text_mention", Offset: 7, Length: 4, User: &User{Id: 42}},
+				{Type: "custom_emoji", Offset: 12, Length: 2, CustomEmojiId: "5368324170671202286"},
+			},
+		},
+		"code": {
+			input: "`a_*\\`` ```go\nfmt.Println(\"*\")\n```",
+			text:  "a_*` fmt.Println(\"*\")\n",
+			entities: []MessageEntity{
+				{Type: "code", Offset: 0, Length: 4},
+				{Type: "pre", Offset: 5, Length: 17, Language: "go"},
+			},
+		},
+		"blockquotes": {
+			input: ">quote *one*\n>line two\nplain\n**>expandable\n>end||",
+			text:  "quote one\nline two\nplain\nexpandable\nend",
+			entities: []MessageEntity{
+				{Type: "blockquote", Offset: 0, Length: 18},
+				{Type: "bold", Offset: 6, Length: 3},
+				{Type: "expandable_blockquote", Offset: 25, Length: 14},
+			},
+		},
+		"reserved character": {
+			input:  "*bold*.",
+			err:    ErrReservedCharacter,
+			offset: 6,
+		},
+		"unclosed entity": {
+			input:  "🦊 _italic *bold*",
+			err:    ErrUnclosedEntity,
+			offset: 5,
+		},
+		"unclosed url": {
+			input:  "[link](https://example.com",
+			err:    ErrUnclosedURL,
+			offset: 6,
+		},
+		"invalid custom emoji": {
+			input:  "![👍](https://example.com)",
+			err:    ErrInvalidCustomEmoji,
+			offset: 0,
+		},
+		"unclosed entity in quote": {
+			input:  ">*bold\nplain",
+			err:    ErrUnclosedEntity,
+			offset: 1,
+		},
+	})
+}
+
+func TestParseMarkdown(t *testing.T) {
+	runParseTests(t, ParseMarkdown, map[string]parseTest{
+		"entities": {
+			input: "*bold* _it\\_alic_ `code` [link](https://example.com) [me](tg://user?id=1) snake\\_case",
+			text:  "bold it_alic code link me snake_case",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 4},
+				{Type: "italic", Offset: 5, Length: 7},
+				{Type: "code", Offset: 13, Length: 4},
+				{Type: "text_link", Offset: 18, Length: 4, Url: "https://example.com"},
+				{Type: "text_mention", Offset: 23, Length: 2, User: &User{Id: 1}},
+			},
+		},
+		"no nesting": {
+			input:    "*_not italic_*",
+			text:     "_not italic_",
+			entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 12}},
+		},
+		"pre": {
+			input:    "```python\nprint(1)\n```",
+			text:     "print(1)\n",
+			entities: []MessageEntity{{Type: "pre", Offset: 0, Length: 9, Language: "python"}},
+		},
+		"unclosed entity": {
+			input:  "snake_case",
+			err:    ErrUnclosedEntity,
+			offset: 5,
+		},
+	})
+}
+
+func TestParseHTML(t *testing.T) {
+	runParseTests(t, ParseHTML, map[string]parseTest{
+		"entities": {
+			input: `<b>bold <I>italic</I></b> <a href="https://example.com/?a=1&amp;b=2">link</a> <a href='tg://user?id=42'>me</a>` +
+				` <span class="tg-spoiler">spoiler</span> <tg-emoji emoji-id="1">👍</tg-emoji> 1 &lt; 2 &#x1F98A; &nbsp;`,
+			text: "bold italic link me spoiler 👍 1 < 2 🦊 &nbsp;",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 11},
+				{Type: "italic", Offset: 5, Length: 6},
+				{Type: "text_link", Offset: 12, Length: 4, Url: "https://example.com/?a=1&b=2"},
+				{Type: "text_mention", Offset: 17, Length: 2, User: &User{Id: 42}},
+				{Type: "spoiler", Offset: 20, Length: 7},
+				{Type: "custom_emoji", Offset: 28, Length: 2, CustomEmojiId: "1"},
+			},
+		},
+		"pre with language": {
+			input:    `<pre><code class="language-go">x := 1</code></pre> <code class="language-go">y</code>`,
+			text:     "x := 1 y",
+			entities: []MessageEntity{{Type: "pre", Offset: 0, Length: 6, Language: "go"}, {Type: "code", Offset: 7, Length: 1}},
+		},
+		"blockquote": {
+			input:    "<blockquote expandable>a\nb</blockquote>",
+			text:     "a\nb",
+			entities: []MessageEntity{{Type: "expandable_blockquote", Offset: 0, Length: 3}},
+		},
+		"unsupported tag": {
+			input:  "a<br>b",
+			err:    ErrUnsupportedTag,
+			offset: 1,
+		},
+		"unexpected end tag": {
+			input:  "<b><i>a</b></i>",
+			err:    ErrUnexpectedEndTag,
+			offset: 7,
+		},
+		"unclosed tag": {
+			input:  `a <a href="x>b</a>`,
+			err:    ErrUnclosedTag,
+			offset: 2,
+		},
+		"unclosed entity": {
+			input:  "<b>a",
+			err:    ErrUnclosedEntity,
+			offset: 0,
+		},
+	})
+}
+
+func TestParseText(t *testing.T) {
+	text, ents, err := ParseText("<b>a</b>", ParseModeHTML)
+	if err != nil || text != "a" || len(ents) != 1 {
+		t.Errorf("unexpected result: %q %+v %v", text, ents, err)
+	}
+
+	text, ents, err = ParseText("*a*", ParseModeNone)
+	if err != nil || text != "*a*" || ents != nil {
+		t.Errorf("unexpected result: %q %+v %v", text, ents, err)
+	}
+
+	if _, _, err = ParseText("a", "markdownv3"); !errors.Is(err, ErrUnknownParseMode) {
+		t.Errorf("expected unknown parse mode error, got %v", err)
+	}
+}
+
+// fuzzRoundTrip checks that formatting parsed text with the getOrigMsg* functions, and parsing the result again,
+// gives the same text and formatting.
+func fuzzRoundTrip(t *testing.T, input string, parse func(string) (string, []MessageEntity, error), format func([]uint16, []MessageEntity) string, skip func(string, []MessageEntity) bool) {
+	if !utf8.ValidString(input) {
+		return
+	}
+	text, ents, err := parse(input)
+	if err != nil || skip(text, ents) {
+		return
+	}
+
+	formatted := format(utf16.Encode([]rune(text)), ents)
+	text2, ents2, err := parse(formatted)
+	if err != nil {
+		t.Fatalf("failed to parse formatted text %q (from %q): %s", formatted, input, err.Error())
+	}
+	if text2 != text {
+		t.Fatalf("text changed after round trip: %q -> %q -> %q", text, formatted, text2)
+	}
+
+	// Entity edges may be normalised by the formatter (eg moving whitespace out of entities), but the result must then
+	// be stable.
+	formatted2 := format(utf16.Encode([]rune(text2)), ents2)
+	if formatted2 != formatted {
+		t.Fatalf("formatting changed after round trip: %q -> %q -> %q", input, formatted, formatted2)
+	}
+}
+
+// hasDuplicateEntities checks for identical entities, which the formatters merge together.
+func hasDuplicateEntities(ents []MessageEntity) bool {
+	for i := range ents {
+		for j := i + 1; j < len(ents); j++ {
+			if reflect.DeepEqual(ents[i], ents[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func FuzzParseMarkdownV2(f *testing.F) {
+	for _, seed := range []string{
+		"*bold _italic __underline__ ~strike~_ ||spoiler||*",
+		"[link *bold*](https://example.com) [user](tg://user?id=42) ![👍](tg://emoji?id=1)",
+		"`code` ```go\nfmt\n``` ```\n\nx```",
+		">quote *one*\n>line two\nplain\n**>expandable\n>end||",
+		"**>a ||b||||\n>c",
+		"* a *_ b _",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		fuzzRoundTrip(t, input, ParseMarkdownV2, getOrigMsgMDV2, func(text string, ents []MessageEntity) bool {
+			// getOrigMsgMDV2 does not escape text, nor separate ambiguous italic and underline markers.
+			if strings.ContainsAny(text, mdV2Reserved+"\\\r") || hasDuplicateEntities(ents) {
+				return true
+			}
+			for i, a := range ents {
+				if strings.ContainsAny(a.Url, ")\\") {
+					return true
+				}
+				for _, b := range ents[i+1:] {
+					if (a.Type == "italic" || a.Type == "underline") && (b.Type == "italic" || b.Type == "underline") &&
+						(a.Offset == b.Offset || a.Offset+a.Length == b.Offset || a.Offset+a.Length == b.Offset+b.Length) {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	})
+}
+
+func FuzzParseMarkdown(f *testing.F) {
+	for _, seed := range []string{
+		"*bold* _it\\_alic_ `code` [link](https://example.com) [me](tg://user?id=1)",
+		"```python\nprint(1)\n``` ``` x\n```",
+		"[a\\]b](c) [no link]",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		fuzzRoundTrip(t, input, ParseMarkdown, getOrigMsgMD, func(text string, ents []MessageEntity) bool {
+			// getOrigMsgMD does not escape text outside of entities, nor backslashes.
+			if strings.ContainsAny(text, "_*`[\\") {
+				return true
+			}
+			for _, e := range ents {
+				if strings.Contains(e.Url, ")") {
+					return true
+				}
+			}
+			return false
+		})
+	})
+}
+
+func FuzzParseHTML(f *testing.F) {
+	for _, seed := range []string{
+		`<b>bold <i>italic</i></b> <a href="https://example.com">link</a> <a href="tg://user?id=42">me</a>`,
+		`<span class="tg-spoiler">spoiler</span> <tg-emoji emoji-id="1">👍</tg-emoji> 1 &lt; 2 &#x1F98A;`,
+		`<pre><code class="language-go">x := 1</code></pre> <blockquote expandable>a</blockquote>`,
+		`<u><s>a</s></u><b><b>b</b></b>`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		fuzzRoundTrip(t, input, ParseHTML, getOrigMsgHTML, func(text string, ents []MessageEntity) bool {
+			// getOrigMsgHTML does not escape attribute values.
+			for _, e := range ents {
+				if strings.ContainsAny(e.Url+e.Language+e.CustomEmojiId, `"&<>`) {
+					return true
+				}
+			}
+			return hasDuplicateEntities(ents)
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package gotgbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// MaxMessageLength is the maximum length of a message text, in UTF-16 code units.
+	MaxMessageLength = 4096
+	// MaxCaptionLength is the maximum length of a media caption, in UTF-16 code units.
+	MaxCaptionLength = 1024
+)
+
+// TextChunk is a part of a text which was split by SplitText, along with its own entities.
+type TextChunk struct {
+	Text     string
+	Entities []MessageEntity
+}
+
+// SplitText splits a text, and its entities, into chunks of at most maxLength UTF-16 code units; this allows for
+// sending texts which are longer than telegram's limits (see MaxMessageLength and MaxCaptionLength).
+// If maxLength is 0, MaxMessageLength is used.
+//
+// Texts are split at the last paragraph break which fits in a chunk; failing that, at the last line break, sentence
+// end, or whitespace. Surrogate pairs and custom emoji are never split. Entities which span multiple chunks are closed
+// at the end of a chunk, and reopened at the start of the next one. Chunks which only contain whitespace are dropped, as
+// telegram rejects empty messages.
+func SplitText(text string, entities []MessageEntity, maxLength int) []TextChunk {
+	if maxLength <= 0 {
+		maxLength = MaxMessageLength
+	}
+
+	utf16Text := utf16.Encode([]rune(text))
+	if len(utf16Text) <= maxLength {
+		return []TextChunk{{Text: text, Entities: entities}}
+	}
+
+	var chunks []TextChunk
+	for start := 0; start < len(utf16Text); {
+		end := len(utf16Text)
+		if end-start > maxLength {
+			end = splitPoint(utf16Text, entities, start, start+maxLength)
+		}
+		chunkText := string(utf16.Decode(utf16Text[start:end]))
+		if strings.TrimSpace(chunkText) == "" {
+			start = end
+			continue
+		}
+
+		var ents []MessageEntity
+		for _, ent := range entities {
+			entStart := maxInt64(ent.Offset, int64(start))
+			entEnd := minInt64(ent.Offset+ent.Length, int64(end))
+			if entEnd <= entStart {
+				continue
+			}
+			ent.Offset = entStart - int64(start)
+			ent.Length = entEnd - entStart
+			ents = append(ents, ent)
+		}
+
+		chunks = append(chunks, TextChunk{
+			Text:     chunkText,
+			Entities: ents,
+		})
+		start = end
+	}
+	return chunks
+}
+
+// splitPoint finds the best position at which to end a chunk of text, between start and limit.
+// Boundaries in the first half of the chunk are ignored, to avoid generating lots of tiny chunks.
+func splitPoint(text []uint16, entities []MessageEntity, start int, limit int) int {
+	minEnd := start + (limit-start)/2
+
+	for _, isBoundary := range []func(text []uint16, i int) bool{
+		// Paragraphs.
+		func(text []uint16, i int) bool {
+			return text[i-1] == '\n' && i >= 2 && text[i-2] == '\n'
+		},
+		// Lines.
+		func(text []uint16, i int) bool {
+			return text[i-1] == '\n'
+		},
+		// Sentences.
+		func(text []uint16, i int) bool {
+			return isSpace16(text[i-1]) && i >= 2 && (text[i-2] == '.' || text[i-2] == '!' || text[i-2] == '?')
+		},
+		// Words.
+		func(text []uint16, i int) bool {
+			return isSpace16(text[i-1])
+		},
+	} {
+		for i := limit; i > minEnd; i-- {
+			if isBoundary(text, i) && !insideUnsplittable(entities, i) {
+				return i
+			}
+		}
+	}
+
+	// No boundaries; hard cut, without splitting surrogate pairs or custom emoji.
+	for i := limit; i > start; i-- {
+		if !isHighSurrogate(text[i-1]) && !insideUnsplittable(entities, i) {
+			return i
+		}
+	}
+	return limit
+}
+
+func isHighSurrogate(c uint16) bool {
+	return utf16.IsSurrogate(rune(c)) && c < 0xdc00
+}
+
+// insideUnsplittable checks whether a position is inside an entity which can't be split, such as a custom emoji.
+func insideUnsplittable(entities []MessageEntity, i int) bool {
+	for _, ent := range entities {
+		if ent.Type == "custom_emoji" && ent.Offset < int64(i) && int64(i) < ent.Offset+ent.Length {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace16(c uint16) bool {
+	return c == ' ' || c == '\n' || c == '\t'
+}
+
+func minInt64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// SendLongMessage sends a text message of any length, splitting it into multiple messages with SplitText if it is
+// longer than MaxMessageLength. If opts.ParseMode is set, the text is parsed locally to obtain its entities.
+//
+// The first message is sent with all the given opts; the following ones are sent in order, as replies to the first
+// message. The ReplyMarkup is only attached to the last message, and the MessageEffectId only to the first one.
+// All the sent messages are returned; if sending fails midway, the messages sent so far are returned with the error.
+func (bot *Bot) SendLongMessage(chatId int64, text string, opts *SendMessageOpts) ([]*Message, error) {
+	return bot.SendLongMessageWithContext(context.Background(), chatId, text, opts)
+}
+
+// SendLongMessageWithContext is the same as Bot.SendLongMessage, but with a context.Context parameter.
+func (bot *Bot) SendLongMessageWithContext(ctx context.Context, chatId int64, text string, opts *SendMessageOpts) ([]*Message, error) {
+	if opts == nil {
+		opts = &SendMessageOpts{}
+	}
+
+	entities := opts.Entities
+	if opts.ParseMode != ParseModeNone {
+		var err error
+		text, entities, err = ParseText(text, opts.ParseMode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse message text: %w", err)
+		}
+	}
+
+	chunks := SplitText(text, entities, MaxMessageLength)
+	msgs := make([]*Message, 0, len(chunks))
+	for idx, chunk := range chunks {
+		chunkOpts := *opts
+		chunkOpts.ParseMode = ParseModeNone
+		chunkOpts.Entities = chunk.Entities
+		if idx > 0 {
+			chunkOpts.ReplyParameters = &ReplyParameters{MessageId: msgs[0].MessageId}
+			chunkOpts.MessageEffectId = ""
+		}
+		if idx < len(chunks)-1 {
+			chunkOpts.ReplyMarkup = nil
+		}
+
+		msg, err := bot.SendMessageWithContext(ctx, chatId, chunk.Text, &chunkOpts)
+		if err != nil {
+			return msgs, fmt.Errorf("failed to send message chunk %d of %d: %w", idx+1, len(chunks), err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
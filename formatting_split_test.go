@@ -0,0 +1,170 @@
+package gotgbot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestSplitText(t *testing.T) {
+	for name, test := range map[string]struct {
+		text     string
+		maxLen   int
+		expected []string
+	}{
+		"short text": {
+			text:     "hello",
+			maxLen:   10,
+			expected: []string{"hello"},
+		},
+		"paragraphs": {
+			text:     "aaaa bbbb\n\ncccc. dddd\neeee",
+			maxLen:   20,
+			expected: []string{"aaaa bbbb\n\n", "cccc. dddd\neeee"},
+		},
+		"lines": {
+			text:     "aaaa. bbbb\ncccc dddd",
+			maxLen:   15,
+			expected: []string{"aaaa. bbbb\n", "cccc dddd"},
+		},
+		"sentences": {
+			text:     "aaaa. bbbb cccc dddd",
+			maxLen:   12,
+			expected: []string{"aaaa. bbbb ", "cccc dddd"},
+		},
+		"ignore early boundaries": {
+			text:     "a. bbbb cccc dddd",
+			maxLen:   12,
+			expected: []string{"a. bbbb ", "cccc dddd"},
+		},
+		"hard cut": {
+			text:     "aaaaaaaaaa",
+			maxLen:   4,
+			expected: []string{"aaaa", "aaaa", "aa"},
+		},
+		"surrogate pairs": {
+			text:     "a🦊🦊",
+			maxLen:   2,
+			expected: []string{"a", "🦊", "🦊"},
+		},
+		"whitespace-only chunks": {
+			text:     "aaaa\n\n      \n\nbbbb",
+			maxLen:   5,
+			expected: []string{"aaaa\n", "bbbb"},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var texts []string
+			for _, chunk := range SplitText(test.text, nil, test.maxLen) {
+				texts = append(texts, chunk.Text)
+			}
+			if !reflect.DeepEqual(texts, test.expected) {
+				t.Errorf("expected chunks %q, got %q", test.expected, texts)
+			}
+		})
+	}
+}
+
+func TestSplitTextCustomEmoji(t *testing.T) {
+	// Custom emoji can be made of several characters; they are kept whole.
+	text := "aaaa👍🏽"
+	ents := []MessageEntity{{Type: "custom_emoji", Offset: 4, Length: 4, CustomEmojiId: "1"}}
+
+	chunks := SplitText(text, ents, 6)
+	expected := []TextChunk{
+		{Text: "aaaa"},
+		{Text: "👍🏽", Entities: []MessageEntity{{Type: "custom_emoji", Offset: 0, Length: 4, CustomEmojiId: "1"}}},
+	}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("expected chunks %+v, got %+v", expected, chunks)
+	}
+}
+
+func TestSplitTextEntities(t *testing.T) {
+	text, ents := NewTextBuilder().
+		Bold("🦊 aaaa ").
+		With(MessageEntity{Type: "italic"}, func(tb *TextBuilder) {
+			tb.Text("bbbb ").Link("cccc dddd", "https://example.com")
+		}).
+		Text(" eeee").
+		Build()
+
+	chunks := SplitText(text, ents, 12)
+	expected := []TextChunk{
+		{Text: "🦊 aaaa ", Entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 8}}},
+		{Text: "bbbb cccc ", Entities: []MessageEntity{
+			{Type: "italic", Offset: 0, Length: 10},
+			{Type: "text_link", Offset: 5, Length: 5, Url: "https://example.com"},
+		}},
+		{Text: "dddd eeee", Entities: []MessageEntity{
+			{Type: "italic", Offset: 0, Length: 4},
+			{Type: "text_link", Offset: 0, Length: 4, Url: "https://example.com"},
+		}},
+	}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("unexpected chunks:\n%+v\nexpected:\n%+v", chunks, expected)
+	}
+}
+
+func TestSendLongMessage(t *testing.T) {
+	var requests []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %s", err.Error())
+		}
+		requests = append(requests, req)
+
+		bs, _ := json.Marshal(map[string]interface{}{
+			"ok":     true,
+			"result": Message{MessageId: int64(len(requests)), Chat: Chat{Id: 1}},
+		})
+		_, _ = w.Write(bs)
+	}))
+	defer server.Close()
+
+	b := &Bot{
+		Token:     "SOME_TOKEN",
+		BotClient: &BaseBotClient{DefaultRequestOpts: &RequestOpts{APIURL: server.URL}},
+	}
+
+	paragraph := strings.Repeat("word ", 500) + "\n\n"
+	text := "<b>" + paragraph + paragraph + "</b>" + paragraph
+	msgs, err := b.SendLongMessage(1, text, &SendMessageOpts{
+		ParseMode:   ParseModeHTML,
+		ReplyMarkup: InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a", CallbackData: "b"}}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to send long message: %s", err.Error())
+	}
+	// Each paragraph fits in a message, but two don't.
+	if len(msgs) != 3 || len(requests) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(requests))
+	}
+
+	for idx, req := range requests {
+		if l := len(utf16.Encode([]rune(req["text"]))); l > MaxMessageLength {
+			t.Errorf("message %d is too long: %d", idx, l)
+		}
+		if req["parse_mode"] != "" {
+			t.Errorf("message %d should be sent without a parse mode", idx)
+		}
+	}
+	if !strings.Contains(requests[0]["entities"], `"bold"`) || !strings.Contains(requests[1]["entities"], `"bold"`) {
+		t.Errorf("expected bold entity to be reopened: %q, %q", requests[0]["entities"], requests[1]["entities"])
+	}
+	if requests[2]["entities"] != "" {
+		t.Errorf("expected no entities in the last message, got %q", requests[2]["entities"])
+	}
+	if requests[0]["reply_parameters"] != "" || requests[1]["reply_parameters"] != `{"message_id":1}` || requests[2]["reply_parameters"] != `{"message_id":1}` {
+		t.Errorf("expected following messages to reply to the first: %q, %q", requests[1]["reply_parameters"], requests[2]["reply_parameters"])
+	}
+	if requests[0]["reply_markup"] != "" || requests[1]["reply_markup"] != "" || requests[2]["reply_markup"] == "" {
+		t.Errorf("expected reply markup on the last message only")
+	}
+}
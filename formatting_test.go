@@ -0,0 +1,81 @@
+package gotgbot
+
+import (
+	"testing"
+)
+
+func TestOriginalFormatting(t *testing.T) {
+	for name, tc := range map[string]struct {
+		msg          Message
+		expectedMD   string
+		expectedMDV2 string
+		expectedHTML string
+	}{
+		"pre with language": {
+			msg: Message{
+				Text:     "fmt.Println()",
+				Entities: []MessageEntity{{Type: "pre", Offset: 0, Length: 13, Language: "go"}},
+			},
+			expectedMD:   "```go\nfmt.Println()```",
+			expectedMDV2: "```go\nfmt.Println()```",
+			expectedHTML: `<pre><code class="language-go">fmt.Println()</code></pre>`,
+		},
+		"pre without language": {
+			msg: Message{
+				Text:     "code",
+				Entities: []MessageEntity{{Type: "pre", Offset: 0, Length: 4}},
+			},
+			expectedMD:   "```code```",
+			expectedMDV2: "```\ncode```",
+			expectedHTML: "<pre>code</pre>",
+		},
+		"whitespace-only entity": {
+			msg: Message{
+				Text:     "a   b",
+				Entities: []MessageEntity{{Type: "bold", Offset: 1, Length: 3}},
+			},
+			expectedMD:   "a   b",
+			expectedMDV2: "a   b",
+			expectedHTML: "a<b>   </b>b",
+		},
+		"trailing whitespace keeps its order": {
+			msg: Message{
+				Text:     "a bold \n b",
+				Entities: []MessageEntity{{Type: "bold", Offset: 2, Length: 6}},
+			},
+			expectedMD:   "a *bold* \n b",
+			expectedMDV2: "a *bold* \n b",
+			expectedHTML: "a <b>bold \n</b> b",
+		},
+		"code keeps whitespace": {
+			msg: Message{
+				Text:     "a  y b",
+				Entities: []MessageEntity{{Type: "code", Offset: 2, Length: 3}},
+			},
+			expectedMD:   "a ` y `b",
+			expectedMDV2: "a ` y `b",
+			expectedHTML: "a <code> y </code>b",
+		},
+		"blockquote keeps leading whitespace": {
+			msg: Message{
+				Text:     " quote\n\nnext",
+				Entities: []MessageEntity{{Type: "blockquote", Offset: 0, Length: 8}},
+			},
+			expectedMD:   " quote\n\nnext",
+			expectedMDV2: "> quote\n\nnext",
+			expectedHTML: "<blockquote> quote\n\n</blockquote>next",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if md := tc.msg.OriginalMD(); md != tc.expectedMD {
+				t.Errorf("unexpected markdown:\n%q\nexpected:\n%q", md, tc.expectedMD)
+			}
+			if mdv2 := tc.msg.OriginalMDV2(); mdv2 != tc.expectedMDV2 {
+				t.Errorf("unexpected markdownV2:\n%q\nexpected:\n%q", mdv2, tc.expectedMDV2)
+			}
+			if html := tc.msg.OriginalHTML(); html != tc.expectedHTML {
+				t.Errorf("unexpected HTML:\n%q\nexpected:\n%q", html, tc.expectedHTML)
+			}
+		})
+	}
+}
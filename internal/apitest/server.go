@@ -0,0 +1,163 @@
+// Package apitest contains a fake bot API server, which records the requests made to it. It is only intended for tests.
+package apitest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// UploadedFile is a file which was uploaded as part of a multipart request.
+type UploadedFile struct {
+	FileName    string
+	ContentType string
+	Contents    string
+}
+
+// Request is a bot API request received by a Server.
+type Request struct {
+	// Method is the bot API method which was called.
+	Method string
+	// Params contains the request parameters, excluding any uploaded files.
+	Params map[string]string
+	// Files contains the uploaded files, by field name.
+	Files map[string]UploadedFile
+}
+
+// Uploaded returns the sorted field names of the files uploaded with the request.
+func (r Request) Uploaded() []string {
+	fields := make([]string, 0, len(r.Files))
+	for k := range r.Files {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ServerOpts can be used to configure the responses of a Server.
+type ServerOpts struct {
+	// Reply returns the JSON response to a bot API request. It may be called concurrently.
+	// If nil, all requests succeed with a true result.
+	Reply func(req Request) string
+	// Files maps file paths, as returned by getFile, to the contents served on the file download endpoint.
+	Files map[string]string
+	// IgnoreRanges serves files in full, ignoring any Range headers.
+	IgnoreRanges bool
+}
+
+// Server is a fake bot API server, which records the bot API requests made to it.
+type Server struct {
+	// URL is the base URL of the server, to be used as the bot's APIURL.
+	URL string
+
+	opts ServerOpts
+
+	lock     sync.Mutex
+	requests []Request
+}
+
+// NewServer starts a new Server, which is closed once the test has completed.
+func NewServer(t testing.TB, opts *ServerOpts) *Server {
+	s := &Server{}
+	if opts != nil {
+		s.opts = *opts
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filePath, ok := strings.CutPrefix(r.URL.Path, "/file/"); ok {
+			s.serveFile(w, r, filePath)
+			return
+		}
+
+		req, err := readRequest(r)
+		if err != nil {
+			t.Errorf("failed to read request: %s", err.Error())
+		}
+
+		s.lock.Lock()
+		s.requests = append(s.requests, req)
+		s.lock.Unlock()
+
+		if s.opts.Reply == nil {
+			_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(s.opts.Reply(req)))
+	}))
+	t.Cleanup(server.Close)
+
+	s.URL = server.URL
+	return s
+}
+
+// Requests returns all the bot API requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// serveFile serves a file download. The file path is prefixed by the bot's token, which is ignored.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, filePath string) {
+	_, filePath, _ = strings.Cut(filePath, "/")
+	contents, ok := s.opts.Files[filePath]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if s.opts.IgnoreRanges {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, path.Base(filePath), time.Time{}, strings.NewReader(contents))
+}
+
+// readRequest reads the method, parameters and uploaded files of a bot API request.
+func readRequest(r *http.Request) (Request, error) {
+	req := Request{
+		Method: path.Base(r.URL.Path),
+		Params: map[string]string{},
+		Files:  map[string]UploadedFile{},
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := json.NewDecoder(r.Body).Decode(&req.Params); err != nil && !errors.Is(err, io.EOF) {
+			return req, fmt.Errorf("failed to decode request: %w", err)
+		}
+		return req, nil
+	}
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return req, fmt.Errorf("failed to parse multipart form: %w", err)
+	}
+	for k, v := range r.MultipartForm.Value {
+		req.Params[k] = v[0]
+	}
+	for k, fs := range r.MultipartForm.File {
+		f, err := fs[0].Open()
+		if err != nil {
+			return req, fmt.Errorf("failed to open uploaded file %s: %w", k, err)
+		}
+		bs, err := io.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return req, fmt.Errorf("failed to read uploaded file %s: %w", k, err)
+		}
+		req.Files[k] = UploadedFile{
+			FileName:    fs[0].Filename,
+			ContentType: fs[0].Header.Get("Content-Type"),
+			Contents:    string(bs),
+		}
+	}
+	return req, nil
+}
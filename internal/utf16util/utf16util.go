@@ -0,0 +1,13 @@
+// Package utf16util contains helpers for working with the UTF-16 offsets used by Telegram message entities.
+package utf16util
+
+import "unicode"
+
+// RuneLen returns the number of UTF-16 code units needed to encode the rune.
+// Runes outside the basic multilingual plane are encoded as surrogate pairs.
+func RuneLen(r rune) int64 {
+	if r >= 0x10000 && r <= unicode.MaxRune {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,364 @@
+package gotgbot
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// The consts listed below represent the keyboard limits enforced by telegram.
+const (
+	// MaxInlineKeyboardRowSize is the maximum number of buttons allowed in a single inline keyboard row.
+	MaxInlineKeyboardRowSize = 8
+	// MaxInlineKeyboardButtons is the maximum number of buttons allowed in an inline keyboard.
+	MaxInlineKeyboardButtons = 100
+	// MaxReplyKeyboardRowSize is the maximum number of buttons allowed in a single reply keyboard row.
+	MaxReplyKeyboardRowSize = 12
+	// MaxReplyKeyboardButtons is the maximum number of buttons allowed in a reply keyboard.
+	MaxReplyKeyboardButtons = 300
+	// MaxCallbackDataSize is the maximum size of an inline button's callback data, in bytes.
+	MaxCallbackDataSize = 64
+	// MaxInputFieldPlaceholderSize is the maximum length of a keyboard input field placeholder, in characters.
+	MaxInputFieldPlaceholderSize = 64
+	// MaxCopyTextSize is the maximum length of a copy text button's contents, in characters.
+	MaxCopyTextSize = 256
+)
+
+var (
+	ErrKeyboardRowTooLarge       = errors.New("too many buttons in keyboard row")
+	ErrKeyboardTooLarge          = errors.New("too many buttons in keyboard")
+	ErrEmptyButtonText           = errors.New("empty button text")
+	ErrInvalidCallbackData       = errors.New("invalid callback data")
+	ErrInvalidInlineButtonAction = errors.New("inline button must have exactly one action")
+	ErrInvalidPlaceholder        = errors.New("invalid input field placeholder")
+	ErrInvalidCopyText           = errors.New("invalid copy text")
+)
+
+// InlineKeyboardBuilder is a helper to build InlineKeyboardMarkup objects, without needing to nest button literals by
+// hand. Buttons are added to the current row; new rows can be started manually with Row, or automatically by setting
+// a column count with Columns.
+//
+// For example:
+//
+//	markup, err := gotgbot.NewInlineKeyboard().
+//		Columns(2).
+//		Callback("Yes", "vote_yes").
+//		Callback("No", "vote_no").
+//		Row().
+//		URL("Docs", "https://core.telegram.org/bots/api").
+//		Build()
+//
+// All telegram limits are checked when calling Build, so layout mistakes are caught before the markup is sent.
+type InlineKeyboardBuilder struct {
+	// rows contains all the rows which have been built so far; the last row is the one currently being filled.
+	rows [][]InlineKeyboardButton
+	// columns is the number of buttons after which a new row is automatically started. 0 means no wrapping.
+	columns int
+}
+
+// NewInlineKeyboard creates a new, empty, InlineKeyboardBuilder.
+func NewInlineKeyboard() *InlineKeyboardBuilder {
+	return &InlineKeyboardBuilder{}
+}
+
+// Columns sets the number of buttons after which rows are automatically wrapped.
+// A value of 0 disables wrapping; rows then have to be started manually with Row.
+func (kb *InlineKeyboardBuilder) Columns(n int) *InlineKeyboardBuilder {
+	kb.columns = n
+	return kb
+}
+
+// Row starts a new row, containing the given buttons (if any).
+// Calling Row on a builder whose current row is still empty does not create an empty row.
+func (kb *InlineKeyboardBuilder) Row(buttons ...InlineKeyboardButton) *InlineKeyboardBuilder {
+	if len(kb.rows) == 0 || len(kb.rows[len(kb.rows)-1]) != 0 {
+		kb.rows = append(kb.rows, nil)
+	}
+	return kb.Add(buttons...)
+}
+
+// Add appends buttons to the current row, wrapping to a new row when the column count is reached.
+func (kb *InlineKeyboardBuilder) Add(buttons ...InlineKeyboardButton) *InlineKeyboardBuilder {
+	for _, b := range buttons {
+		if len(kb.rows) == 0 || (kb.columns > 0 && len(kb.rows[len(kb.rows)-1]) >= kb.columns) {
+			kb.rows = append(kb.rows, nil)
+		}
+		kb.rows[len(kb.rows)-1] = append(kb.rows[len(kb.rows)-1], b)
+	}
+	return kb
+}
+
+// URL adds a button which opens the given URL when pressed.
+func (kb *InlineKeyboardBuilder) URL(text string, url string) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, Url: url})
+}
+
+// Callback adds a button which sends the given data in a callback query when pressed.
+func (kb *InlineKeyboardBuilder) Callback(text string, data string) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, CallbackData: data})
+}
+
+// WebApp adds a button which launches the web app at the given URL when pressed.
+func (kb *InlineKeyboardBuilder) WebApp(text string, url string) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, WebApp: &WebAppInfo{Url: url}})
+}
+
+// SwitchInlineQuery adds a button which prompts the user to select a chat, and inserts the bot's username and the
+// given query in the input field. The query may be empty.
+func (kb *InlineKeyboardBuilder) SwitchInlineQuery(text string, query string) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, SwitchInlineQuery: &query})
+}
+
+// SwitchInlineQueryCurrentChat adds a button which inserts the bot's username and the given query in the current
+// chat's input field. The query may be empty.
+func (kb *InlineKeyboardBuilder) SwitchInlineQueryCurrentChat(text string, query string) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, SwitchInlineQueryCurrentChat: &query})
+}
+
+// SwitchInlineQueryChosenChat adds a button which prompts the user to select a chat of the specified types, and
+// inserts the bot's username and the specified query in the input field.
+func (kb *InlineKeyboardBuilder) SwitchInlineQueryChosenChat(text string, chosenChat SwitchInlineQueryChosenChat) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, SwitchInlineQueryChosenChat: &chosenChat})
+}
+
+// CopyText adds a button which copies the given text to the user's clipboard when pressed.
+func (kb *InlineKeyboardBuilder) CopyText(text string, copyText string) *InlineKeyboardBuilder {
+	return kb.Add(InlineKeyboardButton{Text: text, CopyText: &CopyTextButton{Text: copyText}})
+}
+
+// Build validates the keyboard against telegram's limits, and returns the resulting InlineKeyboardMarkup.
+func (kb *InlineKeyboardBuilder) Build() (InlineKeyboardMarkup, error) {
+	rows := make([][]InlineKeyboardButton, 0, len(kb.rows))
+	total := 0
+	for idx, row := range kb.rows {
+		if len(row) == 0 {
+			// Skip any trailing empty rows.
+			continue
+		}
+		if len(row) > MaxInlineKeyboardRowSize {
+			return InlineKeyboardMarkup{}, fmt.Errorf("%w: row %d has %d buttons, max is %d", ErrKeyboardRowTooLarge, idx, len(row), MaxInlineKeyboardRowSize)
+		}
+		for _, b := range row {
+			if err := validateInlineKeyboardButton(b); err != nil {
+				return InlineKeyboardMarkup{}, fmt.Errorf("invalid button %q in row %d: %w", b.Text, idx, err)
+			}
+		}
+		total += len(row)
+		rows = append(rows, row)
+	}
+
+	if total > MaxInlineKeyboardButtons {
+		return InlineKeyboardMarkup{}, fmt.Errorf("%w: got %d buttons, max is %d", ErrKeyboardTooLarge, total, MaxInlineKeyboardButtons)
+	}
+
+	return InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// validateInlineKeyboardButton checks that a single inline button is within telegram's limits.
+func validateInlineKeyboardButton(b InlineKeyboardButton) error {
+	if b.Text == "" {
+		return ErrEmptyButtonText
+	}
+
+	actions := 0
+	if b.Url != "" {
+		actions++
+	}
+	if b.CallbackData != "" {
+		if len(b.CallbackData) > MaxCallbackDataSize {
+			return fmt.Errorf("%w: got %d bytes, max is %d", ErrInvalidCallbackData, len(b.CallbackData), MaxCallbackDataSize)
+		}
+		actions++
+	}
+	if b.WebApp != nil {
+		actions++
+	}
+	if b.LoginUrl != nil {
+		actions++
+	}
+	if b.SwitchInlineQuery != nil {
+		actions++
+	}
+	if b.SwitchInlineQueryCurrentChat != nil {
+		actions++
+	}
+	if b.SwitchInlineQueryChosenChat != nil {
+		actions++
+	}
+	if b.CopyText != nil {
+		if l := utf8.RuneCountInString(b.CopyText.Text); l == 0 || l > MaxCopyTextSize {
+			return fmt.Errorf("%w: got %d characters, expected 1-%d", ErrInvalidCopyText, l, MaxCopyTextSize)
+		}
+		actions++
+	}
+	if b.CallbackGame != nil {
+		actions++
+	}
+	if b.Pay {
+		actions++
+	}
+
+	if actions != 1 {
+		return fmt.Errorf("%w: got %d", ErrInvalidInlineButtonAction, actions)
+	}
+	return nil
+}
+
+// ReplyKeyboardBuilder is a helper to build ReplyKeyboardMarkup objects. It follows the same row and column logic as
+// the InlineKeyboardBuilder.
+type ReplyKeyboardBuilder struct {
+	// rows contains all the rows which have been built so far; the last row is the one currently being filled.
+	rows [][]KeyboardButton
+	// columns is the number of buttons after which a new row is automatically started. 0 means no wrapping.
+	columns int
+	// markup contains all the non-button keyboard settings.
+	markup ReplyKeyboardMarkup
+}
+
+// NewReplyKeyboard creates a new, empty, ReplyKeyboardBuilder.
+func NewReplyKeyboard() *ReplyKeyboardBuilder {
+	return &ReplyKeyboardBuilder{}
+}
+
+// Columns sets the number of buttons after which rows are automatically wrapped.
+// A value of 0 disables wrapping; rows then have to be started manually with Row.
+func (kb *ReplyKeyboardBuilder) Columns(n int) *ReplyKeyboardBuilder {
+	kb.columns = n
+	return kb
+}
+
+// Row starts a new row, containing the given buttons (if any).
+// Calling Row on a builder whose current row is still empty does not create an empty row.
+func (kb *ReplyKeyboardBuilder) Row(buttons ...KeyboardButton) *ReplyKeyboardBuilder {
+	if len(kb.rows) == 0 || len(kb.rows[len(kb.rows)-1]) != 0 {
+		kb.rows = append(kb.rows, nil)
+	}
+	return kb.Add(buttons...)
+}
+
+// Add appends buttons to the current row, wrapping to a new row when the column count is reached.
+func (kb *ReplyKeyboardBuilder) Add(buttons ...KeyboardButton) *ReplyKeyboardBuilder {
+	for _, b := range buttons {
+		if len(kb.rows) == 0 || (kb.columns > 0 && len(kb.rows[len(kb.rows)-1]) >= kb.columns) {
+			kb.rows = append(kb.rows, nil)
+		}
+		kb.rows[len(kb.rows)-1] = append(kb.rows[len(kb.rows)-1], b)
+	}
+	return kb
+}
+
+// Text adds a button which sends its text as a message when pressed.
+func (kb *ReplyKeyboardBuilder) Text(text string) *ReplyKeyboardBuilder {
+	return kb.Add(KeyboardButton{Text: text})
+}
+
+// RequestContact adds a button which sends the user's phone number when pressed. Private chats only.
+func (kb *ReplyKeyboardBuilder) RequestContact(text string) *ReplyKeyboardBuilder {
+	return kb.Add(KeyboardButton{Text: text, RequestContact: true})
+}
+
+// RequestLocation adds a button which sends the user's location when pressed. Private chats only.
+func (kb *ReplyKeyboardBuilder) RequestLocation(text string) *ReplyKeyboardBuilder {
+	return kb.Add(KeyboardButton{Text: text, RequestLocation: true})
+}
+
+// WebApp adds a button which launches the web app at the given URL when pressed. Private chats only.
+func (kb *ReplyKeyboardBuilder) WebApp(text string, url string) *ReplyKeyboardBuilder {
+	return kb.Add(KeyboardButton{Text: text, WebApp: &WebAppInfo{Url: url}})
+}
+
+// Persistent requests clients to always show the keyboard when the regular keyboard is hidden.
+func (kb *ReplyKeyboardBuilder) Persistent(persistent bool) *ReplyKeyboardBuilder {
+	kb.markup.IsPersistent = persistent
+	return kb
+}
+
+// Resize requests clients to resize the keyboard vertically for optimal fit.
+func (kb *ReplyKeyboardBuilder) Resize(resize bool) *ReplyKeyboardBuilder {
+	kb.markup.ResizeKeyboard = resize
+	return kb
+}
+
+// OneTime requests clients to hide the keyboard as soon as it's been used.
+func (kb *ReplyKeyboardBuilder) OneTime(oneTime bool) *ReplyKeyboardBuilder {
+	kb.markup.OneTimeKeyboard = oneTime
+	return kb
+}
+
+// Placeholder sets the placeholder to be shown in the input field when the keyboard is active.
+func (kb *ReplyKeyboardBuilder) Placeholder(placeholder string) *ReplyKeyboardBuilder {
+	kb.markup.InputFieldPlaceholder = placeholder
+	return kb
+}
+
+// Selective only shows the keyboard to the users targeted by the message.
+func (kb *ReplyKeyboardBuilder) Selective(selective bool) *ReplyKeyboardBuilder {
+	kb.markup.Selective = selective
+	return kb
+}
+
+// Build validates the keyboard against telegram's limits, and returns the resulting ReplyKeyboardMarkup.
+func (kb *ReplyKeyboardBuilder) Build() (ReplyKeyboardMarkup, error) {
+	if err := validatePlaceholder(kb.markup.InputFieldPlaceholder); err != nil {
+		return ReplyKeyboardMarkup{}, err
+	}
+
+	rows := make([][]KeyboardButton, 0, len(kb.rows))
+	total := 0
+	for idx, row := range kb.rows {
+		if len(row) == 0 {
+			// Skip any trailing empty rows.
+			continue
+		}
+		if len(row) > MaxReplyKeyboardRowSize {
+			return ReplyKeyboardMarkup{}, fmt.Errorf("%w: row %d has %d buttons, max is %d", ErrKeyboardRowTooLarge, idx, len(row), MaxReplyKeyboardRowSize)
+		}
+		for _, b := range row {
+			if b.Text == "" {
+				return ReplyKeyboardMarkup{}, fmt.Errorf("invalid button in row %d: %w", idx, ErrEmptyButtonText)
+			}
+		}
+		total += len(row)
+		rows = append(rows, row)
+	}
+
+	if total > MaxReplyKeyboardButtons {
+		return ReplyKeyboardMarkup{}, fmt.Errorf("%w: got %d buttons, max is %d", ErrKeyboardTooLarge, total, MaxReplyKeyboardButtons)
+	}
+
+	markup := kb.markup
+	markup.Keyboard = rows
+	return markup, nil
+}
+
+// RemoveKeyboard returns the markup used to remove the current custom reply keyboard.
+// If selective is true, the keyboard is only removed for the users targeted by the message.
+func RemoveKeyboard(selective bool) ReplyKeyboardRemove {
+	return ReplyKeyboardRemove{
+		RemoveKeyboard: true,
+		Selective:      selective,
+	}
+}
+
+// NewForceReply returns the markup used to show the reply interface to the user, as if they had manually selected the
+// bot's message and tapped 'Reply'. The placeholder is optional.
+func NewForceReply(placeholder string, selective bool) (ForceReply, error) {
+	if err := validatePlaceholder(placeholder); err != nil {
+		return ForceReply{}, err
+	}
+
+	return ForceReply{
+		ForceReply:            true,
+		InputFieldPlaceholder: placeholder,
+		Selective:             selective,
+	}, nil
+}
+
+// validatePlaceholder ensures that an input field placeholder is within telegram's limits. Empty is valid, since the
+// field is optional.
+func validatePlaceholder(placeholder string) error {
+	if l := utf8.RuneCountInString(placeholder); l > MaxInputFieldPlaceholderSize {
+		return fmt.Errorf("%w: got %d characters, max is %d", ErrInvalidPlaceholder, l, MaxInputFieldPlaceholderSize)
+	}
+	return nil
+}
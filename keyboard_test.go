@@ -0,0 +1,123 @@
+package gotgbot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInlineKeyboardBuilderLayout(t *testing.T) {
+	markup, err := NewInlineKeyboard().
+		Columns(2).
+		Callback("1", "one").
+		Callback("2", "two").
+		Callback("3", "three").
+		Row().
+		URL("docs", "https://core.telegram.org/bots/api").
+		CopyText("copy", "some text").
+		SwitchInlineQuery("share", "").
+		Row(). // trailing empty rows are dropped
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error building keyboard: %s", err.Error())
+	}
+
+	expected := []int{2, 1, 2, 1}
+	if len(markup.InlineKeyboard) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(markup.InlineKeyboard))
+	}
+	for idx, row := range markup.InlineKeyboard {
+		if len(row) != expected[idx] {
+			t.Errorf("expected row %d to have %d buttons, got %d", idx, expected[idx], len(row))
+		}
+	}
+
+	share := markup.InlineKeyboard[3][0]
+	if share.SwitchInlineQuery == nil || *share.SwitchInlineQuery != "" {
+		t.Errorf("expected empty switch inline query to be kept as a non-nil pointer")
+	}
+}
+
+func TestInlineKeyboardBuilderValidation(t *testing.T) {
+	for name, test := range map[string]struct {
+		kb  *InlineKeyboardBuilder
+		err error
+	}{
+		"row too large": {
+			kb:  NewInlineKeyboard().Add(makeCallbackButtons(MaxInlineKeyboardRowSize + 1)...),
+			err: ErrKeyboardRowTooLarge,
+		},
+		"too many buttons": {
+			kb:  NewInlineKeyboard().Columns(MaxInlineKeyboardRowSize).Add(makeCallbackButtons(MaxInlineKeyboardButtons + 1)...),
+			err: ErrKeyboardTooLarge,
+		},
+		"callback data too long": {
+			kb:  NewInlineKeyboard().Callback("text", strings.Repeat("a", MaxCallbackDataSize+1)),
+			err: ErrInvalidCallbackData,
+		},
+		"no action": {
+			kb:  NewInlineKeyboard().Add(InlineKeyboardButton{Text: "text"}),
+			err: ErrInvalidInlineButtonAction,
+		},
+		"two actions": {
+			kb:  NewInlineKeyboard().Add(InlineKeyboardButton{Text: "text", Url: "https://t.me", CallbackData: "data"}),
+			err: ErrInvalidInlineButtonAction,
+		},
+		"empty text": {
+			kb:  NewInlineKeyboard().Callback("", "data"),
+			err: ErrEmptyButtonText,
+		},
+		"empty copy text": {
+			kb:  NewInlineKeyboard().CopyText("copy", ""),
+			err: ErrInvalidCopyText,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			_, err := test.kb.Build()
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestReplyKeyboardBuilder(t *testing.T) {
+	markup, err := NewReplyKeyboard().
+		Columns(3).
+		Text("a").Text("b").Text("c").Text("d").
+		Row(KeyboardButton{Text: "e"}).
+		RequestContact("phone").
+		Resize(true).
+		OneTime(true).
+		Placeholder("pick one").
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error building keyboard: %s", err.Error())
+	}
+
+	if len(markup.Keyboard) != 3 || len(markup.Keyboard[0]) != 3 || len(markup.Keyboard[1]) != 1 || len(markup.Keyboard[2]) != 2 {
+		t.Errorf("unexpected keyboard layout: %+v", markup.Keyboard)
+	}
+	if !markup.ResizeKeyboard || !markup.OneTimeKeyboard || markup.InputFieldPlaceholder != "pick one" {
+		t.Errorf("keyboard settings were not applied: %+v", markup)
+	}
+
+	_, err = NewReplyKeyboard().Text("a").Placeholder(strings.Repeat("a", MaxInputFieldPlaceholderSize+1)).Build()
+	if !errors.Is(err, ErrInvalidPlaceholder) {
+		t.Errorf("expected placeholder error, got %v", err)
+	}
+
+	_, err = NewForceReply(strings.Repeat("a", MaxInputFieldPlaceholderSize+1), false)
+	if !errors.Is(err, ErrInvalidPlaceholder) {
+		t.Errorf("expected placeholder error for force reply, got %v", err)
+	}
+}
+
+func makeCallbackButtons(n int) []InlineKeyboardButton {
+	buttons := make([]InlineKeyboardButton, n)
+	for i := range buttons {
+		buttons[i] = InlineKeyboardButton{Text: "button", CallbackData: "data"}
+	}
+	return buttons
+}
@@ -0,0 +1,207 @@
+package gotgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MaxUploadSize is the maximum size of a file uploaded to the cloud bot API, in bytes.
+	MaxUploadSize = 50 << 20
+	// MaxDownloadSize is the maximum size of a file which can be downloaded from the cloud bot API, in bytes.
+	MaxDownloadSize = 20 << 20
+	// LocalServerMaxUploadSize is the maximum size of a file uploaded to a local bot API server, in bytes.
+	// Local servers have no download limit.
+	LocalServerMaxUploadSize = 2000 << 20
+)
+
+var ErrUnsupportedBotClient = errors.New("unsupported BotClient")
+
+// LocalFileResolver is an optional extension of the BotClient interface, used by File.LocalPath to find files
+// returned by a local bot API server. BotClient middlewares should implement it by calling ResolveLocalFilePath on the
+// BotClient they wrap.
+type LocalFileResolver interface {
+	// LocalFilePath returns the path on disk of a file returned by Bot.GetFile, if it is stored locally.
+	LocalFilePath(tgFilePath string) (string, bool)
+}
+
+var _ LocalFileResolver = &BaseBotClient{}
+
+// ResolveLocalFilePath returns the path on disk of a file through the given BotClient, if it implements
+// LocalFileResolver. Otherwise, absolute paths are assumed to come from a local bot API server sharing this machine's
+// filesystem, and are returned as-is.
+func ResolveLocalFilePath(client BotClient, tgFilePath string) (string, bool) {
+	if r, ok := client.(LocalFileResolver); ok {
+		return r.LocalFilePath(tgFilePath)
+	}
+	if !filepath.IsAbs(tgFilePath) {
+		return "", false
+	}
+	return tgFilePath, true
+}
+
+// LocalFilePath returns the path on disk of a file returned by Bot.GetFile, when running against a local bot API
+// server. Local servers return absolute paths in their own filesystem; these are rebased from LocalServerDir to
+// LocalFileDir, if set.
+// If the client is not in local server mode, or the path is not absolute, false is returned.
+func (bot *BaseBotClient) LocalFilePath(tgFilePath string) (string, bool) {
+	if !bot.UseLocalServer || !filepath.IsAbs(tgFilePath) {
+		return "", false
+	}
+
+	if bot.LocalServerDir == "" || bot.LocalFileDir == "" {
+		return tgFilePath, true
+	}
+
+	rel, err := filepath.Rel(bot.LocalServerDir, tgFilePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// Not within the server's directory; assume it is available as-is.
+		return tgFilePath, true
+	}
+	return filepath.Join(bot.LocalFileDir, rel), true
+}
+
+// serverFilePath is the reverse of LocalFilePath: it rebases a path on this machine from LocalFileDir to
+// LocalServerDir, so that the local server can find it. Paths outside of LocalFileDir are returned as-is.
+func (bot *BaseBotClient) serverFilePath(path string) string {
+	if bot.LocalServerDir == "" || bot.LocalFileDir == "" {
+		return path
+	}
+
+	rel, err := filepath.Rel(bot.LocalFileDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(bot.LocalServerDir, rel)
+}
+
+// localFileParams replaces any files which exist on disk with file:// URIs, so that a local bot API server can read
+// them directly rather than having them uploaded. Paths within LocalFileDir are rebased to LocalServerDir.
+// Files without a path are left in the returned data map.
+func (bot *BaseBotClient) localFileParams(params map[string]string, data map[string]FileReader) (map[string]string, map[string]FileReader, error) {
+	var newParams map[string]string
+	var newData map[string]FileReader
+	for key, file := range data {
+		path := fileReaderPath(file)
+		if path == "" {
+			continue
+		}
+
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get absolute path of file for field %s: %w", key, err)
+		}
+		path = bot.serverFilePath(path)
+		uri := "file://" + filepath.ToSlash(path)
+		if !strings.HasPrefix(filepath.ToSlash(path), "/") {
+			// Windows paths need an extra slash; eg file:///C:/file.txt.
+			uri = "file:///" + filepath.ToSlash(path)
+		}
+
+		if newParams == nil {
+			// Copy the maps, to avoid modifying the caller's values.
+			newParams = copyParams(params)
+			newData = copyFileReaders(data)
+		}
+
+		replaceAttachment(newParams, key, uri)
+		delete(newData, key)
+	}
+
+	if newParams == nil {
+		return params, data, nil
+	}
+	return newParams, newData, nil
+}
+
+// fileReaderPath returns the path on disk of the file being read, if any.
+func fileReaderPath(file FileReader) string {
+	if file.path != "" {
+		return file.path
+	}
+	if file.Open != nil {
+		return ""
+	}
+	if f, ok := file.Data.(*os.File); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// MigrateToLocalServerOpts is the set of optional fields for Bot.MigrateToLocalServer.
+type MigrateToLocalServerOpts struct {
+	// LocalServerDir and LocalFileDir are set on the BaseBotClient; see BaseBotClient.LocalFilePath.
+	LocalServerDir string
+	LocalFileDir   string
+	// DropPendingUpdates drops any pending updates when removing the webhook from a previous local server.
+	DropPendingUpdates bool
+	// RequestOpts are used for the LogOut, DeleteWebhook and Close calls to the previous server.
+	RequestOpts *RequestOpts
+}
+
+// MigrateToLocalServer moves the bot to the local bot API server at the given URL. The bot's BotClient must be a
+// *BaseBotClient.
+//
+// If the bot is currently using the cloud bot API, Bot.LogOut is called on it; if it is using a different local
+// server, its webhook is removed and Bot.Close is called on it. The BaseBotClient is then switched to the new server
+// in local server mode.
+// Note that after logging out, the bot cannot log back in to the cloud bot API for 10 minutes.
+//
+// This modifies the BotClient in place, so should not be called while requests are being made (eg while the updater
+// is running).
+func (bot *Bot) MigrateToLocalServer(apiURL string, opts *MigrateToLocalServerOpts) error {
+	return bot.MigrateToLocalServerWithContext(context.Background(), apiURL, opts)
+}
+
+// MigrateToLocalServerWithContext is the same as Bot.MigrateToLocalServer, but with a context.Context parameter.
+func (bot *Bot) MigrateToLocalServerWithContext(ctx context.Context, apiURL string, opts *MigrateToLocalServerOpts) error {
+	client, ok := bot.BotClient.(*BaseBotClient)
+	if !ok {
+		return fmt.Errorf("%w: expected *BaseBotClient, got %T", ErrUnsupportedBotClient, bot.BotClient)
+	}
+	if opts == nil {
+		opts = &MigrateToLocalServerOpts{}
+	}
+
+	if client.UseLocalServer {
+		_, err := bot.DeleteWebhookWithContext(ctx, &DeleteWebhookOpts{
+			DropPendingUpdates: opts.DropPendingUpdates,
+			RequestOpts:        opts.RequestOpts,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete webhook from previous local server: %w", err)
+		}
+		if _, err = bot.CloseWithContext(ctx, &CloseOpts{RequestOpts: opts.RequestOpts}); err != nil {
+			return fmt.Errorf("failed to close bot on previous local server: %w", err)
+		}
+	} else {
+		if _, err := bot.LogOutWithContext(ctx, &LogOutOpts{RequestOpts: opts.RequestOpts}); err != nil {
+			return fmt.Errorf("failed to log out from cloud bot API: %w", err)
+		}
+	}
+
+	client.UseLocalServer = true
+	client.LocalServerDir = opts.LocalServerDir
+	client.LocalFileDir = opts.LocalFileDir
+	if client.DefaultRequestOpts == nil {
+		client.DefaultRequestOpts = &RequestOpts{}
+	} else {
+		reqOpts := *client.DefaultRequestOpts
+		client.DefaultRequestOpts = &reqOpts
+	}
+	client.DefaultRequestOpts.APIURL = apiURL
+	return nil
+}
+
+// LocalPath is a helper function to get the path on disk of a file returned by a local bot API server.
+// See BaseBotClient.LocalFilePath and ResolveLocalFilePath for more details.
+func (f File) LocalPath(b *Bot) (string, bool) {
+	if b.BotClient == nil {
+		return "", false
+	}
+	return ResolveLocalFilePath(b.BotClient, f.FilePath)
+}
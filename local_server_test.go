@@ -0,0 +1,222 @@
+package gotgbot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalServerFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte(testFileContents), 0o600); err != nil {
+		t.Fatalf("failed to write local file: %s", err.Error())
+	}
+
+	var req map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a JSON request, got %s", r.Header.Get("Content-Type"))
+		}
+		req = map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %s", err.Error())
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "result": [{"message_id": 1}]}`))
+	}))
+	defer server.Close()
+
+	b := &Bot{
+		Token: "SOME_TOKEN",
+		BotClient: &BaseBotClient{
+			DefaultRequestOpts: &RequestOpts{APIURL: server.URL},
+			UseLocalServer:     true,
+		},
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open local file: %s", err.Error())
+	}
+	defer f.Close()
+
+	_, err = b.SendMediaGroup(1, []InputMedia{
+		InputMediaDocument{Media: InputFileByReader("file.txt", f)},
+		InputMediaDocument{Media: InputFileByID("some_file_id")},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to send media group: %s", err.Error())
+	}
+
+	expected := `"media":"file://` + filepath.ToSlash(path) + `"`
+	if !strings.Contains(req["media"], expected) || !strings.Contains(req["media"], `"media":"some_file_id"`) {
+		t.Errorf("expected media to reference local file %s, got %s", path, req["media"])
+	}
+}
+
+func TestLocalServerFilesMounted(t *testing.T) {
+	dir := t.TempDir()
+	client := &BaseBotClient{
+		UseLocalServer: true,
+		LocalServerDir: "/var/lib/telegram-bot-api",
+		LocalFileDir:   dir,
+	}
+
+	for name, test := range map[string]struct {
+		path     string
+		expected string
+	}{
+		"inside mounted directory": {
+			path:     filepath.Join(dir, "uploads", "file.txt"),
+			expected: "file:///var/lib/telegram-bot-api/uploads/file.txt",
+		},
+		"outside mounted directory": {
+			path:     "/tmp/file.txt",
+			expected: "file:///tmp/file.txt",
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			if filepath.Separator != '/' {
+				t.Skip("server paths are only tested on unix systems")
+			}
+
+			params, data, err := client.localFileParams(map[string]string{"document": "attach://document"}, map[string]FileReader{
+				"document": {Name: "file.txt", path: test.path},
+			})
+			if err != nil {
+				t.Fatalf("failed to get local file params: %s", err.Error())
+			}
+			if len(data) != 0 || params["document"] != test.expected {
+				t.Errorf("expected document %q, got %q (%d files left)", test.expected, params["document"], len(data))
+			}
+		})
+	}
+}
+
+func TestLocalFilePath(t *testing.T) {
+	for name, test := range map[string]struct {
+		client   BaseBotClient
+		path     string
+		expected string
+		ok       bool
+	}{
+		"cloud server": {
+			client: BaseBotClient{},
+			path:   "documents/file_0.txt",
+		},
+		"local server": {
+			client:   BaseBotClient{UseLocalServer: true},
+			path:     "/var/lib/telegram-bot-api/123:abc/documents/file_0.txt",
+			expected: "/var/lib/telegram-bot-api/123:abc/documents/file_0.txt",
+			ok:       true,
+		},
+		"mounted directory": {
+			client: BaseBotClient{
+				UseLocalServer: true,
+				LocalServerDir: "/var/lib/telegram-bot-api",
+				LocalFileDir:   "/mnt/bot-api",
+			},
+			path:     "/var/lib/telegram-bot-api/123:abc/documents/file_0.txt",
+			expected: "/mnt/bot-api/123:abc/documents/file_0.txt",
+			ok:       true,
+		},
+		"outside mounted directory": {
+			client: BaseBotClient{
+				UseLocalServer: true,
+				LocalServerDir: "/var/lib/telegram-bot-api",
+				LocalFileDir:   "/mnt/bot-api",
+			},
+			path:     "/tmp/file_0.txt",
+			expected: "/tmp/file_0.txt",
+			ok:       true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			b := &Bot{BotClient: &test.client}
+			path, ok := File{FilePath: filepath.FromSlash(test.path)}.LocalPath(b)
+			if ok != test.ok || path != filepath.FromSlash(test.expected) {
+				t.Errorf("expected %q (%v), got %q (%v)", test.expected, test.ok, path, ok)
+			}
+		})
+	}
+}
+
+func TestLocalFilePathWrappedClient(t *testing.T) {
+	client := &BaseBotClient{
+		UseLocalServer: true,
+		LocalServerDir: "/var/lib/telegram-bot-api",
+		LocalFileDir:   "/mnt/bot-api",
+	}
+	serverPath := filepath.FromSlash("/var/lib/telegram-bot-api/123:abc/documents/file_0.txt")
+
+	for name, test := range map[string]struct {
+		client   BotClient
+		path     string
+		expected string
+		ok       bool
+	}{
+		"implements LocalFileResolver": {
+			client:   NewFileIDCache(client, nil),
+			path:     serverPath,
+			expected: filepath.FromSlash("/mnt/bot-api/123:abc/documents/file_0.txt"),
+			ok:       true,
+		},
+		"absolute path fallback": {
+			client:   wrappingBotClient{BotClient: client},
+			path:     serverPath,
+			expected: serverPath,
+			ok:       true,
+		},
+		"relative path fallback": {
+			client: wrappingBotClient{BotClient: client},
+			path:   "documents/file_0.txt",
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			path, ok := File{FilePath: test.path}.LocalPath(&Bot{BotClient: test.client})
+			if ok != test.ok || path != test.expected {
+				t.Errorf("expected %q (%v), got %q (%v)", test.expected, test.ok, path, ok)
+			}
+		})
+	}
+}
+
+func TestMigrateToLocalServer(t *testing.T) {
+	var calls []string
+	newServer := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, name+r.URL.Path[strings.LastIndex(r.URL.Path, "/"):])
+			_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	cloud := newServer("cloud")
+	local1 := newServer("local1")
+	local2 := newServer("local2")
+
+	client := &BaseBotClient{DefaultRequestOpts: &RequestOpts{APIURL: cloud.URL}}
+	b := &Bot{Token: "SOME_TOKEN", BotClient: client}
+
+	if err := b.MigrateToLocalServer(local1.URL, nil); err != nil {
+		t.Fatalf("failed to migrate to local server: %s", err.Error())
+	}
+	if !client.UseLocalServer || client.GetAPIURL(nil) != local1.URL {
+		t.Errorf("expected client to use local server %s, got %s", local1.URL, client.GetAPIURL(nil))
+	}
+
+	if err := b.MigrateToLocalServer(local2.URL, nil); err != nil {
+		t.Fatalf("failed to migrate to second local server: %s", err.Error())
+	}
+
+	expected := "cloud/logOut local1/deleteWebhook local1/close"
+	if strings.Join(calls, " ") != expected {
+		t.Errorf("expected calls %q, got %q", expected, strings.Join(calls, " "))
+	}
+}
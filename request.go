@@ -8,6 +8,7 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strings"
 	"time"
 )
@@ -39,6 +40,16 @@ type BaseBotClient struct {
 	UseTestEnvironment bool
 	// Default opts to use for all requests, when no other request opts are specified.
 	DefaultRequestOpts *RequestOpts
+	// UseLocalServer defines whether this bot is running against a local bot API server (started with --local).
+	// Enabling this sends files which exist on disk (such as those opened with os.Open) as file:// paths instead of
+	// uploading them, and allows for reading downloaded files directly from disk.
+	// See https://github.com/tdlib/telegram-bot-api for more details.
+	UseLocalServer bool
+	// LocalServerDir is the local server's working directory, as seen by the server.
+	// Only needed when it is mounted at a different path on this machine (eg when using docker); see LocalFileDir.
+	LocalServerDir string
+	// LocalFileDir is the path on this machine at which the local server's working directory is mounted.
+	LocalFileDir string
 }
 
 type Response struct {
@@ -78,6 +89,25 @@ type RequestOpts struct {
 	Timeout time.Duration
 	// Custom API URL to use for requests.
 	APIURL string
+	// UploadProgress is called as files are uploaded; see UploadProgressFunc.
+	UploadProgress UploadProgressFunc
+}
+
+// UploadProgressFunc is called as the files of a request are uploaded, with the number of bytes sent so far and the
+// total number of bytes to send. If the size of any of the files is unknown, total is -1.
+// It is called for every chunk written, from the goroutine writing the request body; it should return quickly, and
+// rate limit any expensive work (such as editing a progress message).
+type UploadProgressFunc func(sent int64, total int64)
+
+// uploadProgress returns the UploadProgressFunc to use for the current settings.
+func (bot *BaseBotClient) uploadProgress(opts *RequestOpts) UploadProgressFunc {
+	if opts != nil && opts.UploadProgress != nil {
+		return opts.UploadProgress
+	}
+	if bot.DefaultRequestOpts != nil {
+		return bot.DefaultRequestOpts.UploadProgress
+	}
+	return nil
 }
 
 // getTimeoutContext returns the appropriate context for the current settings.
@@ -134,11 +164,20 @@ func (bot *BaseBotClient) RequestWithContext(parentCtx context.Context, token st
 	ctx, cancel := bot.getTimeoutContext(parentCtx, opts)
 	defer cancel()
 
+	if bot.UseLocalServer && len(data) > 0 {
+		var err error
+		params, data, err = bot.localFileParams(params, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use local files for %s: %w", method, err)
+		}
+	}
+
 	var requestBody io.Reader
 
 	var contentType string
 	// Check if there are any files to upload. If yes, use multipart; else, use JSON.
 	if len(data) > 0 {
+		progress := bot.uploadProgress(opts)
 		pr, pw := io.Pipe()
 		defer pr.Close() // avoid writer goroutine leak
 		mw := multipart.NewWriter(pw)
@@ -148,7 +187,7 @@ func (bot *BaseBotClient) RequestWithContext(parentCtx context.Context, token st
 		// to the multipart.Writer which will be piped into the pipe reader
 		// which is tied to the request to be sent
 		go func() {
-			writerError := fillBuffer(mw, params, data)
+			writerError := fillBuffer(mw, params, data, progress)
 			// Close the writer with error of multipart writer.
 			// If the error is nil, this will act just like pw.Close()
 			_ = pw.CloseWithError(writerError)
@@ -194,7 +233,7 @@ func (bot *BaseBotClient) RequestWithContext(parentCtx context.Context, token st
 }
 
 // Fill the buffer of multipart.Writer with data which is going to be sent.
-func fillBuffer(w *multipart.Writer, params map[string]string, data map[string]FileReader) error {
+func fillBuffer(w *multipart.Writer, params map[string]string, data map[string]FileReader, progress UploadProgressFunc) error {
 	for k, v := range params {
 		err := w.WriteField(k, v)
 		if err != nil {
@@ -202,20 +241,23 @@ func fillBuffer(w *multipart.Writer, params map[string]string, data map[string]F
 		}
 	}
 
-	for field, file := range data {
-		fileName := file.Name
-		if fileName == "" {
-			fileName = field
-		}
+	var pw *progressWriter
+	if progress != nil {
+		pw = &progressWriter{progress: progress, total: totalFileSize(data)}
+	}
 
-		part, err := w.CreateFormFile(field, fileName)
+	for field, file := range data {
+		r, err := file.reader()
 		if err != nil {
-			return fmt.Errorf("failed to create form file for field %s and fileName %s: %w", field, fileName, err)
+			return fmt.Errorf("failed to open file for field %s: %w", field, err)
 		}
 
-		_, err = io.Copy(part, file.Data)
+		err = writeFormFile(w, field, file, r, pw)
+		if closeErr := r.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close file for field %s: %w", field, closeErr)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to copy file contents of field %s to form: %w", field, err)
+			return err
 		}
 	}
 
@@ -226,6 +268,40 @@ func fillBuffer(w *multipart.Writer, params map[string]string, data map[string]F
 	return nil
 }
 
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// writeFormFile writes a file to the multipart form, detecting its name and content type if needed.
+func writeFormFile(w *multipart.Writer, field string, file FileReader, r io.Reader, pw *progressWriter) error {
+	fileName := file.fileName()
+	if fileName == "" {
+		fileName = field
+	}
+
+	r, contentType, err := detectContentType(file, fileName, r)
+	if err != nil {
+		return fmt.Errorf("failed to detect content type of field %s: %w", field, err)
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(field), quoteEscaper.Replace(fileName)))
+	h.Set("Content-Type", contentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return fmt.Errorf("failed to create form file for field %s and fileName %s: %w", field, fileName, err)
+	}
+
+	if pw != nil {
+		pw.w = part
+		part = pw
+	}
+
+	_, err = io.Copy(part, r)
+	if err != nil {
+		return fmt.Errorf("failed to copy file contents of field %s to form: %w", field, err)
+	}
+	return nil
+}
+
 // GetAPIURL returns the currently used API endpoint.
 func (bot *BaseBotClient) GetAPIURL(opts *RequestOpts) string {
 	if opts != nil && opts.APIURL != "" {
@@ -16,6 +16,7 @@ import (
 // scraped and placed on a dashboard.
 // Note: this example is NOT a bot to gather useful chat metrics; it simply demonstrates how various bot metrics
 // could be collected.
+// For a ready-made, dependency-free setup, see the ext/metrics package.
 func main() {
 	// Get token from the environment variable
 	token := os.Getenv("TOKEN")
@@ -1,6 +1,6 @@
 module github.com/PaulSonOfLars/gotgbot/samples/middlewareBot
 
-go 1.19
+go 1.21
 
 require github.com/PaulSonOfLars/gotgbot/v2 v2.99.99
 
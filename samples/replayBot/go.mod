@@ -0,0 +1,7 @@
+module github.com/PaulSonOfLars/gotgbot/samples/replayBot
+
+go 1.21
+
+require github.com/PaulSonOfLars/gotgbot/v2 v2.99.99
+
+replace github.com/PaulSonOfLars/gotgbot/v2 => ../../
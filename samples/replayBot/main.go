@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/replay"
+)
+
+// This bot shows how to record incoming updates, and replay them later to debug how they were handled.
+// Run the bot with `-record updates.jsonl` to record all updates it receives, with personal information redacted.
+// Then, run `go run . replay updates.jsonl` to see which handlers each update matched, and which API calls would have
+// been made - no token required.
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		// Replay recorded updates into the same dispatcher as the live bot.
+		if err := replay.RunCLI(context.Background(), os.Args[2:], newDispatcher(), os.Stdout); err != nil {
+			log.Fatal("failed to replay updates: " + err.Error())
+		}
+		return
+	}
+
+	recordPath := flag.String("record", "", "file to record incoming updates to")
+	flag.Parse()
+
+	// Get token from the environment variable
+	token := os.Getenv("TOKEN")
+	if token == "" {
+		panic("TOKEN environment variable is empty")
+	}
+
+	// Create bot from environment value.
+	b, err := gotgbot.NewBot(token, nil)
+	if err != nil {
+		panic("failed to create new bot: " + err.Error())
+	}
+
+	var dispatcher ext.UpdateDispatcher = newDispatcher()
+	if *recordPath != "" {
+		f, err := os.OpenFile(*recordPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			panic("failed to open recording file: " + err.Error())
+		}
+		defer f.Close()
+
+		// Record all updates before they are processed. Tokens are always redacted; we also redact names and
+		// usernames, which aren't needed to reproduce handler behaviour.
+		dispatcher = replay.NewRecordingDispatcher(dispatcher, replay.NewRecorder(f, &replay.RecorderOpts{
+			RedactPII: true,
+		}))
+	}
+	updater := ext.NewUpdater(dispatcher, nil)
+
+	// Start receiving updates.
+	err = updater.StartPolling(b, &ext.PollingOpts{
+		DropPendingUpdates: true,
+		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
+			Timeout: 9,
+			RequestOpts: &gotgbot.RequestOpts{
+				Timeout: time.Second * 10,
+			},
+		},
+	})
+	if err != nil {
+		panic("failed to start polling: " + err.Error())
+	}
+	log.Printf("%s has been started...\n", b.User.Username)
+
+	// Idle, to keep updates coming in, and avoid bot stopping.
+	updater.Idle()
+}
+
+// newDispatcher creates the dispatcher, with all the bot's handlers. It is shared by the live bot and the replays.
+func newDispatcher() *ext.Dispatcher {
+	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
+		// If an error is returned by a handler, log it and continue going.
+		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
+			log.Println("an error occurred while handling update:", err.Error())
+			return ext.DispatcherActionNoop
+		},
+		MaxRoutines: ext.DefaultMaxRoutines,
+	})
+
+	dispatcher.AddHandler(handlers.NewNamedhandler("start", handlers.NewCommand("start", start)))
+	dispatcher.AddHandler(handlers.NewNamedhandler("echo", handlers.NewMessage(message.Text, echo)))
+	return dispatcher
+}
+
+// start introduces the bot.
+func start(b *gotgbot.Bot, ctx *ext.Context) error {
+	_, err := ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Hello, I'm @%s. I repeat all your messages.", b.User.Username), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+	return nil
+}
+
+// echo replies to a messages with its own contents.
+func echo(b *gotgbot.Bot, ctx *ext.Context) error {
+	_, err := ctx.EffectiveMessage.Reply(b, ctx.EffectiveMessage.Text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to echo message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/tracing"
+)
+
+// This bot shows how to export the traces recorded by the ext/tracing package to OpenTelemetry.
+// The ext/tracing package doesn't depend on any tracing library; instead, otel.go contains a small adapter which
+// implements the tracing.Tracer interface using an OpenTelemetry tracer.
+// Each update is traced, along with the handlers which run and the bot API requests they make. To keep this example
+// self-contained, spans are printed to stdout; swap the exporter for an OTLP one to send them to a tracing backend.
+func main() {
+	// Get token from the environment variable
+	token := os.Getenv("TOKEN")
+	if token == "" {
+		panic("TOKEN environment variable is empty")
+	}
+
+	// Setup the OpenTelemetry tracer provider, which exports all spans to stdout.
+	exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	if err != nil {
+		panic("failed to create trace exporter: " + err.Error())
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	defer func() {
+		// Flush any remaining spans before exiting.
+		if err := provider.Shutdown(context.Background()); err != nil {
+			log.Println("failed to shutdown tracer provider:", err.Error())
+		}
+	}()
+	tracer := newOtelTracer(provider.Tracer("github.com/PaulSonOfLars/gotgbot/samples/tracingBot"))
+
+	// Create bot from environment value.
+	b, err := gotgbot.NewBot(token, &gotgbot.BotOpts{
+		// Trace all bot API requests.
+		BotClient: tracing.NewClient(&gotgbot.BaseBotClient{}, tracer),
+	})
+	if err != nil {
+		panic("failed to create new bot: " + err.Error())
+	}
+
+	// Create updater and dispatcher.
+	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
+		// If an error is returned by a handler, log it and continue going.
+		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
+			log.Println("an error occurred while handling update:", err.Error())
+			return ext.DispatcherActionNoop
+		},
+		MaxRoutines: ext.DefaultMaxRoutines,
+	})
+	// Trace all updates, and the handlers which run for them.
+	tracing.Instrument(dispatcher, tracer)
+
+	updater := ext.NewUpdater(dispatcher, nil)
+
+	// Add echo handler to reply to all text messages.
+	dispatcher.AddHandler(handlers.NewMessage(message.Text, echo))
+
+	// Start receiving updates.
+	err = updater.StartPolling(b, &ext.PollingOpts{
+		DropPendingUpdates: true,
+		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
+			Timeout: 9,
+			RequestOpts: &gotgbot.RequestOpts{
+				Timeout: time.Second * 10,
+			},
+		},
+	})
+	if err != nil {
+		panic("failed to start polling: " + err.Error())
+	}
+	log.Printf("%s has been started...\n", b.User.Username)
+
+	// Idle, to keep updates coming in, and avoid bot stopping.
+	updater.Idle()
+}
+
+// echo replies to a messages with its own contents.
+// The ext.Context is passed to the request, so that the sendMessage span is part of the update's trace.
+func echo(b *gotgbot.Bot, ctx *ext.Context) error {
+	_, err := b.SendMessageWithContext(ctx, ctx.EffectiveChat.Id, ctx.EffectiveMessage.Text, &gotgbot.SendMessageOpts{
+		ReplyParameters: &gotgbot.ReplyParameters{MessageId: ctx.EffectiveMessage.MessageId},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to echo message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/tracing"
+)
+
+// otelTracer is a tracing.Tracer which creates OpenTelemetry spans.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+var _ tracing.Tracer = otelTracer{}
+
+func newOtelTracer(t trace.Tracer) otelTracer {
+	return otelTracer{tracer: t}
+}
+
+func (t otelTracer) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	// OpenTelemetry stores the current span in the context, so child spans are linked to their parents automatically.
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(otelAttributes(attrs)...))
+	return ctx, otelSpan{span: span}
+}
+
+// otelSpan is a tracing.Span wrapping an OpenTelemetry span.
+type otelSpan struct {
+	span trace.Span
+}
+
+var _ tracing.Span = otelSpan{}
+
+func (s otelSpan) SetAttributes(attrs ...tracing.Attribute) {
+	s.span.SetAttributes(otelAttributes(attrs)...)
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+// otelAttributes converts tracing attributes to OpenTelemetry attributes.
+func otelAttributes(attrs []tracing.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(a.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(a.Key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}